@@ -20,10 +20,85 @@ type Offer struct {
 	MaxWeight   int     `mapstructure:"maxWeight" json:"maxWeight" validate:"required"`
 }
 
+// ServiceTimes are the non-driving parts of a trip: loading at the depot once
+// per trip, handing over at every stop, and handling time per kg delivered.
+type ServiceTimes struct {
+	DepotLoadingMinutes  float64 `mapstructure:"depotLoadingMinutes" json:"depotLoadingMinutes" validate:"gte=0"`
+	StopHandoverMinutes  float64 `mapstructure:"stopHandoverMinutes" json:"stopHandoverMinutes" validate:"gte=0"`
+	HandlingMinutesPerKG float64 `mapstructure:"handlingMinutesPerKG" json:"handlingMinutesPerKG" validate:"gte=0"`
+}
+
+// OperatingCosts is what running the fleet costs the operator: fuel per km
+// driven, driver pay per hour out on a trip, and a fixed cost for every
+// vehicle used in a batch.
+type OperatingCosts struct {
+	FuelCostPerKM     float64 `mapstructure:"fuelCostPerKM" json:"fuelCostPerKM" validate:"gte=0"`
+	DriverCostPerHour float64 `mapstructure:"driverCostPerHour" json:"driverCostPerHour" validate:"gte=0"`
+	VehicleFixedCost  float64 `mapstructure:"vehicleFixedCost" json:"vehicleFixedCost" validate:"gte=0"`
+}
+
+// ReattemptFees is what a package is charged for every failed delivery
+// attempt: a flat fee plus PriceRate times its delivery price.
+type ReattemptFees struct {
+	FlatFee   float64 `mapstructure:"flatFee" json:"flatFee" validate:"gte=0"`
+	PriceRate float64 `mapstructure:"priceRate" json:"priceRate" validate:"gte=0"`
+}
+
+// Tax is the sales tax added to every invoice, as a share of the invoice net.
+type Tax struct {
+	Name string  `mapstructure:"name" json:"name"`
+	Rate float64 `mapstructure:"rate" json:"rate" validate:"gte=0"`
+}
+
+// EndpointLimits caps how hard one kind of endpoint may be used. Every API
+// key gets a bucket of Burst requests refilled at RequestsPerSecond, and at
+// most MaxConcurrent requests run at once across all keys. Zero means no
+// limit.
+type EndpointLimits struct {
+	RequestsPerSecond float64 `mapstructure:"requestsPerSecond" json:"requestsPerSecond" validate:"gte=0"`
+	Burst             int     `mapstructure:"burst" json:"burst" validate:"gte=0"`
+	MaxConcurrent     int     `mapstructure:"maxConcurrent" json:"maxConcurrent" validate:"gte=0"`
+}
+
+// RateLimits are the limits of the cheap quote endpoints and of the
+// expensive plan endpoints of the HTTP API.
+type RateLimits struct {
+	Quote EndpointLimits `mapstructure:"quote" json:"quote"`
+	Plan  EndpointLimits `mapstructure:"plan" json:"plan"`
+}
+
+// JobSettings sizes the pool that runs plan jobs submitted over the HTTP
+// API. Zero workers means one per CPU, and a zero queue accepts a job only
+// when a worker is free. Finished jobs are kept for RetentionMinutes, or for
+// good when it is zero. A job's webhook is tried up to WebhookAttempts times,
+// waiting WebhookBackoffSeconds after the first failure and twice as long
+// after each one since. Webhooks only reach public addresses, except on the
+// hosts listed in WebhookAllowedHosts. A plan request may carry at most
+// MaxPackages packages, zero meaning as many as the planner can search, and
+// a job plans for at most TimeoutSeconds, zero meaning until it is done.
+type JobSettings struct {
+	Workers               int      `mapstructure:"workers" json:"workers" validate:"gte=0"`
+	QueueSize             int      `mapstructure:"queueSize" json:"queueSize" validate:"gte=0"`
+	RetentionMinutes      float64  `mapstructure:"retentionMinutes" json:"retentionMinutes" validate:"gte=0"`
+	WebhookAttempts       int      `mapstructure:"webhookAttempts" json:"webhookAttempts" validate:"gte=0"`
+	WebhookBackoffSeconds float64  `mapstructure:"webhookBackoffSeconds" json:"webhookBackoffSeconds" validate:"gte=0"`
+	WebhookAllowedHosts   []string `mapstructure:"webhookAllowedHosts" json:"webhookAllowedHosts"`
+	MaxPackages           int      `mapstructure:"maxPackages" json:"maxPackages" validate:"gte=0"`
+	TimeoutSeconds        float64  `mapstructure:"timeoutSeconds" json:"timeoutSeconds" validate:"gte=0"`
+}
+
 type config struct {
-	Offers            []Offer `mapstructure:"offers" json:"offers" validate:"required"`
-	DistanceCostPerKM int     `mapstructure:"distanceCostPerKM" json:"distanceCostPerKM" validate:"required"`
-	WeightCostPerKG   int     `mapstructure:"weightCostPerKG" json:"weightCostPerKG" validate:"required"`
+	Offers            []Offer            `mapstructure:"offers" json:"offers" validate:"required"`
+	DistanceCostPerKM int                `mapstructure:"distanceCostPerKM" json:"distanceCostPerKM" validate:"required"`
+	WeightCostPerKG   int                `mapstructure:"weightCostPerKG" json:"weightCostPerKG" validate:"required"`
+	ServiceLevels     map[string]float64 `mapstructure:"serviceLevels" json:"serviceLevels" validate:"omitempty,dive,gt=0"`
+	CustomerTiers     map[string]float64 `mapstructure:"customerTiers" json:"customerTiers" validate:"omitempty,dive,gte=0,lt=1"`
+	ServiceTimes      ServiceTimes       `mapstructure:"serviceTimes" json:"serviceTimes"`
+	OperatingCosts    OperatingCosts     `mapstructure:"operatingCosts" json:"operatingCosts"`
+	ReattemptFees     ReattemptFees      `mapstructure:"reattemptFees" json:"reattemptFees"`
+	Tax               Tax                `mapstructure:"tax" json:"tax"`
+	RateLimits        RateLimits         `mapstructure:"rateLimits" json:"rateLimits"`
+	Jobs              JobSettings        `mapstructure:"jobs" json:"jobs"`
 }
 
 func NewConfig() Config {
@@ -74,3 +149,59 @@ func GetWeightCostPerKG() int {
 func GetDistanceCostPerKM() int {
 	return viper.GetInt("distanceCostPerKM")
 }
+
+// GetServiceLevelMultiplier returns the price multiplier configured for a
+// service level, or 1 when the level has no multiplier configured.
+func GetServiceLevelMultiplier(serviceLevel string) float64 {
+	key := "serviceLevels." + serviceLevel
+	if !viper.IsSet(key) {
+		return 1
+	}
+	return viper.GetFloat64(key)
+}
+
+// GetCustomerTierDiscount returns the share of the price a customer tier takes
+// off, and whether the tier is configured at all.
+func GetCustomerTierDiscount(tier string) (float64, bool) {
+	key := "customerTiers." + tier
+	if !viper.IsSet(key) {
+		return 0, false
+	}
+	return viper.GetFloat64(key), true
+}
+
+func GetServiceTimes() ServiceTimes {
+	var serviceTimes ServiceTimes
+	viper.UnmarshalKey("serviceTimes", &serviceTimes)
+	return serviceTimes
+}
+
+func GetOperatingCosts() OperatingCosts {
+	var operatingCosts OperatingCosts
+	viper.UnmarshalKey("operatingCosts", &operatingCosts)
+	return operatingCosts
+}
+
+func GetReattemptFees() ReattemptFees {
+	var reattemptFees ReattemptFees
+	viper.UnmarshalKey("reattemptFees", &reattemptFees)
+	return reattemptFees
+}
+
+func GetTax() Tax {
+	var tax Tax
+	viper.UnmarshalKey("tax", &tax)
+	return tax
+}
+
+func GetRateLimits() RateLimits {
+	var rateLimits RateLimits
+	viper.UnmarshalKey("rateLimits", &rateLimits)
+	return rateLimits
+}
+
+func GetJobSettings() JobSettings {
+	var jobSettings JobSettings
+	viper.UnmarshalKey("jobs", &jobSettings)
+	return jobSettings
+}
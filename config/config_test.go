@@ -1,6 +1,7 @@
 package config
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
@@ -180,3 +181,380 @@ var _ = Describe("Config", func() {
 		})
 	})
 })
+
+var _ = Describe("GetServiceLevelMultiplier", func() {
+	var configPath string
+
+	BeforeEach(func() {
+		configPath = "config_test.json"
+		configContent := `{
+			"offers": [
+				{
+					"code": "OFFER1",
+					"discount": 10,
+					"minDistance": 0,
+					"maxDistance": 100,
+					"minWeight": 0,
+					"maxWeight": 10
+				}
+			],
+			"distanceCostPerKM": 5,
+			"weightCostPerKG": 10,
+			"serviceLevels": {
+				"express": 1.5,
+				"same-day": 2
+			}
+		}`
+		err := os.WriteFile(configPath, []byte(configContent), 0644)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(NewConfig().LoadConfig(configPath)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.Remove(configPath)
+	})
+
+	It("should return the configured multiplier", func() {
+		Expect(GetServiceLevelMultiplier("express")).To(Equal(1.5))
+		Expect(GetServiceLevelMultiplier("same-day")).To(Equal(2.0))
+	})
+
+	It("should default to no multiplier", func() {
+		Expect(GetServiceLevelMultiplier("standard")).To(Equal(1.0))
+	})
+})
+
+var _ = Describe("GetServiceTimes", func() {
+	var configPath string
+
+	BeforeEach(func() {
+		configPath = "config_test.json"
+		configContent := `{
+			"offers": [
+				{
+					"code": "OFFER1",
+					"discount": 10,
+					"minDistance": 0,
+					"maxDistance": 100,
+					"minWeight": 0,
+					"maxWeight": 10
+				}
+			],
+			"distanceCostPerKM": 5,
+			"weightCostPerKG": 10,
+			"serviceTimes": {
+				"depotLoadingMinutes": 20,
+				"stopHandoverMinutes": 5,
+				"handlingMinutesPerKG": 0.1
+			}
+		}`
+		err := os.WriteFile(configPath, []byte(configContent), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Remove(configPath)
+	})
+
+	It("should return the configured service times", func() {
+		Expect(NewConfig().LoadConfig(configPath)).To(Succeed())
+
+		Expect(GetServiceTimes()).To(Equal(ServiceTimes{DepotLoadingMinutes: 20, StopHandoverMinutes: 5, HandlingMinutesPerKG: 0.1}))
+	})
+
+	It("should reject negative service times", func() {
+		content, _ := os.ReadFile(configPath)
+		negative := bytes.Replace(content, []byte(`"stopHandoverMinutes": 5`), []byte(`"stopHandoverMinutes": -5`), 1)
+		Expect(os.WriteFile(configPath, negative, 0644)).To(Succeed())
+
+		Expect(NewConfig().LoadConfig(configPath)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("GetOperatingCosts", func() {
+	var configPath string
+
+	BeforeEach(func() {
+		configPath = "config_test.json"
+		configContent := `{
+			"offers": [
+				{
+					"code": "OFFER1",
+					"discount": 10,
+					"minDistance": 0,
+					"maxDistance": 100,
+					"minWeight": 0,
+					"maxWeight": 10
+				}
+			],
+			"distanceCostPerKM": 5,
+			"weightCostPerKG": 10,
+			"operatingCosts": {
+				"fuelCostPerKM": 1.5,
+				"driverCostPerHour": 120,
+				"vehicleFixedCost": 300
+			}
+		}`
+		err := os.WriteFile(configPath, []byte(configContent), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Remove(configPath)
+	})
+
+	It("should return the configured operating costs", func() {
+		Expect(NewConfig().LoadConfig(configPath)).To(Succeed())
+
+		Expect(GetOperatingCosts()).To(Equal(OperatingCosts{FuelCostPerKM: 1.5, DriverCostPerHour: 120, VehicleFixedCost: 300}))
+	})
+
+	It("should reject negative operating costs", func() {
+		content, _ := os.ReadFile(configPath)
+		negative := bytes.Replace(content, []byte(`"vehicleFixedCost": 300`), []byte(`"vehicleFixedCost": -300`), 1)
+		Expect(os.WriteFile(configPath, negative, 0644)).To(Succeed())
+
+		Expect(NewConfig().LoadConfig(configPath)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("GetReattemptFees", func() {
+	var configPath string
+
+	BeforeEach(func() {
+		configPath = "config_test.json"
+		configContent := `{
+			"offers": [
+				{
+					"code": "OFFER1",
+					"discount": 10,
+					"minDistance": 0,
+					"maxDistance": 100,
+					"minWeight": 0,
+					"maxWeight": 10
+				}
+			],
+			"distanceCostPerKM": 5,
+			"weightCostPerKG": 10,
+			"reattemptFees": {
+				"flatFee": 50,
+				"priceRate": 0.1
+			}
+		}`
+		err := os.WriteFile(configPath, []byte(configContent), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Remove(configPath)
+	})
+
+	It("should return the configured re-attempt fees", func() {
+		Expect(NewConfig().LoadConfig(configPath)).To(Succeed())
+
+		Expect(GetReattemptFees()).To(Equal(ReattemptFees{FlatFee: 50, PriceRate: 0.1}))
+	})
+
+	It("should reject a negative fee", func() {
+		content, _ := os.ReadFile(configPath)
+		negative := bytes.Replace(content, []byte(`"flatFee": 50`), []byte(`"flatFee": -50`), 1)
+		Expect(os.WriteFile(configPath, negative, 0644)).To(Succeed())
+
+		Expect(NewConfig().LoadConfig(configPath)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("GetCustomerTierDiscount", func() {
+	var configPath string
+
+	BeforeEach(func() {
+		configPath = "config_test.json"
+		configContent := `{
+			"offers": [
+				{
+					"code": "OFFER1",
+					"discount": 10,
+					"minDistance": 0,
+					"maxDistance": 100,
+					"minWeight": 0,
+					"maxWeight": 10
+				}
+			],
+			"distanceCostPerKM": 5,
+			"weightCostPerKG": 10,
+			"customerTiers": {
+				"standard": 0,
+				"gold": 0.05
+			}
+		}`
+		err := os.WriteFile(configPath, []byte(configContent), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Remove(configPath)
+	})
+
+	It("should return the configured tier discount", func() {
+		Expect(NewConfig().LoadConfig(configPath)).To(Succeed())
+
+		discount, found := GetCustomerTierDiscount("gold")
+		Expect(found).To(BeTrue())
+		Expect(discount).To(Equal(0.05))
+
+		_, found = GetCustomerTierDiscount("platinum")
+		Expect(found).To(BeFalse())
+	})
+
+	It("should reject a tier discount of the whole price", func() {
+		content, _ := os.ReadFile(configPath)
+		whole := bytes.Replace(content, []byte(`"gold": 0.05`), []byte(`"gold": 1`), 1)
+		Expect(os.WriteFile(configPath, whole, 0644)).To(Succeed())
+
+		Expect(NewConfig().LoadConfig(configPath)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("GetTax", func() {
+	var configPath string
+
+	BeforeEach(func() {
+		configPath = "config_test.json"
+		configContent := `{
+			"offers": [
+				{
+					"code": "OFFER1",
+					"discount": 10,
+					"minDistance": 0,
+					"maxDistance": 100,
+					"minWeight": 0,
+					"maxWeight": 10
+				}
+			],
+			"distanceCostPerKM": 5,
+			"weightCostPerKG": 10,
+			"tax": {
+				"name": "VAT",
+				"rate": 0.2
+			}
+		}`
+		err := os.WriteFile(configPath, []byte(configContent), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Remove(configPath)
+	})
+
+	It("should return the configured tax", func() {
+		Expect(NewConfig().LoadConfig(configPath)).To(Succeed())
+
+		Expect(GetTax()).To(Equal(Tax{Name: "VAT", Rate: 0.2}))
+	})
+
+	It("should reject a negative rate", func() {
+		content, _ := os.ReadFile(configPath)
+		negative := bytes.Replace(content, []byte(`"rate": 0.2`), []byte(`"rate": -0.2`), 1)
+		Expect(os.WriteFile(configPath, negative, 0644)).To(Succeed())
+
+		Expect(NewConfig().LoadConfig(configPath)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("GetRateLimits", func() {
+	var configPath string
+
+	BeforeEach(func() {
+		configPath = "config_test.json"
+		configContent := `{
+			"offers": [
+				{
+					"code": "OFFER1",
+					"discount": 10,
+					"minDistance": 0,
+					"maxDistance": 100,
+					"minWeight": 0,
+					"maxWeight": 10
+				}
+			],
+			"distanceCostPerKM": 5,
+			"weightCostPerKG": 10,
+			"rateLimits": {
+				"quote": {"requestsPerSecond": 10, "burst": 20, "maxConcurrent": 32},
+				"plan": {"requestsPerSecond": 0.2, "burst": 2, "maxConcurrent": 2}
+			}
+		}`
+		err := os.WriteFile(configPath, []byte(configContent), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Remove(configPath)
+	})
+
+	It("should return the configured limits", func() {
+		Expect(NewConfig().LoadConfig(configPath)).To(Succeed())
+
+		Expect(GetRateLimits()).To(Equal(RateLimits{
+			Quote: EndpointLimits{RequestsPerSecond: 10, Burst: 20, MaxConcurrent: 32},
+			Plan:  EndpointLimits{RequestsPerSecond: 0.2, Burst: 2, MaxConcurrent: 2},
+		}))
+	})
+
+	It("should reject a negative limit", func() {
+		content, _ := os.ReadFile(configPath)
+		negative := bytes.Replace(content, []byte(`"maxConcurrent": 2}`), []byte(`"maxConcurrent": -2}`), 1)
+		Expect(os.WriteFile(configPath, negative, 0644)).To(Succeed())
+
+		Expect(NewConfig().LoadConfig(configPath)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("GetJobSettings", func() {
+	var configPath string
+
+	BeforeEach(func() {
+		configPath = "config_test.json"
+		configContent := `{
+			"offers": [
+				{
+					"code": "OFFER1",
+					"discount": 10,
+					"minDistance": 0,
+					"maxDistance": 100,
+					"minWeight": 0,
+					"maxWeight": 10
+				}
+			],
+			"distanceCostPerKM": 5,
+			"weightCostPerKG": 10,
+			"jobs": {
+				"workers": 2,
+				"queueSize": 16,
+				"retentionMinutes": 60,
+				"webhookAttempts": 5,
+				"webhookBackoffSeconds": 1
+			}
+		}`
+		err := os.WriteFile(configPath, []byte(configContent), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Remove(configPath)
+	})
+
+	It("should return the configured job settings", func() {
+		Expect(NewConfig().LoadConfig(configPath)).To(Succeed())
+
+		Expect(GetJobSettings()).To(Equal(JobSettings{Workers: 2, QueueSize: 16, RetentionMinutes: 60, WebhookAttempts: 5, WebhookBackoffSeconds: 1}))
+	})
+
+	It("should reject a negative queue size", func() {
+		content, _ := os.ReadFile(configPath)
+		negative := bytes.Replace(content, []byte(`"queueSize": 16`), []byte(`"queueSize": -16`), 1)
+		Expect(os.WriteFile(configPath, negative, 0644)).To(Succeed())
+
+		Expect(NewConfig().LoadConfig(configPath)).ToNot(Succeed())
+	})
+})
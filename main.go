@@ -6,6 +6,7 @@ package main
 import (
 	"courier_service/src/cmd"
 	"fmt"
+	"os"
 
 	"courier_service/config"
 )
@@ -14,8 +15,8 @@ func main() {
 	appConfig := config.NewConfig()
 	err := appConfig.LoadConfig("config/app_config.json")
 	if err != nil {
-		fmt.Errorf("Error while loading configs:%s\n", err)
-		return
+		fmt.Printf("Error while loading configs:%s\n", err)
+		os.Exit(1)
 	}
 	if err := cmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -0,0 +1,386 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"courier_service/store"
+
+	"github.com/spf13/cobra"
+)
+
+// DailyRevenue totals the packages whose latest quote fell on Day.
+type DailyRevenue struct {
+	Day              string  `json:"day"`
+	Packages         int     `json:"packages"`
+	Gross            float64 `json:"gross"`
+	ContractDiscount float64 `json:"contractDiscount"`
+	OfferDiscount    float64 `json:"offerDiscount"`
+	Revenue          float64 `json:"revenue"`
+}
+
+// OfferUsage is how often an offer code was redeemed on a latest quote and
+// how much it took off.
+type OfferUsage struct {
+	OfferCode string  `json:"offerCode"`
+	Uses      int     `json:"uses"`
+	Discount  float64 `json:"discount"`
+}
+
+// AnalyticsReport sums up the quotes and plans kept in the store. Each
+// package counts once, at its latest quote and in the latest plan that put it
+// on a trip. OnTimeRate is over the planned packages with a deadline that
+// were delivered, failed or returned, and counts those delivered by their
+// deadline. ForecastOnTimeRate is over every planned package with a deadline
+// and compares its planned ETA instead. Both are zero when there is nothing
+// to count.
+type AnalyticsReport struct {
+	From                   string         `json:"from,omitempty"`
+	To                     string         `json:"to,omitempty"`
+	Days                   []DailyRevenue `json:"days"`
+	Offers                 []OfferUsage   `json:"offers"`
+	Packages               int            `json:"packages"`
+	Revenue                float64        `json:"revenue"`
+	Discount               float64        `json:"discount"`
+	CostPerKG              float64        `json:"costPerKG"`
+	CostPerKM              float64        `json:"costPerKM"`
+	Plans                  int            `json:"plans"`
+	FleetUtilisation       float64        `json:"fleetUtilisation"`
+	PackagesWithDeadline   int            `json:"packagesWithDeadline"`
+	FinishedWithDeadline   int            `json:"finishedWithDeadline"`
+	OnTimePackages         int            `json:"onTimePackages"`
+	OnTimeRate             float64        `json:"onTimeRate"`
+	ForecastOnTimePackages int            `json:"forecastOnTimePackages"`
+	ForecastOnTimeRate     float64        `json:"forecastOnTimeRate"`
+}
+
+var (
+	analyticsFormat string
+	analyticsOutput string
+	analyticsFrom   string
+	analyticsTo     string
+)
+
+// isInReportRange tells whether the day of at lies between from and to, both
+// inclusive days formatted 2006-01-02 and either of which may be empty.
+func isInReportRange(at time.Time, from, to string) bool {
+	day := at.Format("2006-01-02")
+	return (from == "" || day >= from) && (to == "" || day <= to)
+}
+
+func buildAnalyticsReport(repository store.Repository, from, to string) (AnalyticsReport, error) {
+	report := AnalyticsReport{From: from, To: to, Days: []DailyRevenue{}, Offers: []OfferUsage{}}
+
+	quotes, err := repository.ListQuotes()
+	if err != nil {
+		return report, err
+	}
+	latest := make(map[string]store.Quote)
+	for _, quote := range quotes {
+		latest[quote.PackageID] = quote
+	}
+
+	redemptions, err := repository.ListOfferRedemptions()
+	if err != nil {
+		return report, err
+	}
+	redeemed := make(map[string]store.OfferRedemption)
+	for _, redemption := range redemptions {
+		if quote, found := latest[redemption.PackageID]; found && redemption.RedeemedAt.Equal(quote.QuotedAt) {
+			redeemed[redemption.PackageID] = redemption
+		}
+	}
+
+	days := make(map[string]*DailyRevenue)
+	offers := make(map[string]*OfferUsage)
+	weight, distance := 0, 0
+	for packageID, quote := range latest {
+		if !isInReportRange(quote.QuotedAt, from, to) {
+			continue
+		}
+
+		name := quote.QuotedAt.Format("2006-01-02")
+		day, found := days[name]
+		if !found {
+			day = &DailyRevenue{Day: name}
+			days[name] = day
+		}
+		day.Packages++
+		day.Gross += quote.TotalCost
+		day.ContractDiscount += quote.ContractDiscount
+		day.OfferDiscount += quote.Discount - quote.ContractDiscount
+		day.Revenue += quote.FinalCost
+
+		if redemption, found := redeemed[packageID]; found {
+			offer, found := offers[redemption.OfferCode]
+			if !found {
+				offer = &OfferUsage{OfferCode: redemption.OfferCode}
+				offers[redemption.OfferCode] = offer
+			}
+			offer.Uses++
+			offer.Discount += redemption.Discount
+		}
+
+		report.Packages++
+		report.Revenue += quote.FinalCost
+		report.Discount += quote.Discount
+		if pkg, err := repository.GetPackage(packageID); err == nil {
+			weight += pkg.Weight
+			distance += pkg.Distance
+		}
+	}
+
+	for _, day := range days {
+		report.Days = append(report.Days, *day)
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Day < report.Days[j].Day })
+	for _, offer := range offers {
+		report.Offers = append(report.Offers, *offer)
+	}
+	sort.Slice(report.Offers, func(i, j int) bool { return report.Offers[i].OfferCode < report.Offers[j].OfferCode })
+
+	if weight > 0 {
+		report.CostPerKG = report.Revenue / float64(weight)
+	}
+	if distance > 0 {
+		report.CostPerKM = report.Revenue / float64(distance)
+	}
+
+	return report, addPlanAnalytics(repository, &report, from, to)
+}
+
+// plannedPackage is a package as the latest plan that put it on a trip left
+// it, with the time that plan was made.
+type plannedPackage struct {
+	Package
+	PlannedAt time.Time
+}
+
+// addPlanAnalytics adds the fleet utilisation over every plan in the range,
+// as busy vehicle hours over available vehicle hours, and the on-time rates
+// of the packages with a deadline.
+func addPlanAnalytics(repository store.Repository, report *AnalyticsReport, from, to string) error {
+	plans, err := repository.ListPlans()
+	if err != nil {
+		return err
+	}
+
+	busy, available := 0.0, 0.0
+	planned := make(map[string]plannedPackage)
+	for _, plan := range plans {
+		if !isInReportRange(plan.CreatedAt, from, to) {
+			continue
+		}
+
+		var state PlanState
+		if err := json.Unmarshal(plan.State, &state); err != nil {
+			return fmt.Errorf("Invalid plan %s in store: %s", plan.ID, err)
+		}
+		report.Plans++
+
+		summary := summariseSchedule(state.Trips, state.NumVehicles)
+		for _, vehicle := range summary.Vehicles {
+			busy += vehicle.BusyHours
+		}
+		available += summary.Makespan * float64(len(summary.Vehicles))
+
+		for _, trip := range state.Trips {
+			for _, pkg := range trip.Packages {
+				planned[pkg.ID] = plannedPackage{pkg, plan.CreatedAt}
+			}
+		}
+	}
+	if available > 0 {
+		report.FleetUtilisation = busy / available
+	}
+
+	for _, pkg := range planned {
+		if pkg.LatestDelivery == 0 {
+			continue
+		}
+		report.PackagesWithDeadline++
+		if pkg.DeliveryTime <= pkg.LatestDelivery {
+			report.ForecastOnTimePackages++
+		}
+
+		stored, err := repository.GetPackage(pkg.ID)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		finished, onTime := getDeliveryOutcome(stored, getDeadline(pkg))
+		if finished {
+			report.FinishedWithDeadline++
+		}
+		if onTime {
+			report.OnTimePackages++
+		}
+	}
+	if report.PackagesWithDeadline > 0 {
+		report.ForecastOnTimeRate = float64(report.ForecastOnTimePackages) / float64(report.PackagesWithDeadline)
+	}
+	if report.FinishedWithDeadline > 0 {
+		report.OnTimeRate = float64(report.OnTimePackages) / float64(report.FinishedWithDeadline)
+	}
+	return nil
+}
+
+// getDeadline is when a planned package is due: its latest delivery time,
+// in hours, after the plan was made.
+func getDeadline(pkg plannedPackage) time.Time {
+	return pkg.PlannedAt.Add(time.Duration(pkg.LatestDelivery * float64(time.Hour)))
+}
+
+// getDeliveryOutcome tells from the status history whether a package is
+// finished, that is delivered or left failed or returned, and whether it was
+// delivered by the deadline.
+func getDeliveryOutcome(pkg store.Package, deadline time.Time) (finished, onTime bool) {
+	for i := len(pkg.History) - 1; i >= 0; i-- {
+		if pkg.History[i].Status == store.StatusDelivered {
+			return true, !pkg.History[i].At.After(deadline)
+		}
+	}
+	return pkg.Status == store.StatusFailed || pkg.Status == store.StatusReturned, false
+}
+
+func writeAnalyticsText(w io.Writer, report AnalyticsReport) {
+	fmt.Fprintln(w, "Revenue by day:")
+	fmt.Fprintf(w, "  %-10s  %8s  %10s  %10s  %10s  %10s\n", "Day", "Packages", "Gross", "Contract", "Offers", "Revenue")
+	for _, day := range report.Days {
+		fmt.Fprintf(w, "  %-10s  %8d  %10.2f  %10.2f  %10.2f  %10.2f\n", day.Day, day.Packages, day.Gross, day.ContractDiscount, day.OfferDiscount, day.Revenue)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Offer usage:")
+	fmt.Fprintf(w, "  %-10s  %8s  %10s\n", "Offer", "Uses", "Discount")
+	for _, offer := range report.Offers {
+		fmt.Fprintf(w, "  %-10s  %8d  %10.2f\n", offer.OfferCode, offer.Uses, offer.Discount)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Packages: %d, revenue %.2f, discounts %.2f\n", report.Packages, report.Revenue, report.Discount)
+	fmt.Fprintf(w, "Average cost per kg: %.2f\n", report.CostPerKG)
+	fmt.Fprintf(w, "Average cost per km: %.2f\n", report.CostPerKM)
+	fmt.Fprintf(w, "Plans: %d, fleet utilisation %.1f%%\n", report.Plans, report.FleetUtilisation*100)
+	if report.FinishedWithDeadline == 0 {
+		fmt.Fprintln(w, "On-time rate: no delivered, failed or returned packages with a deadline")
+	} else {
+		fmt.Fprintf(w, "On-time rate: %.1f%% (%d of %d delivered, failed or returned packages with a deadline)\n", report.OnTimeRate*100, report.OnTimePackages, report.FinishedWithDeadline)
+	}
+	if report.PackagesWithDeadline == 0 {
+		fmt.Fprintln(w, "Forecast on-time rate: no planned packages with a deadline")
+	} else {
+		fmt.Fprintf(w, "Forecast on-time rate: %.1f%% (%d of %d planned packages with a deadline)\n", report.ForecastOnTimeRate*100, report.ForecastOnTimePackages, report.PackagesWithDeadline)
+	}
+}
+
+// writeAnalyticsCSV writes the report as one section,key,metric,value row
+// per figure so that every table fits the same columns.
+func writeAnalyticsCSV(w io.Writer, report AnalyticsReport) error {
+	formatAmount := func(amount float64) string { return strconv.FormatFloat(amount, 'f', 2, 64) }
+
+	records := [][]string{{"section", "key", "metric", "value"}}
+	for _, day := range report.Days {
+		records = append(records,
+			[]string{"day", day.Day, "packages", strconv.Itoa(day.Packages)},
+			[]string{"day", day.Day, "gross", formatAmount(day.Gross)},
+			[]string{"day", day.Day, "contract_discount", formatAmount(day.ContractDiscount)},
+			[]string{"day", day.Day, "offer_discount", formatAmount(day.OfferDiscount)},
+			[]string{"day", day.Day, "revenue", formatAmount(day.Revenue)},
+		)
+	}
+	for _, offer := range report.Offers {
+		records = append(records,
+			[]string{"offer", offer.OfferCode, "uses", strconv.Itoa(offer.Uses)},
+			[]string{"offer", offer.OfferCode, "discount", formatAmount(offer.Discount)},
+		)
+	}
+	records = append(records,
+		[]string{"total", "", "packages", strconv.Itoa(report.Packages)},
+		[]string{"total", "", "revenue", formatAmount(report.Revenue)},
+		[]string{"total", "", "discount", formatAmount(report.Discount)},
+		[]string{"total", "", "cost_per_kg", formatAmount(report.CostPerKG)},
+		[]string{"total", "", "cost_per_km", formatAmount(report.CostPerKM)},
+		[]string{"total", "", "plans", strconv.Itoa(report.Plans)},
+		[]string{"total", "", "fleet_utilisation", strconv.FormatFloat(report.FleetUtilisation, 'f', 4, 64)},
+		[]string{"total", "", "packages_with_deadline", strconv.Itoa(report.PackagesWithDeadline)},
+		[]string{"total", "", "finished_with_deadline", strconv.Itoa(report.FinishedWithDeadline)},
+		[]string{"total", "", "on_time_packages", strconv.Itoa(report.OnTimePackages)},
+		[]string{"total", "", "on_time_rate", strconv.FormatFloat(report.OnTimeRate, 'f', 4, 64)},
+		[]string{"total", "", "forecast_on_time_packages", strconv.Itoa(report.ForecastOnTimePackages)},
+		[]string{"total", "", "forecast_on_time_rate", strconv.FormatFloat(report.ForecastOnTimeRate, 'f', 4, 64)},
+	)
+
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func writeAnalyticsReport(w io.Writer, format string, report AnalyticsReport) error {
+	switch format {
+	case "csv":
+		return writeAnalyticsCSV(w, report)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	writeAnalyticsText(w, report)
+	return nil
+}
+
+var analyticsReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report revenue, discounts, utilisation and on-time rate",
+	Long:  `This command sums up the quotes and plans kept in the store: revenue and discounts by day, how often each offer code was used and what it cost, the average price per kg and per km, fleet utilisation, the share of packages actually delivered by their deadline and the share the plans forecast to be.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if analyticsFormat != "text" && analyticsFormat != "csv" && analyticsFormat != "json" {
+			return fmt.Errorf("Invalid report format %s", analyticsFormat)
+		}
+		for _, day := range []string{analyticsFrom, analyticsTo} {
+			if _, err := time.Parse("2006-01-02", day); day != "" && err != nil {
+				return fmt.Errorf("Invalid report date %s, expected YYYY-MM-DD", day)
+			}
+		}
+
+		repository, err := openRequiredStore()
+		if err != nil {
+			return err
+		}
+		defer repository.Close()
+
+		report, err := buildAnalyticsReport(repository, analyticsFrom, analyticsTo)
+		if err != nil {
+			return err
+		}
+
+		if analyticsOutput == "-" {
+			return writeAnalyticsReport(os.Stdout, analyticsFormat, report)
+		}
+		file, err := os.Create(analyticsOutput)
+		if err != nil {
+			return fmt.Errorf("Unable to create report file: %s", err)
+		}
+		defer file.Close()
+
+		return writeAnalyticsReport(file, analyticsFormat, report)
+	},
+}
+
+func init() {
+	analyticsReportCmd.Flags().StringVar(&analyticsFormat, "format", "text", "Report format: text, csv or json")
+	analyticsReportCmd.Flags().StringVar(&analyticsOutput, "output", "-", "Write the report to this file (- for stdout)")
+	analyticsReportCmd.Flags().StringVar(&analyticsFrom, "from", "", "First day to report on, as YYYY-MM-DD")
+	analyticsReportCmd.Flags().StringVar(&analyticsTo, "to", "", "Last day to report on, as YYYY-MM-DD")
+	rootCmd.AddCommand(analyticsReportCmd)
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"courier_service/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("analytics report", func() {
+	may1 := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	may2 := time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)
+
+	var repository store.Repository
+
+	BeforeEach(func() {
+		repository = store.NewMemoryStore()
+
+		repository.SavePackage(store.Package{ID: "PKG1", Weight: 50, Distance: 40, OfferCode: "OFR003"})
+		repository.SaveQuote(store.Quote{PackageID: "PKG1", TotalCost: 800, FinalCost: 800, QuotedAt: may1})
+		repository.SaveQuote(store.Quote{PackageID: "PKG1", TotalCost: 800, Discount: 40, FinalCost: 760, QuotedAt: may2})
+		repository.SaveOfferRedemption(store.OfferRedemption{OfferCode: "OFR003", PackageID: "PKG1", Discount: 40, RedeemedAt: may2})
+
+		repository.SavePackage(store.Package{ID: "PKG2", Weight: 30, Distance: 60, OfferCode: "OFR001"})
+		repository.SaveOfferRedemption(store.OfferRedemption{OfferCode: "OFR001", PackageID: "PKG2", Discount: 50, RedeemedAt: may1})
+		repository.SaveQuote(store.Quote{PackageID: "PKG2", CustomerID: "ACME", TotalCost: 500, ContractDiscount: 25, Discount: 25, FinalCost: 475, QuotedAt: may2})
+
+		repository.SavePackage(store.Package{ID: "PKG3", Weight: 20, Distance: 100})
+		repository.SaveQuote(store.Quote{PackageID: "PKG3", TotalCost: 700, FinalCost: 700, QuotedAt: may1})
+
+		repository.SavePackage(store.Package{ID: "PKG4", Weight: 10, Distance: 10})
+
+		state, _ := json.Marshal(PlanState{NumVehicles: 2, Trips: []Trip{
+			{VehicleID: 1, Departure: 0, Return: 4, Packages: []Package{{ID: "PKG1", DeliveryTime: 1, LatestDelivery: 2}, {ID: "PKG2", DeliveryTime: 3, LatestDelivery: 2}}},
+			{VehicleID: 2, Departure: 0, Return: 2, Packages: []Package{{ID: "PKG3", DeliveryTime: 1}, {ID: "PKG4", DeliveryTime: 1, LatestDelivery: 5}}},
+		}})
+		repository.SavePlan(store.Plan{PackageIDs: []string{"PKG1", "PKG2", "PKG3", "PKG4"}, State: state, CreatedAt: may2})
+
+		for _, status := range []string{store.StatusQuoted, store.StatusScheduled, store.StatusOutForDelivery} {
+			for _, id := range []string{"PKG1", "PKG2", "PKG4"} {
+				repository.UpdatePackageStatus(id, status, may2)
+			}
+		}
+		repository.UpdatePackageStatus("PKG1", store.StatusFailed, may2.Add(time.Hour))
+		repository.UpdatePackageStatus("PKG2", store.StatusDelivered, may2.Add(105*time.Minute))
+	})
+
+	It("should count every package once at its latest quote", func() {
+		report, err := buildAnalyticsReport(repository, "", "")
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Days).To(Equal([]DailyRevenue{
+			{Day: "2024-05-01", Packages: 1, Gross: 700, Revenue: 700},
+			{Day: "2024-05-02", Packages: 2, Gross: 1300, ContractDiscount: 25, OfferDiscount: 40, Revenue: 1235},
+		}))
+		Expect(report.Offers).To(Equal([]OfferUsage{{OfferCode: "OFR003", Uses: 1, Discount: 40}}))
+		Expect(report.Revenue).To(Equal(1935.0))
+		Expect(report.CostPerKG).To(Equal(19.35))
+		Expect(report.CostPerKM).To(Equal(9.675))
+	})
+
+	It("should report fleet utilisation and the forecast on-time rate from the plans", func() {
+		report, _ := buildAnalyticsReport(repository, "", "")
+
+		Expect(report.Plans).To(Equal(1))
+		Expect(report.FleetUtilisation).To(Equal(0.75))
+		Expect(report.PackagesWithDeadline).To(Equal(3))
+		Expect(report.ForecastOnTimePackages).To(Equal(2))
+	})
+
+	It("should base the on-time rate on actual deliveries and failures", func() {
+		report, _ := buildAnalyticsReport(repository, "", "")
+
+		Expect(report.FinishedWithDeadline).To(Equal(2))
+		Expect(report.OnTimePackages).To(Equal(1))
+		Expect(report.OnTimeRate).To(Equal(0.5))
+	})
+
+	It("should only report on the days asked for", func() {
+		report, _ := buildAnalyticsReport(repository, "2024-05-01", "2024-05-01")
+
+		Expect(report.Packages).To(Equal(1))
+		Expect(report.Offers).To(BeEmpty())
+		Expect(report.Plans).To(BeZero())
+	})
+
+	It("should write text tables, CSV and JSON", func() {
+		report, _ := buildAnalyticsReport(repository, "", "")
+		var text, csvOutput, jsonOutput bytes.Buffer
+
+		Expect(writeAnalyticsReport(&text, "text", report)).To(Succeed())
+		Expect(writeAnalyticsReport(&csvOutput, "csv", report)).To(Succeed())
+		Expect(writeAnalyticsReport(&jsonOutput, "json", report)).To(Succeed())
+
+		Expect(text.String()).To(ContainSubstring("  2024-05-02         2     1300.00       25.00       40.00     1235.00\n"))
+		Expect(text.String()).To(ContainSubstring("  OFR003             1       40.00\n"))
+		Expect(text.String()).To(ContainSubstring("On-time rate: 50.0% (1 of 2 delivered, failed or returned packages with a deadline)\n"))
+		Expect(text.String()).To(ContainSubstring("Forecast on-time rate: 66.7% (2 of 3 planned packages with a deadline)\n"))
+
+		lines := strings.Split(strings.TrimSpace(csvOutput.String()), "\n")
+		Expect(lines[0]).To(Equal("section,key,metric,value"))
+		Expect(lines).To(ContainElement("offer,OFR003,discount,40.00"))
+		Expect(lines).To(ContainElement("total,,fleet_utilisation,0.7500"))
+
+		var decoded AnalyticsReport
+		Expect(json.Unmarshal(jsonOutput.Bytes(), &decoded)).To(Succeed())
+		Expect(decoded).To(Equal(report))
+	})
+
+	It("should reject an unknown format or date", func() {
+		defer func() { analyticsFormat, analyticsFrom = "", "" }()
+
+		analyticsFormat = "xml"
+		Expect(analyticsReportCmd.RunE(nil, nil)).To(MatchError("Invalid report format xml"))
+
+		analyticsFormat, analyticsFrom = "text", "May 1"
+		Expect(analyticsReportCmd.RunE(nil, nil)).To(MatchError("Invalid report date May 1, expected YYYY-MM-DD"))
+	})
+})
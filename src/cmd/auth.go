@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"courier_service/store"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	keyIDHeader     = "X-Key-ID"
+	timestampHeader = "X-Timestamp"
+	signatureHeader = "X-Signature"
+)
+
+type contextKey string
+
+const (
+	apiKeyContextKey      contextKey = "apiKey"
+	attributionContextKey contextKey = "attribution"
+)
+
+// requestAttribution carries the key a request was made with out to the
+// request log, which sits outside authentication.
+type requestAttribution struct {
+	KeyID string
+}
+
+var (
+	requestLog = log.New(os.Stderr, "", log.LstdFlags)
+	// signatureMaxAge is how far the timestamp of a signed request may be
+	// from the server's clock before the request is refused as a replay.
+	// Within that window each signature is accepted only once.
+	signatureMaxAge = 5 * time.Minute
+	apiKeyScopes    []string
+)
+
+func generateAPISecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("Unable to generate API key: %s", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func hashAPISecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// signRequest is the HMAC-SHA256 signature of a request: method, path with
+// query, timestamp and the SHA-256 of the body, one per line. The signing
+// key is the hex SHA-256 of the secret, so that the server can check
+// signatures while only keeping that hash. The hash therefore signs as well
+// as the secret does, which is why the store file is kept private.
+func signRequest(secretHash, method, uri, timestamp string, body []byte) string {
+	bodySum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secretHash))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", method, uri, timestamp, hex.EncodeToString(bodySum[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// usedSignatures remembers the signatures accepted within signatureMaxAge of
+// their timestamp, so that a signed request cannot be sent again.
+type usedSignatures struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func newUsedSignatures() *usedSignatures {
+	return &usedSignatures{expires: make(map[string]time.Time)}
+}
+
+// use records the signature and tells whether it had not been used yet.
+// Signatures whose timestamp is past signatureMaxAge are forgotten, as their
+// requests are refused as stale anyway.
+func (u *usedSignatures) use(keyID, signature string, signedAt, now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for used, expiresAt := range u.expires {
+		if now.After(expiresAt) {
+			delete(u.expires, used)
+		}
+	}
+
+	id := keyID + "." + signature
+	if _, found := u.expires[id]; found {
+		return false
+	}
+	u.expires[id] = signedAt.Add(signatureMaxAge)
+	return true
+}
+
+// authenticateRequest finds the key a request was made with. A request
+// either carries the key itself as "Authorization: Bearer <id>.<secret>", or
+// is signed with X-Key-ID, X-Timestamp (Unix seconds) and X-Signature.
+func authenticateRequest(repository store.Repository, signatures *usedSignatures, r *http.Request, now time.Time) (store.APIKey, error) {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		id, secret, _ := strings.Cut(token, ".")
+		key, err := loadActiveAPIKey(repository, id)
+		if err != nil {
+			return key, err
+		}
+		if subtle.ConstantTimeCompare([]byte(hashAPISecret(secret)), []byte(key.SecretHash)) != 1 {
+			return store.APIKey{}, fmt.Errorf("Invalid API key")
+		}
+		return key, nil
+	}
+
+	id := r.Header.Get(keyIDHeader)
+	if id == "" {
+		return store.APIKey{}, fmt.Errorf("Missing API key")
+	}
+	key, err := loadActiveAPIKey(repository, id)
+	if err != nil {
+		return key, err
+	}
+
+	timestamp := r.Header.Get(timestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return store.APIKey{}, fmt.Errorf("Invalid request timestamp")
+	}
+	signedAt := time.Unix(seconds, 0)
+	if age := now.Sub(signedAt); age > signatureMaxAge || age < -signatureMaxAge {
+		return store.APIKey{}, fmt.Errorf("Request timestamp is too far from the server time")
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return store.APIKey{}, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	signature := r.Header.Get(signatureHeader)
+	expected := signRequest(key.SecretHash, r.Method, r.URL.RequestURI(), timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return store.APIKey{}, fmt.Errorf("Invalid request signature")
+	}
+	if !signatures.use(key.ID, signature, signedAt, now) {
+		return store.APIKey{}, fmt.Errorf("Request signature has already been used")
+	}
+	return key, nil
+}
+
+func loadActiveAPIKey(repository store.Repository, id string) (store.APIKey, error) {
+	key, err := repository.GetAPIKey(id)
+	if err != nil {
+		return store.APIKey{}, fmt.Errorf("Invalid API key")
+	}
+	if key.RevokedAt != nil {
+		return store.APIKey{}, fmt.Errorf("API key %s is revoked", id)
+	}
+	return key, nil
+}
+
+func authenticateRequests(repository store.Repository, next http.Handler) http.Handler {
+	signatures := newUsedSignatures()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := authenticateRequest(repository, signatures, r, time.Now())
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if attribution, ok := r.Context().Value(attributionContextKey).(*requestAttribution); ok {
+			attribution.KeyID = key.ID
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key)))
+	})
+}
+
+func requireScope(scope string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := r.Context().Value(apiKeyContextKey).(store.APIKey)
+		if !key.HasScope(scope) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("API key %s does not have the %s scope", key.ID, scope))
+			return
+		}
+		next(w, r)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request with its status, the key it was made with
+// and how long it took.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		attribution := &requestAttribution{KeyID: "-"}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), attributionContextKey, attribution)))
+
+		requestLog.Printf("%s %s %d key=%s %s", r.Method, r.URL.Path, recorder.status, attribution.KeyID, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+var issueKeyCmd = &cobra.Command{
+	Use:   "issueKey",
+	Short: "Issue an API key for the HTTP API",
+	Long:  `This command issues an API key with the given scopes: quote to price and track packages, plan to also plan deliveries, and admin-config for everything including the configuration. The key is printed once; only a hash of it is kept in the store. That hash is also the key signed requests are checked with, so anyone who can read the store can sign requests as any key: keep the store file readable by the server's user only.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("Usage: courier_service issueKey <name> --scopes <scopes> --store <store_file>")
+		}
+		for _, scope := range apiKeyScopes {
+			if !store.IsValidScope(scope) {
+				return fmt.Errorf("Unknown API key scope %s", scope)
+			}
+		}
+
+		repository, err := openRequiredStore()
+		if err != nil {
+			return err
+		}
+		defer repository.Close()
+
+		secret, err := generateAPISecret()
+		if err != nil {
+			return err
+		}
+		id, err := repository.SaveAPIKey(store.APIKey{Name: args[0], SecretHash: hashAPISecret(secret), Scopes: apiKeyScopes, CreatedAt: time.Now()})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("API key %s (%s) issued with scopes %s\n", id, args[0], strings.Join(apiKeyScopes, ", "))
+		fmt.Printf("Key: %s.%s\n", id, secret)
+		fmt.Println("Keep the key safe; it cannot be shown again.")
+		return nil
+	},
+}
+
+var revokeKeyCmd = &cobra.Command{
+	Use:   "revokeKey",
+	Short: "Revoke an API key",
+	Long:  `This command revokes an API key so that requests made with it are refused. The key stays in the store so that past requests can still be attributed to it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("Usage: courier_service revokeKey <keyID> --store <store_file>")
+		}
+
+		repository, err := openRequiredStore()
+		if err != nil {
+			return err
+		}
+		defer repository.Close()
+
+		key, err := repository.GetAPIKey(args[0])
+		if err == store.ErrNotFound {
+			return fmt.Errorf("API key %s not found", args[0])
+		}
+		if err != nil {
+			return err
+		}
+		if key.RevokedAt != nil {
+			return fmt.Errorf("API key %s is already revoked", key.ID)
+		}
+
+		revokedAt := time.Now()
+		key.RevokedAt = &revokedAt
+		if _, err := repository.SaveAPIKey(key); err != nil {
+			return err
+		}
+
+		fmt.Printf("API key %s (%s) revoked\n", key.ID, key.Name)
+		return nil
+	},
+}
+
+func init() {
+	issueKeyCmd.Flags().StringSliceVar(&apiKeyScopes, "scopes", []string{store.ScopeQuote}, "Scopes of the key: quote, plan and/or admin-config")
+	rootCmd.AddCommand(issueKeyCmd)
+	rootCmd.AddCommand(revokeKeyCmd)
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"courier_service/config"
+	"courier_service/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API authentication", func() {
+	var (
+		repository store.Repository
+		handler    http.Handler
+		jobs       *jobQueue
+		logOutput  bytes.Buffer
+		original   *log.Logger
+	)
+	secretHash := hashAPISecret("secret")
+
+	BeforeEach(func() {
+		repository = store.NewMemoryStore()
+		repository.SavePackage(store.Package{ID: "PKG1", Weight: 50, Distance: 30})
+		repository.SaveAPIKey(store.APIKey{Name: "partner", SecretHash: secretHash, Scopes: []string{store.ScopeQuote}})
+		jobs = newJobQueue(config.JobSettings{Workers: 1, QueueSize: 4})
+		handler = newAPIHandler(repository, jobs)
+
+		original = requestLog
+		logOutput.Reset()
+		requestLog = log.New(&logOutput, "", 0)
+	})
+
+	AfterEach(func() {
+		requestLog = original
+		jobs.Close()
+	})
+
+	serve := func(request *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	signed := func(method, path, body string, at time.Time) *http.Request {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		request.Header.Set(keyIDHeader, "KEY-1")
+		request.Header.Set(timestampHeader, timestamp)
+		request.Header.Set(signatureHeader, signRequest(secretHash, method, path, timestamp, []byte(body)))
+		return request
+	}
+
+	It("should accept a bearer key and attribute the request to it", func() {
+		request := httptest.NewRequest(http.MethodGet, "/v1/packages/PKG1/track", nil)
+		request.Header.Set("Authorization", "Bearer KEY-1.secret")
+
+		Expect(serve(request).Code).To(Equal(http.StatusOK))
+		Expect(logOutput.String()).To(HavePrefix("GET /v1/packages/PKG1/track 200 key=KEY-1 "))
+	})
+
+	It("should accept a signed request", func() {
+		Expect(serve(signed(http.MethodGet, "/v1/packages/PKG1/track", "", time.Now())).Code).To(Equal(http.StatusOK))
+	})
+
+	It("should refuse a request without a valid key", func() {
+		recorder := serve(httptest.NewRequest(http.MethodGet, "/v1/packages/PKG1/track", nil))
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"error":"Missing API key"}`))
+		Expect(logOutput.String()).To(HavePrefix("GET /v1/packages/PKG1/track 401 key=- "))
+
+		request := httptest.NewRequest(http.MethodGet, "/v1/packages/PKG1/track", nil)
+		request.Header.Set("Authorization", "Bearer KEY-1.guess")
+		Expect(serve(request).Body.String()).To(MatchJSON(`{"error":"Invalid API key"}`))
+	})
+
+	It("should refuse a tampered or stale signature", func() {
+		request := signed(http.MethodGet, "/v1/packages/PKG1/track", "", time.Now())
+		request.URL.Path = "/v1/config"
+		Expect(serve(request).Body.String()).To(MatchJSON(`{"error":"Invalid request signature"}`))
+
+		recorder := serve(signed(http.MethodGet, "/v1/packages/PKG1/track", "", time.Now().Add(-10*time.Minute)))
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"error":"Request timestamp is too far from the server time"}`))
+	})
+
+	It("should refuse a signed request sent twice", func() {
+		at := time.Now()
+		Expect(serve(signed(http.MethodGet, "/v1/packages/PKG1/track", "", at)).Code).To(Equal(http.StatusOK))
+
+		recorder := serve(signed(http.MethodGet, "/v1/packages/PKG1/track", "", at))
+
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"error":"Request signature has already been used"}`))
+		Expect(serve(signed(http.MethodGet, "/v1/packages/PKG1/track", "", at.Add(time.Second))).Code).To(Equal(http.StatusOK))
+	})
+
+	It("should forget signatures once they are too old to be accepted", func() {
+		signatures := newUsedSignatures()
+		at := time.Now()
+
+		Expect(signatures.use("KEY-1", "abc", at, at)).To(BeTrue())
+		Expect(signatures.use("KEY-1", "abc", at, at.Add(time.Minute))).To(BeFalse())
+		Expect(signatures.use("KEY-2", "abc", at, at.Add(time.Minute))).To(BeTrue())
+		Expect(signatures.use("KEY-1", "abc", at, at.Add(signatureMaxAge+time.Second))).To(BeTrue())
+	})
+
+	It("should refuse endpoints outside the key's scopes", func() {
+		recorder := serve(signed(http.MethodGet, "/v1/config", "", time.Now()))
+
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"error":"API key KEY-1 does not have the admin-config scope"}`))
+	})
+
+	It("should refuse a revoked key", func() {
+		key, _ := repository.GetAPIKey("KEY-1")
+		revokedAt := time.Now()
+		key.RevokedAt = &revokedAt
+		repository.SaveAPIKey(key)
+
+		recorder := serve(signed(http.MethodGet, "/v1/packages/PKG1/track", "", time.Now()))
+
+		Expect(recorder.Body.String()).To(MatchJSON(`{"error":"API key KEY-1 is revoked"}`))
+	})
+
+	It("should follow keys issued and revoked in the store while it runs", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "store.jsonl")
+		serving, _ := store.NewFileStore(path)
+		defer serving.Close()
+		serving.SavePackage(store.Package{ID: "PKG1", Weight: 50, Distance: 30})
+		handler = newAPIHandler(serving, jobs)
+
+		other, _ := store.NewFileStore(path)
+		defer other.Close()
+		other.SaveAPIKey(store.APIKey{Name: "partner", SecretHash: secretHash, Scopes: []string{store.ScopeQuote}})
+		Expect(serve(signed(http.MethodGet, "/v1/packages/PKG1/track", "", time.Now())).Code).To(Equal(http.StatusOK))
+
+		key, _ := other.GetAPIKey("KEY-1")
+		revokedAt := time.Now()
+		key.RevokedAt = &revokedAt
+		other.SaveAPIKey(key)
+		recorder := serve(signed(http.MethodGet, "/v1/packages/PKG1/track", "", time.Now().Add(time.Second)))
+
+		Expect(recorder.Body.String()).To(MatchJSON(`{"error":"API key KEY-1 is revoked"}`))
+	})
+
+	Describe("issueKey and revokeKey", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			storePath = filepath.Join(GinkgoT().TempDir(), "store.jsonl")
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			storePath, apiKeyScopes = "", nil
+		})
+
+		It("should print the key once and keep only its hash", func() {
+			apiKeyScopes = []string{store.ScopePlan}
+
+			Expect(issueKeyCmd.RunE(nil, []string{"partner"})).To(Succeed())
+			Expect(revokeKeyCmd.RunE(nil, []string{"KEY-1"})).To(Succeed())
+
+			w.Close()
+			output.ReadFrom(r)
+			Expect(output.String()).To(HavePrefix("API key KEY-1 (partner) issued with scopes plan\nKey: KEY-1."))
+			Expect(output.String()).To(HaveSuffix("API key KEY-1 (partner) revoked\n"))
+
+			secret := strings.TrimPrefix(strings.Split(output.String(), "\n")[1], "Key: KEY-1.")
+			content, _ := os.ReadFile(storePath)
+			Expect(string(content)).ToNot(ContainSubstring(secret))
+			Expect(string(content)).To(ContainSubstring(hashAPISecret(secret)))
+		})
+
+		It("should reject unknown scopes and keys", func() {
+			apiKeyScopes = []string{"delete"}
+			Expect(issueKeyCmd.RunE(nil, []string{"partner"})).To(MatchError("Unknown API key scope delete"))
+
+			Expect(revokeKeyCmd.RunE(nil, []string{"KEY-9"})).To(MatchError("API key KEY-9 not found"))
+		})
+	})
+})
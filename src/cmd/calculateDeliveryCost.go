@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"courier_service/config"
+	"courier_service/store"
 
 	"github.com/spf13/cobra"
 )
@@ -14,22 +16,25 @@ func calculateDeliveryCost(baseDeliveryCost, weight, distance int, offerCode str
 	weightCost := float64(weight * config.GetWeightCostPerKG())
 	distanceCost := float64(distance * config.GetDistanceCostPerKM())
 	totalCost := float64(baseDeliveryCost) + weightCost + distanceCost
-	discount := 0.0
-	discountReason := "Offer not applicable as criteria not met"
+	discount, discountReason := getOfferDiscount(totalCost, weight, distance, offerCode, offers)
 
+	// fmt.Println(totalCost, weightCost, distanceCost, discount, discountReason)
+
+	return totalCost, weightCost, distanceCost, discount, discountReason
+}
+
+// getOfferDiscount returns what the offer takes off the price if the package
+// meets its criteria, and the reason shown next to the discount.
+func getOfferDiscount(price float64, weight, distance int, offerCode string, offers []config.Offer) (float64, string) {
 	for _, offer := range offers {
 		if offer.Code == offerCode {
 			if distance >= offer.MinDistance && distance <= offer.MaxDistance && weight >= offer.MinWeight && weight <= offer.MaxWeight {
-				discount = totalCost * offer.Discount
-				discountReason = fmt.Sprintf("Discount of %.0f%% applied", offer.Discount*100)
+				return price * offer.Discount, fmt.Sprintf("Discount of %.0f%% applied", offer.Discount*100)
 			}
 			break
 		}
 	}
-
-	// fmt.Println(totalCost, weightCost, distanceCost, discount, discountReason)
-
-	return totalCost, weightCost, distanceCost, discount, discountReason
+	return 0, "Offer not applicable as criteria not met"
 }
 
 var calculateCmd = &cobra.Command{
@@ -54,9 +59,42 @@ var calculateCmd = &cobra.Command{
 
 		offers := config.GetOffers()
 
+		repository, err := openStore()
+		if err != nil {
+			return err
+		}
+		if repository != nil {
+			defer repository.Close()
+		}
+
+		var customer *store.Customer
+		if customerID != "" {
+			if repository == nil {
+				return fmt.Errorf("The --store flag is required")
+			}
+			contract, err := loadCustomer(repository, customerID)
+			if err != nil {
+				return err
+			}
+			customer = &contract
+		}
+
+		var network *RoadNetwork
+		var depot string
+		if roadNetworkPath != "" {
+			network, err = loadRoadNetwork(roadNetworkPath)
+			if err != nil {
+				return err
+			}
+			depot, err = resolveRoadNodes(network, nil, depotNode, depotLocation)
+			if err != nil {
+				return err
+			}
+		}
+
 		for i := 0; i < numPackages; i++ {
 			packageDetails := strings.Fields(args[2+i])
-			if len(packageDetails) != 4 {
+			if len(packageDetails) < 4 || !areValidPackageOptions(packageDetails[4:]) {
 				return fmt.Errorf("Invalid package details for package %d\n", i+1)
 			}
 
@@ -72,21 +110,73 @@ var calculateCmd = &cobra.Command{
 
 			offerCode := packageDetails[3]
 
-			totalCost, weightCost, distanceCost, discount, discountReason := calculateDeliveryCost(baseDeliveryCost, weight, distance, offerCode, offers)
+			pkg := Package{ID: packageDetails[0], Weight: weight, Distance: distance, OfferCode: offerCode}
+			if err := parsePackageOptions(&pkg, packageDetails[4:], i+1); err != nil {
+				return err
+			}
+			serviceLevel := getServiceLevel(pkg)
+
+			if network != nil {
+				if err := resolvePackageRoadNode(network, &pkg, depot); err != nil {
+					return err
+				}
+				if roadDistance, found := getRoadDistance(network, depot, pkg); found {
+					distance = roadDistance
+				}
+			}
+
+			var totalCost, weightCost, distanceCost, contractDiscount, discount float64
+			var discountReason string
+			if customer != nil {
+				price := calculateContractDeliveryCost(baseDeliveryCost, weight, distance, offerCode, offers, *customer)
+				totalCost, weightCost, distanceCost, discount, discountReason = price.TotalCost, price.WeightCost, price.DistanceCost, price.OfferDiscount, price.DiscountReason
+				contractDiscount, offerCode = price.ContractDiscount, price.OfferCode
+			} else {
+				totalCost, weightCost, distanceCost, discount, discountReason = calculateDeliveryCost(baseDeliveryCost, weight, distance, offerCode, offers)
+			}
+			totalCost, discount, surcharge := applyServiceLevel(totalCost, discount, serviceLevel)
+			_, contractDiscount, _ = applyServiceLevel(0, contractDiscount, serviceLevel)
+
+			finalCost := totalCost - contractDiscount - discount
+			if customer != nil {
+				if err := checkCreditLimit(repository, *customer, pkg.ID, finalCost); err != nil {
+					return err
+				}
+			}
 
-			finalCost := totalCost - discount
 			fmt.Printf("\nPackage %s\n", packageDetails[0])
+			if customer != nil {
+				fmt.Printf("Customer: %s\n", customer.ID)
+			}
 			fmt.Printf("Base Delivery Cost: %d\n", baseDeliveryCost)
 			fmt.Printf("Weight: %d kg | Distance: %d km\n", weight, distance)
 			fmt.Printf("Offer code: %s\n", offerCode)
+			if serviceLevel != ServiceLevelStandard {
+				fmt.Printf("Service level: %s\n", serviceLevel)
+			}
 			fmt.Printf("Discount: %.2f (%s)\n", discount, discountReason)
 			fmt.Printf("Breakdown:\n")
 			fmt.Printf("  Base Delivery Cost: %.2f\n", float64(baseDeliveryCost))
 			fmt.Printf("  Weight Cost: %.2f\n", weightCost)
 			fmt.Printf("  Distance Cost: %.2f\n", distanceCost)
+			if serviceLevel != ServiceLevelStandard {
+				fmt.Printf("  Service Surcharge: %.2f\n", surcharge)
+			}
+			if contractDiscount > 0 {
+				fmt.Printf("  Contract Discount: -%.2f\n", contractDiscount)
+			}
 			fmt.Printf("  Discount: -%.2f\n", discount)
 			fmt.Printf("Total Delivery Cost: %.2f\n", finalCost)
 
+			if repository != nil {
+				pkg.Distance, pkg.OfferCode, pkg.TotalCost, pkg.ContractDiscount, pkg.Discount, pkg.FinalCost = distance, offerCode, totalCost, contractDiscount, contractDiscount+discount, finalCost
+				if customer != nil {
+					pkg.CustomerID = customer.ID
+				}
+				if err := recordQuote(repository, pkg, baseDeliveryCost, time.Now()); err != nil {
+					return err
+				}
+			}
 		}
 
 		return nil
@@ -94,5 +184,9 @@ var calculateCmd = &cobra.Command{
 }
 
 func init() {
+	calculateCmd.Flags().StringVar(&roadNetworkPath, "road-network", "", "Road graph (.csv or .geojson) used to price by road distance")
+	calculateCmd.Flags().StringVar(&depotLocation, "depot", "", "Depot coordinates as lat,lon")
+	calculateCmd.Flags().StringVar(&customerID, "customer", "", "Price the packages under this customer's contract; needs --store")
+	calculateCmd.Flags().StringVar(&depotNode, "depot-node", "", "Road network node of the depot; defaults to the node nearest --depot")
 	rootCmd.AddCommand(calculateCmd)
 }
@@ -1,51 +1,132 @@
 package cmd
 
 import (
+	"context"
 	"courier_service/config"
 	"fmt"
 	"math"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 type Package struct {
-	ID           string
-	Weight       int
-	Distance     int
-	OfferCode    string
-	TotalCost    float64
-	Discount     float64
-	FinalCost    float64
-	DeliveryTime float64
+	ID               string    `json:"id"`
+	Weight           int       `json:"weight"`
+	Volume           float64   `json:"volume,omitempty"`
+	Distance         int       `json:"distance"`
+	OfferCode        string    `json:"offerCode"`
+	TotalCost        float64   `json:"totalCost"`
+	Discount         float64   `json:"discount"`
+	FinalCost        float64   `json:"finalCost"`
+	DeliveryTime     float64   `json:"deliveryTime"`
+	EarliestDelivery float64   `json:"earliestDelivery,omitempty"`
+	LatestDelivery   float64   `json:"latestDelivery,omitempty"`
+	ServiceLevel     string    `json:"serviceLevel,omitempty"`
+	Location         *GeoPoint `json:"location,omitempty"`
+	RoadNode         string    `json:"roadNode,omitempty"`
+	DepotID          string    `json:"depotId,omitempty"`
+	CustomerID       string    `json:"customerId,omitempty"`
+	ContractDiscount float64   `json:"contractDiscount,omitempty"`
+	Status           string    `json:"status,omitempty"`
+	Attempts         int       `json:"attempts,omitempty"`
+	ReattemptFee     float64   `json:"reattemptFee,omitempty"`
 }
 
+// Vehicle is a truck in the fleet. It may only be out of the depot between
+// ShiftStart and ShiftEnd (hours from the start of the plan, a zero ShiftEnd
+// meaning no end), no trip may overlap one of its Maintenance slots, and once
+// broken down it finishes no trip after BrokenDownAt.
 type Vehicle struct {
-	ID               int
-	AssignedPackages []string
+	ID               int          `json:"id"`
+	ShiftStart       float64      `json:"shiftStart"`
+	ShiftEnd         float64      `json:"shiftEnd"`
+	Maintenance      []TimeWindow `json:"maintenance"`
+	Capacity         Capacity     `json:"capacity"`
+	BrokenDown       bool         `json:"-"`
+	BrokenDownAt     float64      `json:"-"`
+	AssignedPackages []string     `json:"-"`
 }
 
-func getShipmentsSubSetsWhichFallsUnderMaxCarriable(packageList []Package, maxCarriableCapacity int) [][]int {
+// SchedulerOptions carries the optional constraints calculateDeliveryTime
+// applies on top of the basic weight and speed limits. Vehicles lists the
+// availability of the vehicles that are not free all day, ReadyAt is the
+// earliest time any trip may leave and BusyUntil holds the return time of
+// vehicles still out on a trip that is already under way.
+type SchedulerOptions struct {
+	Calendar     *DispatchCalendar
+	Depot        *GeoPoint
+	Roads        *RoadNetwork
+	DepotNode    string
+	ServiceTimes config.ServiceTimes
+	Vehicles     []Vehicle
+	Breakdowns   []Breakdown
+	MaxVolume    float64
+	MaxPackages  int
+	ReadyAt      float64
+	BusyUntil    map[int]float64
+	Explanation  *PlanExplanation
+	Optimiser    *PlanOptimiser
+}
+
+type Trip struct {
+	DepotID   string    `json:"depotId,omitempty"`
+	VehicleID int       `json:"vehicleId"`
+	Departure float64   `json:"departure"`
+	Return    float64   `json:"return"`
+	Distance  float64   `json:"distance"`
+	Packages  []Package `json:"packages"`
+}
+
+func getShipmentsSubSetsWhichFallsUnderMaxCarriable(ctx context.Context, packageList []Package, maxCarriableCapacity Capacity, explanation *PlanExplanation) [][]int {
+	return getShipmentsSubSetsIncludingPackages(ctx, packageList, maxCarriableCapacity, 0, explanation)
+}
+
+// getShipmentsSubSetsIncludingPackages returns the best scoring subsets that fit
+// every dimension of the capacity and contain every package whose bit is set
+// in requiredMask. Without service levels the best subsets are simply the
+// heaviest. Once ctx is done the search stops and returns the best subsets
+// seen so far. Every subset that fits is also handed to the explanation.
+func getShipmentsSubSetsIncludingPackages(ctx context.Context, packageList []Package, maxCarriableCapacity Capacity, requiredMask int, explanation *PlanExplanation) [][]int {
+	explanation.startShipmentSearch(packageList, requiredMask)
 
 	var possiblePackages [][]int
-	localHighestSum := 0
+	var highestScore []int
 
 	for i := 1; i < (1 << len(packageList)); i++ {
+		if i%subsetSearchCheckInterval == 0 && ctx.Err() != nil {
+			break
+		}
+		if i&requiredMask != requiredMask {
+			continue
+		}
+
 		var subset []int
 		subsetWeight := 0
+		subsetVolume := 0.0
 
 		for j := 0; j < len(packageList); j++ {
 			if i&(1<<j) != 0 {
 				subsetWeight += packageList[j].Weight
+				subsetVolume += packageList[j].Volume
 				subset = append(subset, j)
 			}
 		}
 
-		if subsetWeight <= maxCarriableCapacity && subsetWeight >= localHighestSum {
-			if subsetWeight > localHighestSum {
+		if !maxCarriableCapacity.fits(subsetWeight, subsetVolume, len(subset)) {
+			continue
+		}
+		explanation.recordCandidate(subset, packageList)
+
+		score := getShipmentScore(subset, packageList)
+		comparison := compareShipmentScores(score, highestScore)
+		if comparison >= 0 {
+			if comparison > 0 {
 				possiblePackages = nil
-				localHighestSum = subsetWeight
+				highestScore = score
 			}
 			possiblePackages = append(possiblePackages, subset)
 		}
@@ -54,125 +135,168 @@ func getShipmentsSubSetsWhichFallsUnderMaxCarriable(packageList []Package, maxCa
 	return possiblePackages
 }
 
+// getShipmentWithLessDistanceAmongPossibleSubsets picks among the equally
+// scored candidates: more packages first, then the shorter farthest distance,
+// then the alphabetically first package IDs, so the choice does not depend on
+// the order the packages were given in.
 func getShipmentWithLessDistanceAmongPossibleSubsets(possibleShipmentList [][]int, packageList []Package) []int {
-	if len(possibleShipmentList) == 1 {
-		return possibleShipmentList[0]
-	}
-
-	var distanceList []int
-
-	for _, element := range possibleShipmentList {
-		maxDistance := 0
-		for _, idx := range element {
-			if packageList[idx].Distance > maxDistance {
-				maxDistance = packageList[idx].Distance
-			}
-		}
-		distanceList = append(distanceList, maxDistance)
-	}
-
-	minDistance := math.MaxInt32
-	var closestShipment []int
+	closestShipment := possibleShipmentList[0]
+	closestKey := getShipmentKey(closestShipment, packageList)
 
-	for i, distance := range distanceList {
-		if distance < minDistance {
-			minDistance = distance
-			closestShipment = possibleShipmentList[i]
+	for _, shipment := range possibleShipmentList[1:] {
+		key := getShipmentKey(shipment, packageList)
+		if comparison, _ := compareShipmentKeys(key, closestKey); comparison > 0 {
+			closestShipment, closestKey = shipment, key
 		}
 	}
 
 	return closestShipment
 }
 
-func calculateDeliveryTime(packages []Package, numVehicles, maxSpeed, maxWeight int, baseDeliveryCost int) {
-	vehicleAvailabilityArray, vehicleList := initializeVehicles(numVehicles)
-	newUpdatedPackageList := copyPackages(packages)
+// calculateDeliveryTime plans the trips for the packages and returns them along
+// with the packages no vehicle can deliver within its availability. Once ctx
+// is done no further trips are planned; the packages not yet on a trip are
+// returned as unscheduled, and the caller tells a cut-short plan by ctx.Err().
+func calculateDeliveryTime(ctx context.Context, packages []Package, numVehicles, maxSpeed, maxWeight int, baseDeliveryCost int, options SchedulerOptions) ([]Trip, []Package) {
+	vehicleAvailabilityArray, vehicleList := initializeVehicles(numVehicles, getCapacity(maxWeight, options), options)
+	var newUpdatedPackageList []Package
+	var trips []Trip
+	var unscheduled []Package
+
+	for _, pkg := range packages {
+		if isSchedulable(pkg) && fitsAnyVehicle(vehicleList, getShipmentLoad([]int{0}, []Package{pkg})) {
+			newUpdatedPackageList = append(newUpdatedPackageList, pkg)
+		} else {
+			unscheduled = append(unscheduled, pkg)
+		}
+	}
 
 	for len(newUpdatedPackageList) > 0 {
-		possibleShipmentList := getShipmentsSubSetsWhichFallsUnderMaxCarriable(newUpdatedPackageList, maxWeight)
+		if ctx.Err() != nil {
+			unscheduled = append(unscheduled, newUpdatedPackageList...)
+			break
+		}
+		var possibleShipmentList [][]int
+		for _, capacity := range getCapacitiesByDeparture(vehicleList, vehicleAvailabilityArray, options.Calendar) {
+			possibleShipmentList = getShipmentsSubSetsForUrgentPackage(ctx, newUpdatedPackageList, capacity, options.Explanation)
+			if len(possibleShipmentList) == 0 {
+				possibleShipmentList = getShipmentsSubSetsWhichFallsUnderMaxCarriable(ctx, newUpdatedPackageList, capacity, options.Explanation)
+			}
+			if len(possibleShipmentList) > 0 {
+				break
+			}
+		}
+		if len(possibleShipmentList) == 0 {
+			unscheduled = append(unscheduled, newUpdatedPackageList...)
+			break
+		}
 		nextDelivery := getShipmentWithLessDistanceAmongPossibleSubsets(possibleShipmentList, newUpdatedPackageList)
-		processNextDelivery(nextDelivery, newUpdatedPackageList, vehicleAvailabilityArray, vehicleList, maxSpeed)
-		newUpdatedPackageList = filterRemainingPackages(newUpdatedPackageList)
+		options.Explanation.recordShipmentChoice(newUpdatedPackageList, nextDelivery)
+		if trip, scheduled := processNextDelivery(nextDelivery, newUpdatedPackageList, vehicleAvailabilityArray, vehicleList, maxSpeed, options); scheduled {
+			options.Explanation.recordTrip(trip)
+			trips = append(trips, trip)
+		} else {
+			// No vehicle can fit the whole shipment into its availability, so
+			// try to send its packages one at a time instead.
+			for _, idx := range nextDelivery {
+				if trip, scheduled := processNextDelivery([]int{idx}, newUpdatedPackageList, vehicleAvailabilityArray, vehicleList, maxSpeed, options); scheduled {
+					trips = append(trips, trip)
+				} else {
+					unscheduled = append(unscheduled, newUpdatedPackageList[idx])
+				}
+			}
+		}
+		newUpdatedPackageList = filterRemainingPackages(newUpdatedPackageList, nextDelivery)
 	}
+
+	return trips, unscheduled
 }
 
-func initializeVehicles(numVehicles int) ([]float64, []Vehicle) {
+// initializeVehicles sets up the fleet, each vehicle with its own capacity or
+// the default one.
+func initializeVehicles(numVehicles int, capacity Capacity, options SchedulerOptions) ([]float64, []Vehicle) {
 	vehicleAvailabilityArray := make([]float64, numVehicles)
 	vehicleList := make([]Vehicle, numVehicles)
 	for i := range vehicleAvailabilityArray {
-		vehicleAvailabilityArray[i] = 0
-		vehicleList[i] = Vehicle{ID: i + 1}
+		vehicleList[i] = getVehicleAvailability(i+1, options)
+		vehicleList[i].Capacity = vehicleList[i].Capacity.withDefaults(capacity)
+		vehicleAvailabilityArray[i] = math.Max(vehicleList[i].ShiftStart, math.Max(options.ReadyAt, options.BusyUntil[i+1]))
 	}
 	return vehicleAvailabilityArray, vehicleList
 }
 
-func copyPackages(packages []Package) []Package {
-	var newUpdatedPackageList []Package
-	for _, pkg := range packages {
-		newUpdatedPackageList = append(newUpdatedPackageList, pkg)
-	}
-	return newUpdatedPackageList
-}
-
-func getEarliestAvailableVehicle(vehicleAvailabilityArray []float64) float64 {
-	nextAvailableAt := math.MaxFloat64
-	for _, availability := range vehicleAvailabilityArray {
-		if availability < nextAvailableAt {
-			nextAvailableAt = availability
-		}
+func assignPackagesToVehicle(vehicleList []Vehicle, vehicleAvailabilityArray []float64, vehicleIdx int, departureAt float64, route TripRoute, newUpdatedPackageList []Package) Trip {
+	trip := Trip{VehicleID: vehicleList[vehicleIdx].ID, Departure: departureAt, Return: departureAt + route.Duration, Distance: route.Distance}
+	for stop, idx := range route.Stops {
+		currentPackage := &newUpdatedPackageList[idx]
+		currentPackage.DeliveryTime = departureAt + route.ArrivalTimes[stop]
+		vehicleList[vehicleIdx].AssignedPackages = append(vehicleList[vehicleIdx].AssignedPackages, currentPackage.ID)
+		trip.Packages = append(trip.Packages, *currentPackage)
 	}
-	return nextAvailableAt
+	vehicleAvailabilityArray[vehicleIdx] = trip.Return
+	return trip
 }
 
-func assignPackagesToVehicle(vehicleList []Vehicle, vehicleAvailabilityArray []float64, nextAvailableAt float64, durationForSingleTrip float64, nextDelivery []int, newUpdatedPackageList []Package, maxSpeed int) {
-	var vehicleID int
-	for _, idx := range nextDelivery {
-		currentPackage := &newUpdatedPackageList[idx]
-		currentPackage.DeliveryTime = nextAvailableAt + (float64(currentPackage.Distance) / float64(maxSpeed))
-		for i := range vehicleList {
-			if vehicleAvailabilityArray[i] == nextAvailableAt {
-				vehicleList[i].AssignedPackages = append(vehicleList[i].AssignedPackages, currentPackage.ID)
-				vehicleID = i + 1
-				break
-			}
+// printTripDetails prints every package of every trip, each trip followed by
+// how full its vehicle is and which capacity dimension binds.
+func printTripDetails(trips []Trip, fleet FleetCapacity, calendar *DispatchCalendar) {
+	for _, trip := range trips {
+		for i := range trip.Packages {
+			printPackageDetails(&trip.Packages[i], trip.VehicleID, trip.Departure, calendar)
 		}
-		printPackageDetails(currentPackage, vehicleID)
+		load, constraint := fleet.getVehicleCapacity(trip.VehicleID).getTripLoad(trip)
+		fmt.Printf("Trip: Vehicle %d, load %.0f%% by %s\n\n", trip.VehicleID, load, constraint)
 	}
-	updateVehicleAvailability(vehicleAvailabilityArray, nextAvailableAt, durationForSingleTrip)
 }
 
-func printPackageDetails(pkg *Package, vehicleID int) {
+func printPackageDetails(pkg *Package, vehicleID int, departureAt float64, calendar *DispatchCalendar) {
 	fmt.Printf("Package: %s\n", pkg.ID)
 	fmt.Printf("  Vehicle: %d\n", vehicleID)
+	if getServiceLevel(*pkg) != ServiceLevelStandard {
+		fmt.Printf("  Service Level: %s\n", pkg.ServiceLevel)
+	}
+	if pkg.Attempts > 0 {
+		fmt.Printf("  Delivery Attempt: %d\n", pkg.Attempts+1)
+		fmt.Printf("  Re-attempt Fee: %.2f\n", pkg.ReattemptFee)
+	}
 	fmt.Printf("  Discount: %.2f\n", pkg.Discount)
 	fmt.Printf("  Total Cost: %.2f\n", pkg.TotalCost)
 	fmt.Printf("  Delivery Time: %.2f hours\n", pkg.DeliveryTime)
+	if calendar != nil {
+		fmt.Printf("  Departure: %s\n", calendar.formatClock(departureAt))
+		fmt.Printf("  ETA: %s\n", calendar.formatClock(pkg.DeliveryTime))
+	}
 	fmt.Println()
 }
 
-func updateVehicleAvailability(vehicleAvailabilityArray []float64, nextAvailableAt float64, durationForSingleTrip float64) {
-	for i, availability := range vehicleAvailabilityArray {
-		if availability == nextAvailableAt {
-			vehicleAvailabilityArray[i] = nextAvailableAt + 2*durationForSingleTrip
-			break
-		}
+func filterRemainingPackages(newUpdatedPackageList []Package, nextDelivery []int) []Package {
+	shipped := make(map[int]bool)
+	for _, idx := range nextDelivery {
+		shipped[idx] = true
 	}
-}
 
-func filterRemainingPackages(newUpdatedPackageList []Package) []Package {
 	var remainingPackages []Package
-	for _, pkg := range newUpdatedPackageList {
-		if pkg.DeliveryTime == 0 {
+	for i, pkg := range newUpdatedPackageList {
+		if !shipped[i] {
 			remainingPackages = append(remainingPackages, pkg)
 		}
 	}
 	return remainingPackages
 }
 
-func processNextDelivery(nextDelivery []int, newUpdatedPackageList []Package, vehicleAvailabilityArray []float64, vehicleList []Vehicle, maxSpeed int) {
-	nextAvailableAt := getEarliestAvailableVehicle(vehicleAvailabilityArray)
-	durationForSingleTrip := calculateDurationForSingleTrip(nextDelivery, newUpdatedPackageList, maxSpeed)
-	assignPackagesToVehicle(vehicleList, vehicleAvailabilityArray, nextAvailableAt, durationForSingleTrip, nextDelivery, newUpdatedPackageList, maxSpeed)
+// processNextDelivery sends the shipment with the vehicle that can leave
+// first among those big enough for it, and reports false when no vehicle can
+// fit the trip in.
+func processNextDelivery(nextDelivery []int, newUpdatedPackageList []Package, vehicleAvailabilityArray []float64, vehicleList []Vehicle, maxSpeed int, options SchedulerOptions) (Trip, bool) {
+	route := applyServiceTimes(planTripRoute(nextDelivery, newUpdatedPackageList, maxSpeed, options), newUpdatedPackageList, options.ServiceTimes)
+	readyAt := getEarliestDepartureForWindows(route, newUpdatedPackageList)
+	load := getShipmentLoad(nextDelivery, newUpdatedPackageList)
+	options.Explanation.recordVehicleChoice(vehicleList, vehicleAvailabilityArray, load, readyAt, route.Duration, options.Calendar)
+	vehicleIdx, departureAt, found := getFirstVehicleToDepart(vehicleList, vehicleAvailabilityArray, load, readyAt, route.Duration, options.Calendar)
+	if !found {
+		return Trip{}, false
+	}
+	return assignPackagesToVehicle(vehicleList, vehicleAvailabilityArray, vehicleIdx, departureAt, route, newUpdatedPackageList), true
 }
 
 func calculateDurationForSingleTrip(nextDelivery []int, newUpdatedPackageList []Package, maxSpeed int) float64 {
@@ -224,19 +348,230 @@ var calculateTimeAndCostCmd = &cobra.Command{
 			return fmt.Errorf("Invalid vehicle capacity")
 		}
 
-		calculateDeliveryTime(packages, numVehicles, maxSpeed, maxLoadCapacity, baseDeliveryCost)
+		calendar, err := parseDispatchCalendar(dispatchStart, dispatchTimezone, depotHours, driverShiftEnd)
+		if err != nil {
+			return err
+		}
+
+		if savePlanPath != "" && (depotsFilePath != "" || roadNetworkPath != "" || calendar != nil) {
+			return fmt.Errorf("--save-plan cannot be combined with --depots, --road-network or --start")
+		}
+
+		if maxVehicleVolume < 0 || maxVehiclePackages < 0 {
+			return fmt.Errorf("Invalid vehicle capacity")
+		}
+
+		repository, err := openStore()
+		if err != nil {
+			return err
+		}
+		if repository != nil {
+			defer repository.Close()
+			packages, err = addReattempts(repository, packages, baseDeliveryCost)
+			if err != nil {
+				return err
+			}
+			printReattempts(packages)
+		}
+
+		options := SchedulerOptions{Calendar: calendar, ServiceTimes: config.GetServiceTimes(), MaxVolume: maxVehicleVolume, MaxPackages: maxVehiclePackages}
+		if explainPlan {
+			options.Explanation = &PlanExplanation{}
+		}
+		if optimisePlan {
+			if optimiseBudget <= 0 {
+				return fmt.Errorf("Invalid optimiser time budget")
+			}
+			options.Optimiser = &PlanOptimiser{Budget: optimiseBudget}
+		}
+		if vehicleAvailabilityPath != "" {
+			options.Vehicles, err = loadVehicleAvailability(vehicleAvailabilityPath)
+			if err != nil {
+				return err
+			}
+		}
+		options.Breakdowns, err = parseBreakdowns(breakdownSpecs)
+		if err != nil {
+			return err
+		}
+		fleetSize, err := getFleetSize(numVehicles)
+		if err != nil {
+			return err
+		}
+		if err := checkFleetVehicles(fleetSize, options); err != nil {
+			return err
+		}
+
+		ctx, cancel, err := newPlanContext(planTimeout)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		var plans []DepotPlan
+		if depotsFilePath != "" {
+			plans, err = planMultipleDepots(ctx, packages, maxSpeed, maxLoadCapacity, baseDeliveryCost, newPackagePricer(repository, baseDeliveryCost), options)
+		} else {
+			plans, err = planSingleDepot(ctx, packages, numVehicles, maxSpeed, maxLoadCapacity, baseDeliveryCost, newPackagePricer(repository, baseDeliveryCost), options)
+		}
+		if err != nil {
+			return err
+		}
+		timedOut := isPlanTimedOut(ctx)
+		trips, numVehicles := flattenDepotPlans(plans)
+		unscheduled, moved := getDepotPlanChanges(plans)
+
+		missedWindows := findMissedDeliveryWindows(trips, unscheduled)
+		if hardDeadlines && len(missedWindows) > 0 {
+			printMissedDeliveryWindows(missedWindows)
+			return fmt.Errorf("Plan rejected: %d packages miss their delivery window", len(missedWindows))
+		}
+
+		if timedOut {
+			printPlanTimedOut(planTimeout)
+		}
+		if depotsFilePath != "" {
+			printDepotPlans(plans, getFleetCapacity(maxLoadCapacity, options), calendar)
+			printDepotSummary(plans)
+		} else {
+			printTripDetails(trips, getFleetCapacity(maxLoadCapacity, options), calendar)
+		}
+		printMissedDeliveryWindows(missedWindows)
+		printUnscheduledPackages(unscheduled)
+		printMovedShipments("Shipments moved by breakdowns:", moved)
+		if options.Optimiser != nil {
+			printOptimiserReports(options.Optimiser)
+		}
+		if options.Explanation != nil {
+			printPlanExplanation(options.Explanation, options.Optimiser.changedPlan())
+		}
+		if showMarginReport {
+			printMarginReport(calculateOperatingCosts(trips, config.GetOperatingCosts()))
+		}
+
+		state := PlanState{NumVehicles: numVehicles, MaxSpeed: maxSpeed, MaxLoad: maxLoadCapacity, MaxVolume: maxVehicleVolume, MaxPackages: maxVehiclePackages, Vehicles: options.Vehicles, Breakdowns: options.Breakdowns, Trips: trips, Unscheduled: unscheduled}
+		if depotLocation != "" {
+			state.Depot, _ = parseGeoPoint(depotLocation)
+		}
+		if savePlanPath != "" {
+			if err := savePlanState(savePlanPath, state); err != nil {
+				return err
+			}
+		}
+		if repository != nil {
+			now := time.Now()
+			for _, pkg := range getPlanPackages(state) {
+				if !isSchedulable(pkg) {
+					continue
+				}
+				if err := recordQuote(repository, pkg, baseDeliveryCost, now); err != nil {
+					return err
+				}
+			}
+			if err := recordScheduled(repository, trips, now); err != nil {
+				return err
+			}
+			planID, err := recordPlan(repository, state, now)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Plan stored as %s\n", planID)
+		}
+
+		if eventLogPath != "" {
+			events := simulateDeliveryEvents(trips, numVehicles)
+			if calendar != nil {
+				for i := range events {
+					events[i].ClockTime = calendar.formatClock(events[i].Time)
+				}
+			}
+			if err := exportEventLog(eventLogPath, eventLogFormat, events); err != nil {
+				return err
+			}
+		}
+
+		if showGanttChart || reportFilePath != "" {
+			summary := summariseSchedule(trips, numVehicles)
+			if showGanttChart {
+				renderGanttChart(os.Stdout, summary, getFleetCapacity(maxLoadCapacity, options), ganttChartWidth)
+			}
+			if reportFilePath != "" {
+				if err := writeHTMLReport(reportFilePath, summary, getFleetCapacity(maxLoadCapacity, options)); err != nil {
+					return err
+				}
+			}
+		}
 
 		return nil
 	},
 }
 
+func planSingleDepot(ctx context.Context, packages []Package, numVehicles, maxSpeed, maxLoadCapacity, baseDeliveryCost int, price func(pkg *Package) error, options SchedulerOptions) ([]DepotPlan, error) {
+	var err error
+	if depotLocation != "" {
+		options.Depot, err = parseGeoPoint(depotLocation)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid depot location")
+		}
+	}
+
+	if roadNetworkPath != "" {
+		options.Roads, options.DepotNode, err = loadRoadDistances(roadNetworkPath, packages, price)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	trips, unscheduled, moved := planFleet(ctx, packages, numVehicles, maxSpeed, maxLoadCapacity, baseDeliveryCost, options)
+
+	return []DepotPlan{{Packages: packages, Trips: trips, Unscheduled: unscheduled, Moved: moved, FirstVehicleID: 1, NumVehicles: numVehicles}}, nil
+}
+
+// getFleetSize is the number of vehicles in the plan: those of every depot in
+// the --depots file, or numVehicles for a single depot.
+func getFleetSize(numVehicles int) (int, error) {
+	if depotsFilePath == "" {
+		return numVehicles, nil
+	}
+	depots, err := loadDepots(depotsFilePath)
+	if err != nil {
+		return 0, err
+	}
+	fleetSize := 0
+	for _, depot := range depots {
+		fleetSize += depot.Vehicles
+	}
+	return fleetSize, nil
+}
+
+func planMultipleDepots(ctx context.Context, packages []Package, maxSpeed, maxLoadCapacity, baseDeliveryCost int, price func(pkg *Package) error, options SchedulerOptions) ([]DepotPlan, error) {
+	if depotLocation != "" || depotNode != "" {
+		return nil, fmt.Errorf("Use either --depots or --depot/--depot-node")
+	}
+
+	depots, err := loadDepots(depotsFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var network *RoadNetwork
+	if roadNetworkPath != "" {
+		network, err = loadRoadNetwork(roadNetworkPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return planDepots(ctx, packages, depots, network, maxSpeed, maxLoadCapacity, baseDeliveryCost, price, options)
+}
+
 func parsePackages(packageArgs []string, baseDeliveryCost int) ([]Package, error) {
 	var packages []Package
 	offers := config.GetOffers()
 
 	for i, arg := range packageArgs {
 		packageDetails := strings.Fields(arg)
-		if len(packageDetails) != 4 {
+		if len(packageDetails) < 4 || !areValidPackageOptions(packageDetails[4:]) {
 			return nil, fmt.Errorf("Invalid package details for package %d", i+1)
 		}
 
@@ -250,23 +585,127 @@ func parsePackages(packageArgs []string, baseDeliveryCost int) ([]Package, error
 			return nil, fmt.Errorf("Invalid distance for package %d", i+1)
 		}
 
-		totalCost, _, _, discount, _ := calculateDeliveryCost(baseDeliveryCost, weight, distance, packageDetails[3], offers)
-		finalCost := totalCost - discount
-
-		packages = append(packages, Package{
+		pkg := Package{
 			ID:        packageDetails[0],
 			Weight:    weight,
 			Distance:  distance,
 			OfferCode: packageDetails[3],
-			TotalCost: totalCost,
-			Discount:  discount,
-			FinalCost: finalCost,
-		})
+		}
+
+		if err := parsePackageOptions(&pkg, packageDetails[4:], i+1); err != nil {
+			return nil, err
+		}
+
+		pricePackage(&pkg, baseDeliveryCost, offers)
+
+		packages = append(packages, pkg)
 	}
 
 	return packages, nil
 }
 
+func areValidPackageOptions(options []string) bool {
+	for _, option := range options {
+		if !strings.Contains(option, "=") {
+			return false
+		}
+	}
+	return true
+}
+
+func pricePackage(pkg *Package, baseDeliveryCost int, offers []config.Offer) {
+	totalCost, _, _, discount, _ := calculateDeliveryCost(baseDeliveryCost, pkg.Weight, pkg.Distance, pkg.OfferCode, offers)
+	totalCost, discount, _ = applyServiceLevel(totalCost, discount, getServiceLevel(*pkg))
+	pkg.ReattemptFee = getReattemptFee(totalCost, pkg.Attempts)
+	totalCost += pkg.ReattemptFee
+	pkg.TotalCost = totalCost
+	pkg.ContractDiscount = 0
+	pkg.Discount = discount
+	pkg.FinalCost = totalCost - discount
+}
+
+// parsePackageOptions reads the optional key=value fields that may follow the
+// four positional package fields, e.g. "PKG1 50 30 OFR001 latest=2.5".
+func parsePackageOptions(pkg *Package, options []string, packageNumber int) error {
+	latitude, longitude := "", ""
+	for _, option := range options {
+		key, value, _ := strings.Cut(option, "=")
+
+		switch key {
+		case "earliest":
+			earliest, err := strconv.ParseFloat(value, 64)
+			if err != nil || earliest < 0 {
+				return fmt.Errorf("Invalid earliest delivery time for package %d", packageNumber)
+			}
+			pkg.EarliestDelivery = earliest
+		case "latest":
+			latest, err := strconv.ParseFloat(value, 64)
+			if err != nil || latest <= 0 {
+				return fmt.Errorf("Invalid latest delivery time for package %d", packageNumber)
+			}
+			pkg.LatestDelivery = latest
+		case "service":
+			if !isValidServiceLevel(value) {
+				return fmt.Errorf("Invalid service level %s for package %d", value, packageNumber)
+			}
+			pkg.ServiceLevel = value
+		case "volume":
+			volume, err := strconv.ParseFloat(value, 64)
+			if err != nil || volume <= 0 {
+				return fmt.Errorf("Invalid volume for package %d", packageNumber)
+			}
+			pkg.Volume = volume
+		case "depot":
+			pkg.DepotID = value
+		case "node":
+			pkg.RoadNode = value
+		case "lat":
+			latitude = value
+		case "lon":
+			longitude = value
+		default:
+			return fmt.Errorf("Unknown option %s for package %d", key, packageNumber)
+		}
+	}
+
+	if latitude != "" || longitude != "" {
+		location, err := parseGeoPoint(latitude + "," + longitude)
+		if err != nil {
+			return fmt.Errorf("Invalid location for package %d", packageNumber)
+		}
+		pkg.Location = location
+	}
+
+	if pkg.LatestDelivery > 0 && pkg.EarliestDelivery > pkg.LatestDelivery {
+		return fmt.Errorf("Invalid delivery window for package %d", packageNumber)
+	}
+
+	return nil
+}
+
 func init() {
+	calculateTimeAndCostCmd.Flags().StringVar(&eventLogPath, "event-log", "", "Write the simulated delivery event log to this file (- for stdout)")
+	calculateTimeAndCostCmd.Flags().StringVar(&eventLogFormat, "event-log-format", "json", "Event log format: json or csv")
+	calculateTimeAndCostCmd.Flags().StringVar(&dispatchStart, "start", "", "Dispatch start time, e.g. 2024-05-01T08:00 or RFC3339")
+	calculateTimeAndCostCmd.Flags().StringVar(&dispatchTimezone, "timezone", "Local", "IANA timezone used for --start and printed clock times")
+	calculateTimeAndCostCmd.Flags().StringVar(&depotHours, "depot-hours", "", "Depot operating hours, e.g. 08:00-18:00")
+	calculateTimeAndCostCmd.Flags().StringVar(&driverShiftEnd, "shift-end", "", "Time of day by which drivers must be back at the depot, e.g. 17:00")
+	calculateTimeAndCostCmd.Flags().StringVar(&depotLocation, "depot", "", "Depot coordinates as lat,lon; enables routing for packages with lat/lon")
+	calculateTimeAndCostCmd.Flags().StringVar(&roadNetworkPath, "road-network", "", "Road graph (.csv or .geojson) used for distances and travel times")
+	calculateTimeAndCostCmd.Flags().StringVar(&depotNode, "depot-node", "", "Road network node of the depot; defaults to the node nearest --depot")
+	calculateTimeAndCostCmd.Flags().StringVar(&depotsFilePath, "depots", "", "JSON file of depots with locations and vehicle counts for multi-depot dispatch")
+	calculateTimeAndCostCmd.Flags().Float64Var(&maxVehicleVolume, "max-volume", 0, "Cargo volume a vehicle can carry per trip unless the vehicles file sets its own, in the unit of the volume= package option (0 for no limit)")
+	calculateTimeAndCostCmd.Flags().IntVar(&maxVehiclePackages, "max-packages", 0, "Number of packages a vehicle can carry per trip unless the vehicles file sets its own (0 for no limit)")
+	calculateTimeAndCostCmd.Flags().StringVar(&vehicleAvailabilityPath, "vehicles", "", "JSON file of vehicle shifts and maintenance slots in hours from the start of the plan, and capacities")
+	calculateTimeAndCostCmd.Flags().StringArrayVar(&breakdownSpecs, "breakdown", nil, "Take a vehicle out of service mid-plan as vehicle@hours, e.g. 2@1.5; may be repeated")
+	calculateTimeAndCostCmd.Flags().BoolVar(&hardDeadlines, "hard-deadlines", false, "Reject the plan if any package misses its latest delivery time")
+	calculateTimeAndCostCmd.Flags().BoolVar(&showGanttChart, "gantt", false, "Print an ASCII Gantt chart of the vehicle schedule")
+	calculateTimeAndCostCmd.Flags().StringVar(&reportFilePath, "report", "", "Write an HTML utilisation report to this file")
+	calculateTimeAndCostCmd.Flags().BoolVar(&explainPlan, "explain-plan", false, "Print the candidate shipments and vehicles weighed at each step and why one won")
+	calculateTimeAndCostCmd.Flags().BoolVar(&optimisePlan, "optimise", false, "Improve the greedy plan by local search to deliver the last package sooner")
+	calculateTimeAndCostCmd.Flags().DurationVar(&optimiseBudget, "optimise-budget", 2*time.Second, "Time the optimiser may spend on each batch, e.g. 500ms or 5s")
+	calculateTimeAndCostCmd.Flags().BoolVar(&showMarginReport, "margin", false, "Print the operating cost and margin of every trip and package and of the batch")
+	calculateTimeAndCostCmd.Flags().DurationVar(&planTimeout, "timeout", 0, "Stop planning after this long and show the best partial plan found, e.g. 30s (0 for no limit)")
+	calculateTimeAndCostCmd.Flags().StringVar(&savePlanPath, "save-plan", "", "Save the plan to this file so it can be re-planned later with replan")
 	rootCmd.AddCommand(calculateTimeAndCostCmd)
 }
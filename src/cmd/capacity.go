@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+// Capacity is what a vehicle can carry on one trip. A zero Volume or Packages
+// means that dimension is not limited; weight is always limited.
+type Capacity struct {
+	Weight   int     `json:"weight,omitempty"`
+	Volume   float64 `json:"volume,omitempty"`
+	Packages int     `json:"packages,omitempty"`
+}
+
+// FleetCapacity is what each vehicle of a fleet can carry: Default, or the
+// vehicle's own capacity when the vehicles file gives it one.
+type FleetCapacity struct {
+	Default  Capacity
+	Vehicles map[int]Capacity
+}
+
+const (
+	ConstraintWeight   = "weight"
+	ConstraintVolume   = "volume"
+	ConstraintPackages = "package count"
+)
+
+var (
+	maxVehicleVolume   float64
+	maxVehiclePackages int
+)
+
+func getCapacity(maxWeight int, options SchedulerOptions) Capacity {
+	return Capacity{Weight: maxWeight, Volume: options.MaxVolume, Packages: options.MaxPackages}
+}
+
+// getFleetCapacity returns the capacity of every vehicle, with the limits a
+// vehicle leaves at zero taken from the command line.
+func getFleetCapacity(maxWeight int, options SchedulerOptions) FleetCapacity {
+	fleet := FleetCapacity{Default: getCapacity(maxWeight, options), Vehicles: make(map[int]Capacity)}
+	for _, vehicle := range options.Vehicles {
+		fleet.Vehicles[vehicle.ID] = vehicle.Capacity.withDefaults(fleet.Default)
+	}
+	return fleet
+}
+
+func (f FleetCapacity) getVehicleCapacity(vehicleID int) Capacity {
+	if capacity, found := f.Vehicles[vehicleID]; found {
+		return capacity
+	}
+	return f.Default
+}
+
+// withDefaults fills in every limit c leaves at zero from defaults.
+func (c Capacity) withDefaults(defaults Capacity) Capacity {
+	if c.Weight == 0 {
+		c.Weight = defaults.Weight
+	}
+	if c.Volume == 0 {
+		c.Volume = defaults.Volume
+	}
+	if c.Packages == 0 {
+		c.Packages = defaults.Packages
+	}
+	return c
+}
+
+// getShipmentLoad returns what the shipment puts on a vehicle, as the
+// capacity it takes up.
+func getShipmentLoad(shipment []int, packageList []Package) Capacity {
+	load := Capacity{Packages: len(shipment)}
+	for _, idx := range shipment {
+		load.Weight += packageList[idx].Weight
+		load.Volume += packageList[idx].Volume
+	}
+	return load
+}
+
+func (c Capacity) fits(weight int, volume float64, count int) bool {
+	if weight > c.Weight {
+		return false
+	}
+	if c.Volume > 0 && volume > c.Volume+1e-9 {
+		return false
+	}
+	return c.Packages == 0 || count <= c.Packages
+}
+
+func (c Capacity) fitsPackage(pkg Package) bool {
+	return c.fits(pkg.Weight, pkg.Volume, 1)
+}
+
+func (c Capacity) holds(load Capacity) bool {
+	return c.fits(load.Weight, load.Volume, load.Packages)
+}
+
+// fitsAnyVehicle reports whether at least one vehicle of the fleet can carry
+// the load.
+func fitsAnyVehicle(vehicleList []Vehicle, load Capacity) bool {
+	for _, vehicle := range vehicleList {
+		if vehicle.Capacity.holds(load) {
+			return true
+		}
+	}
+	return false
+}
+
+// getCapacitiesByDeparture returns the capacity of each vehicle in the order
+// the vehicles can next leave, each capacity once. The shipment search tries
+// them in turn, so the next shipment is sized for the vehicle free first but
+// still finds one when only a bigger vehicle waiting behind it can carry it.
+func getCapacitiesByDeparture(vehicleList []Vehicle, vehicleAvailabilityArray []float64, calendar *DispatchCalendar) []Capacity {
+	order := make([]int, len(vehicleList))
+	departures := make([]float64, len(vehicleList))
+	for i, vehicle := range vehicleList {
+		order[i] = i
+		departure, available := vehicle.getDeparture(vehicleAvailabilityArray[i], 0, calendar)
+		if !available {
+			departure = math.Inf(1)
+		}
+		departures[i] = departure
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return departures[order[a]] < departures[order[b]]-1e-9
+	})
+
+	var capacities []Capacity
+	for _, i := range order {
+		if !slices.Contains(capacities, vehicleList[i].Capacity) {
+			capacities = append(capacities, vehicleList[i].Capacity)
+		}
+	}
+	return capacities
+}
+
+// getTripLoad returns how full the vehicle is on the trip, in percent of the
+// capacity dimension that binds, i.e. the one closest to its limit. Weight
+// wins a tie.
+func (c Capacity) getTripLoad(trip Trip) (float64, string) {
+	weight, volume := 0, 0.0
+	for _, pkg := range trip.Packages {
+		weight += pkg.Weight
+		volume += pkg.Volume
+	}
+
+	load, constraint := 0.0, ConstraintWeight
+	if c.Weight > 0 {
+		load = float64(weight) * 100 / float64(c.Weight)
+	}
+	if c.Volume > 0 && volume*100/c.Volume > load {
+		load, constraint = volume*100/c.Volume, ConstraintVolume
+	}
+	if c.Packages > 0 && float64(len(trip.Packages))*100/float64(c.Packages) > load {
+		load, constraint = float64(len(trip.Packages))*100/float64(c.Packages), ConstraintPackages
+	}
+	return load, constraint
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("vehicle capacity", func() {
+	Describe("getShipmentsSubSetsWhichFallsUnderMaxCarriable", func() {
+		packages := []Package{
+			{ID: "PKG1", Weight: 50, Volume: 1},
+			{ID: "PKG2", Weight: 60, Volume: 1.5},
+			{ID: "PKG3", Weight: 70, Volume: 1.5},
+		}
+
+		It("should respect the package count limit", func() {
+			capacity := Capacity{Weight: 200, Packages: 2}
+
+			Expect(getShipmentsSubSetsWhichFallsUnderMaxCarriable(context.Background(), packages, capacity, nil)).To(Equal([][]int{{1, 2}}))
+		})
+
+		It("should respect the volume limit", func() {
+			capacity := Capacity{Weight: 200, Volume: 2.5}
+
+			Expect(getShipmentsSubSetsWhichFallsUnderMaxCarriable(context.Background(), packages, capacity, nil)).To(Equal([][]int{{0, 2}}))
+		})
+	})
+
+	Describe("getTripLoad", func() {
+		trip := Trip{Packages: []Package{{ID: "PKG1", Weight: 50, Volume: 1.5}, {ID: "PKG2", Weight: 50, Volume: 1}}}
+
+		It("should report the dimension closest to its limit", func() {
+			load, constraint := Capacity{Weight: 200, Volume: 5, Packages: 3}.getTripLoad(trip)
+
+			Expect(constraint).To(Equal(ConstraintPackages))
+			Expect(load).To(BeNumerically("~", 66.67, 0.01))
+		})
+
+		It("should fall back to weight when nothing else is limited", func() {
+			load, constraint := Capacity{Weight: 200}.getTripLoad(trip)
+
+			Expect(constraint).To(Equal(ConstraintWeight))
+			Expect(load).To(Equal(50.0))
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with volume and count limits", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			maxVehicleVolume = 0
+			maxVehiclePackages = 0
+			showGanttChart = false
+			vehicleAvailabilityPath = ""
+		})
+
+		It("should show the binding constraint and skip packages that never fit", func() {
+			maxVehicleVolume = 2
+			maxVehiclePackages = 2
+			showGanttChart = true
+
+			args := []string{"100", "4", "PKG1 50 30 NA volume=0.5", "PKG2 75 125 NA volume=1.2", "PKG4 110 60 NA volume=1", "PKG5 155 95 NA volume=3", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Packages that could not be scheduled:\n  PKG5\n"))
+			Expect(output.String()).To(ContainSubstring("load 100% by package count, packages PKG1,PKG4"))
+			Expect(output.String()).To(ContainSubstring("load 60% by volume, packages PKG2"))
+		})
+
+		It("should show the binding constraint of every trip in the trip report", func() {
+			maxVehicleVolume = 2
+			maxVehiclePackages = 2
+
+			args := []string{"100", "3", "PKG1 50 30 NA volume=0.5", "PKG2 75 125 NA volume=1.2", "PKG4 110 60 NA volume=1", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Delivery Time: 0.86 hours\n\nTrip: Vehicle 1, load 100% by package count\n\n"))
+			Expect(output.String()).To(ContainSubstring("Trip: Vehicle 1, load 60% by volume\n\n"))
+		})
+
+		It("should load each vehicle up to its own capacity", func() {
+			vehicleAvailabilityPath = filepath.Join(GinkgoT().TempDir(), "vehicles.json")
+			Expect(os.WriteFile(vehicleAvailabilityPath, []byte(`[{"id": 2, "capacity": {"weight": 300}}]`), 0644)).To(Succeed())
+
+			args := []string{"100", "2", "PKG1 50 30 NA", "PKG2 250 100 NA", "2", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).ToNot(ContainSubstring("could not be scheduled"))
+			Expect(output.String()).To(ContainSubstring("Package: PKG1\n  Vehicle: 1\n"))
+			Expect(output.String()).To(ContainSubstring("Package: PKG2\n  Vehicle: 2\n"))
+			Expect(output.String()).To(ContainSubstring("Trip: Vehicle 1, load 25% by weight\n"))
+			Expect(output.String()).To(ContainSubstring("Trip: Vehicle 2, load 83% by weight\n"))
+		})
+
+		It("should wait for a vehicle big enough rather than overload one free sooner", func() {
+			vehicleAvailabilityPath = filepath.Join(GinkgoT().TempDir(), "vehicles.json")
+			Expect(os.WriteFile(vehicleAvailabilityPath, []byte(`[{"id": 1, "capacity": {"weight": 100}}, {"id": 2, "shiftStart": 1}]`), 0644)).To(Succeed())
+
+			args := []string{"100", "1", "PKG1 150 35 NA", "2", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Package: PKG1\n  Vehicle: 2\n"))
+			Expect(output.String()).To(ContainSubstring("Delivery Time: 1.50 hours\n"))
+			Expect(output.String()).To(ContainSubstring("Trip: Vehicle 2, load 75% by weight\n"))
+		})
+
+		It("should reject a vehicle capacity that is negative", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "vehicles.json")
+			Expect(os.WriteFile(path, []byte(`[{"id": 1, "capacity": {"volume": -1}}]`), 0644)).To(Succeed())
+
+			_, err := loadVehicleAvailability(path)
+
+			Expect(err).To(MatchError("Invalid capacity for vehicle 1"))
+		})
+
+		It("should reject package volumes that are not positive", func() {
+			_, err := parsePackages([]string{"PKG1 50 30 NA volume=0"}, 100)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Invalid volume for package 1"))
+		})
+	})
+})
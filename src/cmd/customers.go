@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"courier_service/config"
+	"courier_service/store"
+
+	"github.com/spf13/cobra"
+)
+
+// ContractPrice is a package priced under a customer's contract. OfferCode is
+// the offer that was tried, which is the customer's default offer when the
+// package has no offer of its own.
+type ContractPrice struct {
+	TotalCost        float64
+	WeightCost       float64
+	DistanceCost     float64
+	ContractDiscount float64
+	OfferDiscount    float64
+	OfferCode        string
+	DiscountReason   string
+}
+
+var (
+	customerID           string
+	customerTier         string
+	customerWeightRate   int
+	customerDistanceRate int
+	customerDefaultOffer string
+	customerCreditLimit  float64
+)
+
+func isKnownOffer(offerCode string, offers []config.Offer) bool {
+	for _, offer := range offers {
+		if offer.Code == offerCode {
+			return true
+		}
+	}
+	return false
+}
+
+// calculateContractDeliveryCost prices a package under a customer's contract.
+// Negotiated rates replace the public ones and the tier discount comes off
+// first; public offers then apply to what is left.
+func calculateContractDeliveryCost(baseDeliveryCost, weight, distance int, offerCode string, offers []config.Offer, customer store.Customer) ContractPrice {
+	weightRate, distanceRate := config.GetWeightCostPerKG(), config.GetDistanceCostPerKM()
+	if customer.WeightCostPerKG > 0 {
+		weightRate = customer.WeightCostPerKG
+	}
+	if customer.DistanceCostPerKM > 0 {
+		distanceRate = customer.DistanceCostPerKM
+	}
+
+	price := ContractPrice{
+		WeightCost:   float64(weight * weightRate),
+		DistanceCost: float64(distance * distanceRate),
+		OfferCode:    offerCode,
+	}
+	price.TotalCost = float64(baseDeliveryCost) + price.WeightCost + price.DistanceCost
+
+	tierDiscount, _ := config.GetCustomerTierDiscount(customer.Tier)
+	price.ContractDiscount = price.TotalCost * tierDiscount
+
+	if !isKnownOffer(offerCode, offers) && customer.DefaultOffer != "" {
+		price.OfferCode = customer.DefaultOffer
+	}
+	price.OfferDiscount, price.DiscountReason = getOfferDiscount(price.TotalCost-price.ContractDiscount, weight, distance, price.OfferCode, offers)
+
+	return price
+}
+
+// getCreditUsed is what the customer still owes on quoted packages, counting
+// only the latest quote of each package. Returned packages and packages on a
+// paid invoice are settled and left out. The given package is left out too so
+// that re-quoting it replaces its old amount.
+func getCreditUsed(repository store.Repository, customerID, exceptPackageID string) (float64, error) {
+	settled := map[string]bool{exceptPackageID: true}
+	invoices, err := repository.ListInvoices()
+	if err != nil {
+		return 0, err
+	}
+	for _, invoice := range invoices {
+		if invoice.CustomerID != customerID || invoice.PaidAt == nil {
+			continue
+		}
+		for _, line := range invoice.Lines {
+			settled[line.PackageID] = true
+		}
+	}
+
+	quotes, err := repository.ListQuotes()
+	if err != nil {
+		return 0, err
+	}
+	latest := make(map[string]float64)
+	for _, quote := range quotes {
+		if quote.CustomerID == customerID && !settled[quote.PackageID] {
+			latest[quote.PackageID] = quote.FinalCost
+		}
+	}
+
+	used := 0.0
+	for packageID, amount := range latest {
+		pkg, err := repository.GetPackage(packageID)
+		if err != nil && err != store.ErrNotFound {
+			return 0, err
+		}
+		if pkg.Status == store.StatusReturned {
+			continue
+		}
+		used += amount
+	}
+	return used, nil
+}
+
+func checkCreditLimit(repository store.Repository, customer store.Customer, packageID string, amount float64) error {
+	if customer.CreditLimit == 0 {
+		return nil
+	}
+
+	used, err := getCreditUsed(repository, customer.ID, packageID)
+	if err != nil {
+		return err
+	}
+	if used+amount > customer.CreditLimit+1e-9 {
+		return fmt.Errorf("Package %s would take customer %s over its credit limit of %.2f (%.2f used)", packageID, customer.ID, customer.CreditLimit, used)
+	}
+	return nil
+}
+
+func loadCustomer(repository store.Repository, id string) (store.Customer, error) {
+	customer, err := repository.GetCustomer(id)
+	if err == store.ErrNotFound {
+		return customer, fmt.Errorf("Customer %s not found", id)
+	}
+	return customer, err
+}
+
+func printCustomer(customer store.Customer) {
+	fmt.Printf("Customer %s: %s\n", customer.ID, customer.Name)
+	if customer.Tier != "" {
+		fmt.Printf("  Tier: %s\n", customer.Tier)
+	}
+	if customer.WeightCostPerKG > 0 {
+		fmt.Printf("  Weight Cost Per KG: %d\n", customer.WeightCostPerKG)
+	}
+	if customer.DistanceCostPerKM > 0 {
+		fmt.Printf("  Distance Cost Per KM: %d\n", customer.DistanceCostPerKM)
+	}
+	if customer.DefaultOffer != "" {
+		fmt.Printf("  Default Offer: %s\n", customer.DefaultOffer)
+	}
+	if customer.CreditLimit > 0 {
+		fmt.Printf("  Credit Limit: %.2f\n", customer.CreditLimit)
+	}
+}
+
+var addCustomerCmd = &cobra.Command{
+	Use:   "addCustomer",
+	Short: "Add a customer or update its contract",
+	Long:  `This command keeps a customer in the store with its contract terms: a tier, negotiated per-kg and per-km rates, a default offer and a credit limit. Saving an existing customer replaces its terms.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("Usage: courier_service addCustomer <customerID> <name> --store <store_file>")
+		}
+
+		if customerTier != "" {
+			if _, found := config.GetCustomerTierDiscount(customerTier); !found {
+				return fmt.Errorf("Unknown customer tier %s", customerTier)
+			}
+		}
+		if customerDefaultOffer != "" && !isKnownOffer(customerDefaultOffer, config.GetOffers()) {
+			return fmt.Errorf("Unknown offer %s", customerDefaultOffer)
+		}
+
+		repository, err := openRequiredStore()
+		if err != nil {
+			return err
+		}
+		defer repository.Close()
+
+		customer := store.Customer{
+			ID:                args[0],
+			Name:              args[1],
+			Tier:              customerTier,
+			WeightCostPerKG:   customerWeightRate,
+			DistanceCostPerKM: customerDistanceRate,
+			DefaultOffer:      customerDefaultOffer,
+			CreditLimit:       customerCreditLimit,
+			CreatedAt:         time.Now(),
+		}
+		if existing, err := repository.GetCustomer(customer.ID); err == nil {
+			customer.CreatedAt = existing.CreatedAt
+		}
+		if err := repository.SaveCustomer(customer); err != nil {
+			return err
+		}
+
+		printCustomer(customer)
+		return nil
+	},
+}
+
+func init() {
+	addCustomerCmd.Flags().StringVar(&customerTier, "tier", "", "Customer tier, one of the tiers under customerTiers in the config")
+	addCustomerCmd.Flags().IntVar(&customerWeightRate, "weight-rate", 0, "Negotiated cost per kg (0 for the public rate)")
+	addCustomerCmd.Flags().IntVar(&customerDistanceRate, "distance-rate", 0, "Negotiated cost per km (0 for the public rate)")
+	addCustomerCmd.Flags().StringVar(&customerDefaultOffer, "default-offer", "", "Offer tried for packages without an offer code of their own")
+	addCustomerCmd.Flags().Float64Var(&customerCreditLimit, "credit-limit", 0, "Most the customer may owe on quoted packages (0 for no limit)")
+	rootCmd.AddCommand(addCustomerCmd)
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	"courier_service/config"
+	"courier_service/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("customer contracts", func() {
+	offers := []config.Offer{{Code: "OFR003", Discount: 0.05, MinDistance: 10, MaxDistance: 150, MinWeight: 50, MaxWeight: 250}}
+
+	BeforeEach(func() {
+		viper.Set("weightCostPerKG", 10)
+		viper.Set("distanceCostPerKM", 5)
+		viper.Set("offers", offers)
+		viper.Set("customerTiers", map[string]interface{}{"standard": 0, "gold": 0.05})
+	})
+
+	AfterEach(func() {
+		viper.Set("customerTiers", map[string]interface{}{})
+	})
+
+	Describe("calculateContractDeliveryCost", func() {
+		customer := store.Customer{ID: "ACME", Tier: "gold", WeightCostPerKG: 8, DefaultOffer: "OFR003"}
+
+		It("should apply the contract rates and tier before the default offer", func() {
+			price := calculateContractDeliveryCost(100, 50, 40, "NA", offers, customer)
+
+			Expect(price.WeightCost).To(Equal(400.0))
+			Expect(price.DistanceCost).To(Equal(200.0))
+			Expect(price.TotalCost).To(Equal(700.0))
+			Expect(price.ContractDiscount).To(Equal(35.0))
+			Expect(price.OfferCode).To(Equal("OFR003"))
+			Expect(price.OfferDiscount).To(Equal(33.25))
+		})
+
+		It("should keep the package's own offer", func() {
+			price := calculateContractDeliveryCost(100, 50, 40, "OFR003", offers, store.Customer{ID: "ACME", DefaultOffer: "OFR001"})
+
+			Expect(price.OfferCode).To(Equal("OFR003"))
+			Expect(price.TotalCost).To(Equal(800.0))
+			Expect(price.ContractDiscount).To(BeZero())
+		})
+	})
+
+	Describe("commands", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			storePath = filepath.Join(GinkgoT().TempDir(), "store.jsonl")
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+
+			customerTier, customerWeightRate, customerDefaultOffer, customerCreditLimit = "gold", 8, "OFR003", 1000
+			Expect(addCustomerCmd.RunE(nil, []string{"ACME", "Acme Ltd"})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			storePath, customerID, invoicePeriod, invoiceOutputDir, invoiceFormats = "", "", "", "", nil
+			customerTier, customerWeightRate, customerDistanceRate, customerDefaultOffer, customerCreditLimit = "", 0, 0, "", 0
+		})
+
+		It("should price under the customer's contract", func() {
+			customerID = "ACME"
+
+			err := calculateCmd.RunE(nil, []string{"100", "1", "PKG1 50 40 NA"})
+
+			w.Close()
+			output.ReadFrom(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Customer: ACME\n"))
+			Expect(output.String()).To(ContainSubstring("Offer code: OFR003\n"))
+			Expect(output.String()).To(ContainSubstring("  Contract Discount: -35.00\n  Discount: -33.25\nTotal Delivery Cost: 631.75\n"))
+
+			repository, _ := store.NewFileStore(storePath)
+			defer repository.Close()
+			quotes, _ := repository.ListQuotes()
+			redemptions, _ := repository.ListOfferRedemptions()
+			Expect(quotes[0].CustomerID).To(Equal("ACME"))
+			Expect(quotes[0].Discount).To(Equal(68.25))
+			Expect(redemptions[0].Discount).To(Equal(33.25))
+		})
+
+		It("should refuse quotes over the credit limit", func() {
+			customerID = "ACME"
+
+			err := calculateCmd.RunE(nil, []string{"100", "2", "PKG1 50 40 NA", "PKG2 50 40 NA"})
+
+			Expect(err).To(MatchError("Package PKG2 would take customer ACME over its credit limit of 1000.00 (631.75 used)"))
+		})
+
+		It("should let a package be re-quoted within the limit", func() {
+			customerID = "ACME"
+
+			Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG1 50 40 NA"})).To(Succeed())
+			Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG1 50 40 NA"})).To(Succeed())
+		})
+
+		It("should only count what is still owed towards the credit limit", func() {
+			customerID = "ACME"
+			invoicePeriod, invoiceOutputDir, invoiceFormats = "month", filepath.Join(GinkgoT().TempDir(), "invoices"), []string{"json"}
+			Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG1 50 40 NA"})).To(Succeed())
+			Expect(invoiceCmd.RunE(nil, nil)).To(Succeed())
+			Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG2 50 40 NA"})).To(HaveOccurred())
+
+			Expect(payInvoiceCmd.RunE(nil, []string{"INV-000001"})).To(Succeed())
+			Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG2 50 40 NA"})).To(Succeed())
+			Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG3 50 40 NA"})).To(HaveOccurred())
+
+			repository, _ := store.NewFileStore(storePath)
+			for _, status := range []string{store.StatusScheduled, store.StatusOutForDelivery, store.StatusFailed, store.StatusReturned} {
+				_, err := repository.UpdatePackageStatus("PKG2", status, time.Now())
+				Expect(err).ToNot(HaveOccurred())
+			}
+			repository.Close()
+			Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG3 50 40 NA"})).To(Succeed())
+		})
+
+		It("should refuse to pay an unknown or paid invoice", func() {
+			Expect(payInvoiceCmd.RunE(nil, []string{"INV-000001"})).To(MatchError("Invoice INV-000001 not found"))
+
+			repository, _ := store.NewFileStore(storePath)
+			paidAt := time.Now()
+			repository.SaveInvoice(store.Invoice{CustomerID: "ACME", Lines: []store.InvoiceLine{{PackageID: "PKG1"}}, PaidAt: &paidAt})
+			repository.Close()
+			Expect(payInvoiceCmd.RunE(nil, []string{"INV-000001"})).To(MatchError("Invoice INV-000001 is already paid"))
+		})
+
+		It("should keep the customer's contract price when the package is planned", func() {
+			customerID = "ACME"
+			Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG1 50 40 NA"})).To(Succeed())
+			customerID = ""
+
+			err := calculateTimeAndCostCmd.RunE(nil, []string{"100", "1", "PKG1 50 40 NA", "1", "70", "200"})
+
+			Expect(err).ToNot(HaveOccurred())
+			repository, _ := store.NewFileStore(storePath)
+			defer repository.Close()
+			pkg, _ := repository.GetPackage("PKG1")
+			quotes, _ := repository.ListQuotes()
+			Expect(pkg.CustomerID).To(Equal("ACME"))
+			Expect(quotes).To(HaveLen(2))
+			Expect(quotes[1].CustomerID).To(Equal("ACME"))
+			Expect(quotes[1].FinalCost).To(Equal(631.75))
+		})
+
+		It("should keep the contract price when planning by road distance", func() {
+			dir := GinkgoT().TempDir()
+			roadNetworkPath, depotNode = filepath.Join(dir, "roads.csv"), "D"
+			Expect(os.WriteFile(roadNetworkPath, []byte(testRoadNetworkCSV), 0644)).To(Succeed())
+			defer func() { roadNetworkPath, depotNode, depotsFilePath = "", "", "" }()
+			customerID = "ACME"
+			Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG1 10 5 NA node=A"})).To(Succeed())
+			customerID = ""
+
+			Expect(calculateTimeAndCostCmd.RunE(nil, []string{"100", "1", "PKG1 10 5 NA node=A", "1", "70", "200"})).To(Succeed())
+			depotNode, depotsFilePath = "", filepath.Join(dir, "depots.json")
+			Expect(os.WriteFile(depotsFilePath, []byte(`[{"id": "HUB", "node": "D", "vehicles": 1}]`), 0644)).To(Succeed())
+			Expect(calculateTimeAndCostCmd.RunE(nil, []string{"100", "1", "PKG1 10 5 NA node=A", "1", "70", "200"})).To(Succeed())
+
+			repository, _ := store.NewFileStore(storePath)
+			defer repository.Close()
+			quotes, _ := repository.ListQuotes()
+			Expect(quotes).To(HaveLen(3))
+			for _, quote := range quotes {
+				Expect(quote.CustomerID).To(Equal("ACME"))
+				Expect(quote.TotalCost).To(Equal(780.0))
+				Expect(quote.ContractDiscount).To(Equal(39.0))
+				Expect(quote.Discount).To(Equal(39.0))
+				Expect(quote.FinalCost).To(Equal(741.0))
+			}
+		})
+
+		It("should reject an unknown customer or tier", func() {
+			customerID = "GLOBEX"
+			Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG1 50 40 NA"})).To(MatchError("Customer GLOBEX not found"))
+
+			customerTier = "platinum"
+			Expect(addCustomerCmd.RunE(nil, []string{"GLOBEX", "Globex"})).To(MatchError("Unknown customer tier platinum"))
+		})
+	})
+})
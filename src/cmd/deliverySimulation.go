@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+type EventType string
+
+const (
+	EventVehicleDeparts   EventType = "vehicle_departs"
+	EventPackageDelivered EventType = "package_delivered"
+	EventVehicleReturns   EventType = "vehicle_returns"
+	EventVehicleIdle      EventType = "vehicle_idle"
+)
+
+// eventOrder decides which event comes first when two share a timestamp, so a
+// vehicle returning and leaving again at the same instant reads naturally.
+var eventOrder = map[EventType]int{
+	EventPackageDelivered: 0,
+	EventVehicleReturns:   1,
+	EventVehicleIdle:      2,
+	EventVehicleDeparts:   3,
+}
+
+type DeliveryEvent struct {
+	Time      float64   `json:"time"`
+	Type      EventType `json:"type"`
+	VehicleID int       `json:"vehicleId"`
+	PackageID string    `json:"packageId,omitempty"`
+	Duration  float64   `json:"duration,omitempty"`
+	ClockTime string    `json:"clockTime,omitempty"`
+}
+
+var (
+	eventLogPath   string
+	eventLogFormat string
+)
+
+func simulateDeliveryEvents(trips []Trip, numVehicles int) []DeliveryEvent {
+	var events []DeliveryEvent
+	makespan := 0.0
+	tripsByVehicle := make(map[int][]Trip)
+
+	for _, trip := range trips {
+		tripsByVehicle[trip.VehicleID] = append(tripsByVehicle[trip.VehicleID], trip)
+		makespan = math.Max(makespan, trip.Return)
+
+		events = append(events, DeliveryEvent{Time: trip.Departure, Type: EventVehicleDeparts, VehicleID: trip.VehicleID})
+		for _, pkg := range trip.Packages {
+			events = append(events, DeliveryEvent{Time: pkg.DeliveryTime, Type: EventPackageDelivered, VehicleID: trip.VehicleID, PackageID: pkg.ID})
+		}
+		events = append(events, DeliveryEvent{Time: trip.Return, Type: EventVehicleReturns, VehicleID: trip.VehicleID})
+	}
+
+	for vehicleID := 1; vehicleID <= numVehicles; vehicleID++ {
+		events = append(events, getIdleEvents(vehicleID, tripsByVehicle[vehicleID], makespan)...)
+	}
+
+	sortDeliveryEvents(events)
+
+	return events
+}
+
+// getIdleEvents emits one idle event for every gap in a vehicle's day, including
+// the wait before its first trip and the time after its last return until the
+// whole fleet is done.
+func getIdleEvents(vehicleID int, trips []Trip, makespan float64) []DeliveryEvent {
+	var events []DeliveryEvent
+	sort.SliceStable(trips, func(i, j int) bool { return trips[i].Departure < trips[j].Departure })
+
+	freeFrom := 0.0
+	for _, trip := range trips {
+		if trip.Departure > freeFrom {
+			events = append(events, DeliveryEvent{Time: freeFrom, Type: EventVehicleIdle, VehicleID: vehicleID, Duration: trip.Departure - freeFrom})
+		}
+		freeFrom = trip.Return
+	}
+	if makespan > freeFrom {
+		events = append(events, DeliveryEvent{Time: freeFrom, Type: EventVehicleIdle, VehicleID: vehicleID, Duration: makespan - freeFrom})
+	}
+
+	return events
+}
+
+func sortDeliveryEvents(events []DeliveryEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Time != events[j].Time {
+			return events[i].Time < events[j].Time
+		}
+		if events[i].Type != events[j].Type {
+			return eventOrder[events[i].Type] < eventOrder[events[j].Type]
+		}
+		if events[i].VehicleID != events[j].VehicleID {
+			return events[i].VehicleID < events[j].VehicleID
+		}
+		return events[i].PackageID < events[j].PackageID
+	})
+}
+
+func exportEventLog(path, format string, events []DeliveryEvent) error {
+	if format != "json" && format != "csv" {
+		return fmt.Errorf("Invalid event log format %s", format)
+	}
+
+	if path == "-" {
+		return writeEventLog(os.Stdout, format, events)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Unable to create event log file: %s", err)
+	}
+	defer file.Close()
+
+	return writeEventLog(file, format, events)
+}
+
+func writeEventLog(w io.Writer, format string, events []DeliveryEvent) error {
+	if format == "csv" {
+		return writeEventLogCSV(w, events)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if events == nil {
+		events = []DeliveryEvent{}
+	}
+	return encoder.Encode(events)
+}
+
+func writeEventLogCSV(w io.Writer, events []DeliveryEvent) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"time", "type", "vehicle_id", "package_id", "duration", "clock_time"}); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		record := []string{
+			strconv.FormatFloat(event.Time, 'f', 2, 64),
+			string(event.Type),
+			strconv.Itoa(event.VehicleID),
+			event.PackageID,
+			strconv.FormatFloat(event.Duration, 'f', 2, 64),
+			event.ClockTime,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("simulateDeliveryEvents", func() {
+	var trips []Trip
+
+	BeforeEach(func() {
+		trips = []Trip{
+			{VehicleID: 1, Departure: 0, Return: 2, Packages: []Package{{ID: "PKG1", DeliveryTime: 1}}},
+			{VehicleID: 1, Departure: 2, Return: 6, Packages: []Package{{ID: "PKG2", DeliveryTime: 3}, {ID: "PKG3", DeliveryTime: 4}}},
+			{VehicleID: 2, Departure: 0, Return: 3, Packages: []Package{{ID: "PKG4", DeliveryTime: 1.5}}},
+		}
+	})
+
+	It("should order events by time with returns before departures", func() {
+		events := simulateDeliveryEvents(trips, 2)
+
+		Expect(events[0]).To(Equal(DeliveryEvent{Time: 0, Type: EventVehicleDeparts, VehicleID: 1}))
+		Expect(events[1]).To(Equal(DeliveryEvent{Time: 0, Type: EventVehicleDeparts, VehicleID: 2}))
+		Expect(events[4]).To(Equal(DeliveryEvent{Time: 2, Type: EventVehicleReturns, VehicleID: 1}))
+		Expect(events[5]).To(Equal(DeliveryEvent{Time: 2, Type: EventVehicleDeparts, VehicleID: 1}))
+		Expect(events[len(events)-1]).To(Equal(DeliveryEvent{Time: 6, Type: EventVehicleReturns, VehicleID: 1}))
+	})
+
+	It("should record idle time until the last vehicle returns", func() {
+		events := simulateDeliveryEvents(trips, 3)
+
+		var idle []DeliveryEvent
+		for _, event := range events {
+			if event.Type == EventVehicleIdle {
+				idle = append(idle, event)
+			}
+		}
+
+		Expect(idle).To(ConsistOf(
+			DeliveryEvent{Time: 0, Type: EventVehicleIdle, VehicleID: 3, Duration: 6},
+			DeliveryEvent{Time: 3, Type: EventVehicleIdle, VehicleID: 2, Duration: 3},
+		))
+	})
+
+	It("should write the event log as CSV", func() {
+		var buffer bytes.Buffer
+		err := writeEventLog(&buffer, "csv", simulateDeliveryEvents(trips[:1], 1))
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buffer.String()).To(Equal("time,type,vehicle_id,package_id,duration,clock_time\n" +
+			"0.00,vehicle_departs,1,,0.00,\n" +
+			"1.00,package_delivered,1,PKG1,0.00,\n" +
+			"2.00,vehicle_returns,1,,0.00,\n"))
+	})
+
+	It("should reject unknown formats", func() {
+		err := exportEventLog("-", "xml", nil)
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("Invalid event log format xml"))
+	})
+})
+
+var _ = Describe("CalculateTimeAndCostCmd with event log", func() {
+	AfterEach(func() {
+		eventLogPath = ""
+		eventLogFormat = "json"
+	})
+
+	It("should export the event log as JSON", func() {
+		eventLogPath = filepath.Join(GinkgoT().TempDir(), "events.json")
+		eventLogFormat = "json"
+
+		args := []string{"100", "3", "PKG1 50 30 OFR001", "PKG2 75 125 OFFR0008", "PKG3 175 100 OFFR003", "2", "70", "200"}
+		err := calculateTimeAndCostCmd.RunE(nil, args)
+		Expect(err).ToNot(HaveOccurred())
+
+		content, err := os.ReadFile(eventLogPath)
+		Expect(err).ToNot(HaveOccurred())
+
+		var events []DeliveryEvent
+		Expect(json.Unmarshal(content, &events)).To(Succeed())
+
+		delivered := 0
+		for _, event := range events {
+			if event.Type == EventPackageDelivered {
+				delivered++
+			}
+		}
+		Expect(delivered).To(Equal(3))
+		Expect(events[0].Type).To(Equal(EventVehicleDeparts))
+	})
+})
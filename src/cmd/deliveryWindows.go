@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// MissedDeliveryWindow is a package delivered after its latest delivery time,
+// or not scheduled at all, in which case VehicleID and DeliveryTime are zero.
+type MissedDeliveryWindow struct {
+	PackageID      string
+	VehicleID      int
+	DeliveryTime   float64
+	LatestDelivery float64
+	Lateness       float64
+	Unscheduled    bool
+}
+
+var hardDeadlines bool
+
+// getShipmentsSubSetsForUrgentPackage restricts the next trip to shipments that
+// carry the remaining package with the earliest deadline, so urgent parcels are
+// not left for the last vehicle. It returns nil when no package has a deadline
+// or the urgent package cannot be carried at all.
+func getShipmentsSubSetsForUrgentPackage(ctx context.Context, packageList []Package, maxCarriableCapacity Capacity, explanation *PlanExplanation) [][]int {
+	urgentIdx := getMostUrgentPackage(packageList)
+	if urgentIdx < 0 {
+		return nil
+	}
+	return getShipmentsSubSetsIncludingPackages(ctx, packageList, maxCarriableCapacity, 1<<urgentIdx, explanation)
+}
+
+// getMostUrgentPackage returns the package with the earliest deadline, the
+// lowest package ID among equal deadlines, or -1 when none has a deadline.
+func getMostUrgentPackage(packageList []Package) int {
+	urgentIdx := -1
+	for i, pkg := range packageList {
+		if pkg.LatestDelivery == 0 {
+			continue
+		}
+		if urgentIdx < 0 || pkg.LatestDelivery < packageList[urgentIdx].LatestDelivery ||
+			(pkg.LatestDelivery == packageList[urgentIdx].LatestDelivery && pkg.ID < packageList[urgentIdx].ID) {
+			urgentIdx = i
+		}
+	}
+	return urgentIdx
+}
+
+// getEarliestDepartureForWindows is the earliest time a vehicle may leave so
+// that no package on the trip arrives before its earliest delivery time.
+func getEarliestDepartureForWindows(route TripRoute, packageList []Package) float64 {
+	earliestDeparture := 0.0
+	for stop, idx := range route.Stops {
+		earliestDeparture = math.Max(earliestDeparture, packageList[idx].EarliestDelivery-route.ArrivalTimes[stop])
+	}
+	return earliestDeparture
+}
+
+// findMissedDeliveryWindows lists the planned packages that arrive late,
+// followed by the unscheduled packages that have a deadline. Packages left out
+// because they are already delivered or returned do not count.
+func findMissedDeliveryWindows(trips []Trip, unscheduled []Package) []MissedDeliveryWindow {
+	var missed []MissedDeliveryWindow
+	for _, trip := range trips {
+		for _, pkg := range trip.Packages {
+			if pkg.LatestDelivery > 0 && pkg.DeliveryTime > pkg.LatestDelivery {
+				missed = append(missed, MissedDeliveryWindow{
+					PackageID:      pkg.ID,
+					VehicleID:      trip.VehicleID,
+					DeliveryTime:   pkg.DeliveryTime,
+					LatestDelivery: pkg.LatestDelivery,
+					Lateness:       pkg.DeliveryTime - pkg.LatestDelivery,
+				})
+			}
+		}
+	}
+	for _, pkg := range unscheduled {
+		if pkg.LatestDelivery > 0 && isSchedulable(pkg) {
+			missed = append(missed, MissedDeliveryWindow{PackageID: pkg.ID, LatestDelivery: pkg.LatestDelivery, Unscheduled: true})
+		}
+	}
+	return missed
+}
+
+func printMissedDeliveryWindows(missed []MissedDeliveryWindow) {
+	if len(missed) == 0 {
+		return
+	}
+
+	fmt.Println("Packages missing their delivery window:")
+	for _, window := range missed {
+		if window.Unscheduled {
+			fmt.Printf("  %s: not scheduled, latest %.2f hours\n", window.PackageID, window.LatestDelivery)
+			continue
+		}
+		fmt.Printf("  %s: Vehicle %d delivers at %.2f hours, latest %.2f hours, %.2f hours late\n",
+			window.PackageID, window.VehicleID, window.DeliveryTime, window.LatestDelivery, window.Lateness)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("delivery windows", func() {
+	Describe("getShipmentsSubSetsForUrgentPackage", func() {
+		It("should only return shipments carrying the package with the earliest deadline", func() {
+			packages := []Package{
+				{ID: "PKG1", Weight: 50, LatestDelivery: 4},
+				{ID: "PKG2", Weight: 75},
+				{ID: "PKG3", Weight: 175, LatestDelivery: 2},
+			}
+
+			Expect(getShipmentsSubSetsForUrgentPackage(context.Background(), packages, Capacity{Weight: 200}, nil)).To(Equal([][]int{{2}}))
+		})
+
+		It("should return nothing when no package has a deadline", func() {
+			packages := []Package{{ID: "PKG1", Weight: 50}, {ID: "PKG2", Weight: 75}}
+
+			Expect(getShipmentsSubSetsForUrgentPackage(context.Background(), packages, Capacity{Weight: 200}, nil)).To(BeNil())
+		})
+	})
+
+	Describe("parsePackages", func() {
+		It("should read delivery windows", func() {
+			packages, err := parsePackages([]string{"PKG1 50 30 OFR001 earliest=1 latest=2.5"}, 100)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(packages[0].EarliestDelivery).To(Equal(1.0))
+			Expect(packages[0].LatestDelivery).To(Equal(2.5))
+		})
+
+		It("should reject invalid windows", func() {
+			_, err := parsePackages([]string{"PKG1 50 30 OFR001 latest=soon"}, 100)
+			Expect(err.Error()).To(Equal("Invalid latest delivery time for package 1"))
+
+			_, err = parsePackages([]string{"PKG1 50 30 OFR001 earliest=3 latest=2"}, 100)
+			Expect(err.Error()).To(Equal("Invalid delivery window for package 1"))
+
+			_, err = parsePackages([]string{"PKG1 50 30 OFR001 colour=red"}, 100)
+			Expect(err.Error()).To(Equal("Unknown option colour for package 1"))
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with delivery windows", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			hardDeadlines = false
+			vehicleAvailabilityPath = ""
+		})
+
+		It("should dispatch the package with a deadline first", func() {
+			args := []string{"100", "3", "PKG1 50 30 OFR001 latest=1", "PKG2 75 125 OFFR0008", "PKG3 175 100 OFFR003", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(HavePrefix("Package: PKG1\n"))
+			Expect(output.String()).To(ContainSubstring("Delivery Time: 0.43 hours"))
+			Expect(output.String()).To(ContainSubstring("Delivery Time: 5.00 hours"))
+			Expect(output.String()).ToNot(ContainSubstring("Packages missing their delivery window"))
+		})
+
+		It("should hold the vehicle until the earliest delivery time", func() {
+			args := []string{"100", "1", "PKG1 50 35 OFR001 earliest=2", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Delivery Time: 2.00 hours"))
+		})
+
+		It("should report packages that miss their window", func() {
+			args := []string{"100", "3", "PKG1 50 30 OFR001 latest=1", "PKG2 75 125 OFFR0008", "PKG3 175 100 OFFR003 latest=1", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Packages missing their delivery window:\n  PKG3: Vehicle 1 delivers at 5.00 hours, latest 1.00 hours, 4.00 hours late"))
+		})
+
+		It("should reject the plan in hard deadline mode", func() {
+			hardDeadlines = true
+
+			args := []string{"100", "3", "PKG1 50 30 OFR001 latest=1", "PKG2 75 125 OFFR0008", "PKG3 175 100 OFFR003 latest=1", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Plan rejected: 1 packages miss their delivery window"))
+			Expect(output.String()).ToNot(ContainSubstring("Package: PKG1"))
+		})
+
+		It("should count an unscheduled package with a deadline as missed", func() {
+			hardDeadlines = true
+			vehicleAvailabilityPath = filepath.Join(GinkgoT().TempDir(), "vehicles.json")
+			Expect(os.WriteFile(vehicleAvailabilityPath, []byte(`[{"id": 1, "shiftEnd": 1}]`), 0644)).To(Succeed())
+
+			args := []string{"100", "2", "PKG1 50 30 OFR001", "PKG2 75 100 OFR001 latest=2", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).To(MatchError("Plan rejected: 1 packages miss their delivery window"))
+			Expect(output.String()).To(ContainSubstring("Packages missing their delivery window:\n  PKG2: not scheduled, latest 2.00 hours\n"))
+		})
+	})
+})
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const clockTimeLayout = "2006-01-02 15:04 MST"
+
+// DispatchCalendar maps the scheduler's relative hours onto wall-clock time and
+// keeps trips inside depot operating hours and driver shifts. Times of day are
+// stored as minutes after midnight; -1 means the constraint is not set.
+type DispatchCalendar struct {
+	Start    time.Time
+	OpensAt  int
+	ClosesAt int
+	ShiftEnd int
+}
+
+var (
+	dispatchStart    string
+	dispatchTimezone string
+	depotHours       string
+	driverShiftEnd   string
+)
+
+func parseDispatchCalendar(start, timezone, operatingHours, shiftEnd string) (*DispatchCalendar, error) {
+	if start == "" {
+		if operatingHours != "" || shiftEnd != "" {
+			return nil, fmt.Errorf("Depot hours and shift end require --start")
+		}
+		return nil, nil
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid timezone %s", timezone)
+	}
+
+	startTime, err := parseStartTime(start, location)
+	if err != nil {
+		return nil, err
+	}
+
+	calendar := &DispatchCalendar{Start: startTime, OpensAt: -1, ClosesAt: -1, ShiftEnd: -1}
+
+	if operatingHours != "" {
+		hours := strings.Split(operatingHours, "-")
+		if len(hours) != 2 {
+			return nil, fmt.Errorf("Invalid depot hours %s", operatingHours)
+		}
+		calendar.OpensAt, err = parseClockTime(hours[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid depot hours %s", operatingHours)
+		}
+		calendar.ClosesAt, err = parseClockTime(hours[1])
+		if err != nil || calendar.ClosesAt <= calendar.OpensAt {
+			return nil, fmt.Errorf("Invalid depot hours %s", operatingHours)
+		}
+	}
+
+	if shiftEnd != "" {
+		calendar.ShiftEnd, err = parseClockTime(shiftEnd)
+		if err != nil || calendar.ShiftEnd <= calendar.getOpeningMinute() {
+			return nil, fmt.Errorf("Invalid shift end %s", shiftEnd)
+		}
+	}
+
+	return calendar, nil
+}
+
+func parseStartTime(start string, location *time.Location) (time.Time, error) {
+	if startTime, err := time.Parse(time.RFC3339, start); err == nil {
+		return startTime.In(location), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04"} {
+		if startTime, err := time.ParseInLocation(layout, start, location); err == nil {
+			return startTime, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid start time %s", start)
+}
+
+func parseClockTime(value string) (int, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// getOpeningMinute is when the working day starts: the depot's opening, or
+// without depot hours the time of day of --start, when the shift begins.
+func (c *DispatchCalendar) getOpeningMinute() int {
+	if c.OpensAt < 0 {
+		return c.Start.Hour()*60 + c.Start.Minute()
+	}
+	return c.OpensAt
+}
+
+func (c *DispatchCalendar) toClock(hours float64) time.Time {
+	return c.Start.Add(time.Duration(math.Round(hours * float64(time.Hour))))
+}
+
+func (c *DispatchCalendar) toRelative(clock time.Time) float64 {
+	return clock.Sub(c.Start).Hours()
+}
+
+func (c *DispatchCalendar) atMinute(day time.Time, minute int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, minute, 0, 0, c.Start.Location())
+}
+
+// scheduleTrip returns the relative hour at which a vehicle that is ready at
+// readyAt can actually leave for a trip lasting tripDuration hours. Trips that
+// would leave after the depot closes or bring the driver back after the shift
+// ends move to the start of the next working day. A trip too long for any
+// working day leaves at the next day's start rather than being pushed forever.
+func (c *DispatchCalendar) scheduleTrip(readyAt, tripDuration float64) float64 {
+	if c == nil || (c.OpensAt < 0 && c.ShiftEnd < 0) {
+		return readyAt
+	}
+
+	departure := c.toClock(readyAt)
+	for {
+		opens := c.atMinute(departure, c.getOpeningMinute())
+		freshDay := !departure.After(opens)
+		if departure.Before(opens) {
+			departure = opens
+		}
+
+		fitsDepotHours := c.ClosesAt < 0 || !departure.After(c.atMinute(departure, c.ClosesAt))
+		fitsShift := c.ShiftEnd < 0 || !c.toClock(c.toRelative(departure)+tripDuration).After(c.atMinute(departure, c.ShiftEnd))
+
+		if (fitsDepotHours && fitsShift) || freshDay {
+			return c.toRelative(departure)
+		}
+
+		departure = c.atMinute(departure.AddDate(0, 0, 1), c.getOpeningMinute())
+	}
+}
+
+func (c *DispatchCalendar) formatClock(hours float64) string {
+	return c.toClock(hours).Round(time.Minute).Format(clockTimeLayout)
+}
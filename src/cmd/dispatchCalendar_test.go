@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DispatchCalendar", func() {
+	Describe("parseDispatchCalendar", func() {
+		It("should return no calendar when no start is given", func() {
+			calendar, err := parseDispatchCalendar("", "UTC", "", "")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calendar).To(BeNil())
+		})
+
+		It("should require a start time for depot hours", func() {
+			_, err := parseDispatchCalendar("", "UTC", "08:00-18:00", "")
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Depot hours and shift end require --start"))
+		})
+
+		It("should parse the start time in the given timezone", func() {
+			calendar, err := parseDispatchCalendar("2024-05-01T08:00", "Asia/Kolkata", "", "")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calendar.formatClock(1.5)).To(Equal("2024-05-01 09:30 IST"))
+		})
+
+		It("should reject invalid inputs", func() {
+			_, err := parseDispatchCalendar("tomorrow", "UTC", "", "")
+			Expect(err.Error()).To(Equal("Invalid start time tomorrow"))
+
+			_, err = parseDispatchCalendar("2024-05-01T08:00", "Mars/Olympus", "", "")
+			Expect(err.Error()).To(Equal("Invalid timezone Mars/Olympus"))
+
+			_, err = parseDispatchCalendar("2024-05-01T08:00", "UTC", "18:00-08:00", "")
+			Expect(err.Error()).To(Equal("Invalid depot hours 18:00-08:00"))
+
+			_, err = parseDispatchCalendar("2024-05-01T08:00", "UTC", "08:00-18:00", "07:00")
+			Expect(err.Error()).To(Equal("Invalid shift end 07:00"))
+		})
+	})
+
+	Describe("scheduleTrip", func() {
+		It("should leave the departure alone without constraints", func() {
+			var calendar *DispatchCalendar
+			Expect(calendar.scheduleTrip(2.5, 3)).To(Equal(2.5))
+		})
+
+		It("should wait for the depot to open", func() {
+			calendar, _ := parseDispatchCalendar("2024-05-01T06:00", "UTC", "08:00-18:00", "")
+			Expect(calendar.scheduleTrip(0, 3)).To(Equal(2.0))
+		})
+
+		It("should push trips that leave after closing to the next day", func() {
+			calendar, _ := parseDispatchCalendar("2024-05-01T08:00", "UTC", "08:00-18:00", "")
+			Expect(calendar.formatClock(calendar.scheduleTrip(10.5, 1))).To(Equal("2024-05-02 08:00 UTC"))
+		})
+
+		It("should push trips that end after the shift to the next day", func() {
+			calendar, _ := parseDispatchCalendar("2024-05-01T08:00", "UTC", "08:00-18:00", "17:00")
+
+			Expect(calendar.scheduleTrip(6, 3)).To(Equal(6.0))
+			Expect(calendar.formatClock(calendar.scheduleTrip(7, 3))).To(Equal("2024-05-02 08:00 UTC"))
+		})
+
+		It("should push trips past the shift end to the next shift start without depot hours", func() {
+			calendar, _ := parseDispatchCalendar("2024-05-01T09:30", "UTC", "", "17:00")
+
+			Expect(calendar.scheduleTrip(5, 2)).To(Equal(5.0))
+			Expect(calendar.formatClock(calendar.scheduleTrip(6, 2))).To(Equal("2024-05-02 09:30 UTC"))
+		})
+
+		It("should not push a trip longer than a working day forever", func() {
+			calendar, _ := parseDispatchCalendar("2024-05-01T08:00", "UTC", "08:00-18:00", "17:00")
+			Expect(calendar.formatClock(calendar.scheduleTrip(2, 12))).To(Equal("2024-05-02 08:00 UTC"))
+		})
+	})
+})
+
+var _ = Describe("CalculateTimeAndCostCmd with wall-clock times", func() {
+	var (
+		stdout *os.File
+		r, w   *os.File
+		output bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		stdout = os.Stdout
+		r, w, _ = os.Pipe()
+		os.Stdout = w
+		output.Reset()
+	})
+
+	AfterEach(func() {
+		w.Close()
+		os.Stdout = stdout
+		dispatchStart = ""
+		dispatchTimezone = "Local"
+		depotHours = ""
+		driverShiftEnd = ""
+	})
+
+	It("should print departure and ETA clock times", func() {
+		dispatchStart = "2024-05-01T16:00"
+		dispatchTimezone = "UTC"
+		depotHours = "08:00-18:00"
+		driverShiftEnd = "19:00"
+
+		args := []string{"100", "3", "PKG1 50 30 OFR001", "PKG2 75 125 OFFR0008", "PKG3 175 100 OFFR003", "1", "70", "200"}
+		err := calculateTimeAndCostCmd.RunE(nil, args)
+
+		w.Close()
+		output.ReadFrom(r)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(output.String()).To(ContainSubstring("  Departure: 2024-05-01 16:00 UTC\n  ETA: 2024-05-01 17:26 UTC"))
+		Expect(output.String()).To(ContainSubstring("  Departure: 2024-05-02 08:00 UTC\n  ETA: 2024-05-02 09:47 UTC"))
+	})
+
+	It("should return an error for an invalid start time", func() {
+		dispatchStart = "soon"
+
+		args := []string{"100", "1", "PKG1 50 30 OFR001", "1", "70", "200"}
+		err := calculateTimeAndCostCmd.RunE(nil, args)
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("Invalid start time soon"))
+	})
+})
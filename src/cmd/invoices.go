@@ -0,0 +1,382 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"courier_service/config"
+	"courier_service/store"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	invoicePeriod    string
+	invoiceOutputDir string
+	invoiceFormats   []string
+)
+
+var invoiceWriters = map[string]func(w io.Writer, invoice store.Invoice) error{
+	"json": writeInvoiceJSON,
+	"csv":  writeInvoiceCSV,
+	"html": writeInvoiceHTML,
+}
+
+// getInvoicePeriod names the period a quote falls in: its day, its ISO week
+// or its month.
+func getInvoicePeriod(at time.Time, period string) (string, error) {
+	switch period {
+	case "day":
+		return at.Format("2006-01-02"), nil
+	case "week":
+		year, week := at.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week), nil
+	case "month":
+		return at.Format("2006-01"), nil
+	}
+	return "", fmt.Errorf("Invalid invoice period %s", period)
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// buildInvoices groups the latest quote of every customer package not yet on
+// an invoice by customer and period. Invoices come out ordered by period and
+// then customer, with their lines ordered by quote time, and have no number
+// until they are saved. Quotes without a customer are counted but left out.
+func buildInvoices(repository store.Repository, period, onlyCustomerID string, tax config.Tax, at time.Time) ([]store.Invoice, int, error) {
+	invoiced := make(map[string]bool)
+	existing, err := repository.ListInvoices()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, invoice := range existing {
+		for _, line := range invoice.Lines {
+			invoiced[line.PackageID] = true
+		}
+	}
+
+	quotes, err := repository.ListQuotes()
+	if err != nil {
+		return nil, 0, err
+	}
+	latest := make(map[string]store.Quote)
+	var packageIDs []string
+	for _, quote := range quotes {
+		if _, found := latest[quote.PackageID]; !found {
+			packageIDs = append(packageIDs, quote.PackageID)
+		}
+		latest[quote.PackageID] = quote
+	}
+
+	type invoiceKey struct{ period, customerID string }
+	grouped := make(map[invoiceKey]*store.Invoice)
+	var keys []invoiceKey
+	withoutCustomer := 0
+	for _, packageID := range packageIDs {
+		quote := latest[packageID]
+		if invoiced[packageID] {
+			continue
+		}
+		if quote.CustomerID == "" {
+			withoutCustomer++
+			continue
+		}
+		if onlyCustomerID != "" && quote.CustomerID != onlyCustomerID {
+			continue
+		}
+
+		pkg, err := repository.GetPackage(packageID)
+		if err != nil && err != store.ErrNotFound {
+			return nil, 0, err
+		}
+		if pkg.Status == store.StatusReturned {
+			continue
+		}
+		name, err := getInvoicePeriod(quote.QuotedAt, period)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		key := invoiceKey{name, quote.CustomerID}
+		invoice, found := grouped[key]
+		if !found {
+			invoice = &store.Invoice{CustomerID: quote.CustomerID, Period: name, IssuedAt: at, TaxName: tax.Name, TaxRate: tax.Rate}
+			if customer, err := repository.GetCustomer(quote.CustomerID); err == nil {
+				invoice.CustomerName = customer.Name
+			}
+			grouped[key] = invoice
+			keys = append(keys, key)
+		}
+		invoice.Lines = append(invoice.Lines, store.InvoiceLine{
+			PackageID:        packageID,
+			QuotedAt:         quote.QuotedAt,
+			Weight:           pkg.Weight,
+			Distance:         pkg.Distance,
+			OfferCode:        pkg.OfferCode,
+			TotalCost:        quote.TotalCost,
+			ContractDiscount: quote.ContractDiscount,
+			Discount:         quote.Discount - quote.ContractDiscount,
+			FinalCost:        quote.FinalCost,
+		})
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].period != keys[j].period {
+			return keys[i].period < keys[j].period
+		}
+		return keys[i].customerID < keys[j].customerID
+	})
+
+	invoices := make([]store.Invoice, 0, len(keys))
+	for _, key := range keys {
+		invoice := grouped[key]
+		sort.SliceStable(invoice.Lines, func(i, j int) bool {
+			return invoice.Lines[i].QuotedAt.Before(invoice.Lines[j].QuotedAt)
+		})
+		for _, line := range invoice.Lines {
+			invoice.Subtotal += line.TotalCost
+			invoice.ContractDiscount += line.ContractDiscount
+			invoice.Discount += line.Discount
+			invoice.Net += line.FinalCost
+		}
+		invoice.Subtotal = roundAmount(invoice.Subtotal)
+		invoice.ContractDiscount = roundAmount(invoice.ContractDiscount)
+		invoice.Discount = roundAmount(invoice.Discount)
+		invoice.Net = roundAmount(invoice.Net)
+		invoice.Tax = roundAmount(invoice.Net * invoice.TaxRate)
+		invoice.Total = roundAmount(invoice.Net + invoice.Tax)
+		invoices = append(invoices, *invoice)
+	}
+	return invoices, withoutCustomer, nil
+}
+
+func writeInvoiceJSON(w io.Writer, invoice store.Invoice) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(invoice)
+}
+
+// writeInvoiceCSV writes one row per package followed by the invoice totals,
+// which leave the package columns empty.
+func writeInvoiceCSV(w io.Writer, invoice store.Invoice) error {
+	formatAmount := func(amount float64) string { return strconv.FormatFloat(amount, 'f', 2, 64) }
+
+	writer := csv.NewWriter(w)
+	header := []string{"invoice", "customer_id", "period", "package_id", "quoted_at", "weight", "distance", "offer_code", "total_cost", "contract_discount", "discount", "final_cost"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, line := range invoice.Lines {
+		record := []string{
+			invoice.Number,
+			invoice.CustomerID,
+			invoice.Period,
+			line.PackageID,
+			line.QuotedAt.Format(time.RFC3339),
+			strconv.Itoa(line.Weight),
+			strconv.Itoa(line.Distance),
+			line.OfferCode,
+			formatAmount(line.TotalCost),
+			formatAmount(line.ContractDiscount),
+			formatAmount(line.Discount),
+			formatAmount(line.FinalCost),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	totals := [][]string{
+		{"subtotal", formatAmount(invoice.Subtotal)},
+		{"contract_discount", formatAmount(invoice.ContractDiscount)},
+		{"discount", formatAmount(invoice.Discount)},
+		{"net", formatAmount(invoice.Net)},
+		{"tax", formatAmount(invoice.Tax)},
+		{"total", formatAmount(invoice.Total)},
+	}
+	for _, total := range totals {
+		record := make([]string, len(header))
+		record[0], record[1], record[2] = invoice.Number, invoice.CustomerID, invoice.Period
+		record[3], record[len(record)-1] = total[0], total[1]
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"amount":  func(value float64) string { return fmt.Sprintf("%.2f", value) },
+	"percent": func(value float64) string { return fmt.Sprintf("%.4g%%", value*100) },
+	"date":    func(value time.Time) string { return value.Format("2006-01-02") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-top: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.totals td { border: none; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Number}}</h1>
+<p>Customer: {{.CustomerID}}{{if .CustomerName}} &middot; {{.CustomerName}}{{end}}<br>
+Period: {{.Period}}<br>
+Issued: {{date .IssuedAt}}</p>
+<table>
+<tr><th>Package</th><th>Quoted</th><th>Weight (kg)</th><th>Distance (km)</th><th>Offer</th><th>Cost</th><th>Contract discount</th><th>Discount</th><th>Amount</th></tr>
+{{- range .Lines}}
+<tr><td>{{.PackageID}}</td><td>{{date .QuotedAt}}</td><td>{{.Weight}}</td><td>{{.Distance}}</td><td>{{.OfferCode}}</td><td>{{amount .TotalCost}}</td><td>{{amount .ContractDiscount}}</td><td>{{amount .Discount}}</td><td>{{amount .FinalCost}}</td></tr>
+{{- end}}
+</table>
+<table class="totals">
+<tr><td>Subtotal</td><td>{{amount .Subtotal}}</td></tr>
+<tr><td>Contract discount</td><td>-{{amount .ContractDiscount}}</td></tr>
+<tr><td>Discount</td><td>-{{amount .Discount}}</td></tr>
+<tr><td>Net</td><td>{{amount .Net}}</td></tr>
+<tr><td>{{if .TaxName}}{{.TaxName}}{{else}}Tax{{end}} ({{percent .TaxRate}})</td><td>{{amount .Tax}}</td></tr>
+<tr><th>Total</th><th>{{amount .Total}}</th></tr>
+</table>
+</body>
+</html>
+`))
+
+func writeInvoiceHTML(w io.Writer, invoice store.Invoice) error {
+	return invoiceTemplate.Execute(w, invoice)
+}
+
+// exportInvoice writes the invoice to <number>.<format> in dir for every
+// format asked for.
+func exportInvoice(dir string, formats []string, invoice store.Invoice) error {
+	for _, format := range formats {
+		file, err := os.Create(filepath.Join(dir, invoice.Number+"."+format))
+		if err != nil {
+			return fmt.Errorf("Unable to create invoice file: %s", err)
+		}
+		err = invoiceWriters[format](file, invoice)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var invoiceCmd = &cobra.Command{
+	Use:   "invoice",
+	Short: "Invoice customers for their quoted packages",
+	Long:  `This command bills every customer for the packages quoted to it that are not on an invoice yet. Returned packages are not billed. Packages are grouped by customer and by the day, week or month of their latest quote, each group gets the next invoice number, and every invoice is written as JSON, CSV and printable HTML with its per-package breakdown, discounts, tax and total.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, format := range invoiceFormats {
+			if _, found := invoiceWriters[format]; !found {
+				return fmt.Errorf("Invalid invoice format %s", format)
+			}
+		}
+		if _, err := getInvoicePeriod(time.Now(), invoicePeriod); err != nil {
+			return err
+		}
+
+		repository, err := openRequiredStore()
+		if err != nil {
+			return err
+		}
+		defer repository.Close()
+
+		if customerID != "" {
+			if _, err := loadCustomer(repository, customerID); err != nil {
+				return err
+			}
+		}
+
+		invoices, withoutCustomer, err := buildInvoices(repository, invoicePeriod, customerID, config.GetTax(), time.Now())
+		if err != nil {
+			return err
+		}
+		if len(invoices) == 0 {
+			fmt.Println("No packages to invoice")
+		} else if err := os.MkdirAll(invoiceOutputDir, 0755); err != nil {
+			return fmt.Errorf("Unable to create invoice directory: %s", err)
+		}
+
+		for _, invoice := range invoices {
+			invoice.Number, err = repository.SaveInvoice(invoice)
+			if err != nil {
+				return err
+			}
+			if err := exportInvoice(invoiceOutputDir, invoiceFormats, invoice); err != nil {
+				return err
+			}
+			fmt.Printf("%s  %s  %s  %d packages  total %.2f\n", invoice.Number, invoice.CustomerID, invoice.Period, len(invoice.Lines), invoice.Total)
+		}
+
+		if withoutCustomer > 0 {
+			fmt.Printf("%d quoted packages have no customer and were not invoiced\n", withoutCustomer)
+		}
+		return nil
+	},
+}
+
+var payInvoiceCmd = &cobra.Command{
+	Use:   "payInvoice",
+	Short: "Record an invoice as paid",
+	Long:  `This command records that a customer has paid an invoice. The packages on a paid invoice no longer count towards the customer's credit limit.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("Usage: courier_service payInvoice <invoiceNumber> --store <store_file>")
+		}
+
+		repository, err := openRequiredStore()
+		if err != nil {
+			return err
+		}
+		defer repository.Close()
+
+		invoice, err := repository.GetInvoice(args[0])
+		if err == store.ErrNotFound {
+			return fmt.Errorf("Invoice %s not found", args[0])
+		}
+		if err != nil {
+			return err
+		}
+		if invoice.PaidAt != nil {
+			return fmt.Errorf("Invoice %s is already paid", invoice.Number)
+		}
+
+		paidAt := time.Now()
+		invoice.PaidAt = &paidAt
+		if _, err := repository.SaveInvoice(invoice); err != nil {
+			return err
+		}
+
+		fmt.Printf("Invoice %s (%s, total %.2f) paid\n", invoice.Number, invoice.CustomerID, invoice.Total)
+		return nil
+	},
+}
+
+func init() {
+	invoiceCmd.Flags().StringVar(&invoicePeriod, "period", "month", "Period each invoice covers: day, week or month")
+	invoiceCmd.Flags().StringVar(&invoiceOutputDir, "output-dir", "invoices", "Directory the invoice files are written to")
+	invoiceCmd.Flags().StringSliceVar(&invoiceFormats, "format", []string{"json", "csv", "html"}, "Invoice file formats: json, csv and/or html")
+	invoiceCmd.Flags().StringVar(&customerID, "customer", "", "Only invoice this customer")
+	rootCmd.AddCommand(invoiceCmd)
+	rootCmd.AddCommand(payInvoiceCmd)
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"courier_service/config"
+	"courier_service/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("invoices", func() {
+	may1 := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	may20 := time.Date(2024, 5, 20, 8, 0, 0, 0, time.UTC)
+	june3 := time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC)
+
+	quote := func(repository store.Repository, packageID, customerID string, totalCost, contractDiscount, discount float64, at time.Time) {
+		Expect(repository.SavePackage(store.Package{ID: packageID, Weight: 50, Distance: 40, OfferCode: "OFR003", CustomerID: customerID})).To(Succeed())
+		Expect(repository.SaveQuote(store.Quote{PackageID: packageID, CustomerID: customerID, TotalCost: totalCost, ContractDiscount: contractDiscount, Discount: discount, FinalCost: totalCost - discount, QuotedAt: at})).To(Succeed())
+	}
+
+	Describe("getInvoicePeriod", func() {
+		It("should name the day, ISO week or month of a quote", func() {
+			Expect(getInvoicePeriod(may20, "day")).To(Equal("2024-05-20"))
+			Expect(getInvoicePeriod(may20, "week")).To(Equal("2024-W21"))
+			Expect(getInvoicePeriod(may20, "month")).To(Equal("2024-05"))
+
+			_, err := getInvoicePeriod(may20, "year")
+			Expect(err).To(MatchError("Invalid invoice period year"))
+		})
+	})
+
+	Describe("buildInvoices", func() {
+		var repository store.Repository
+
+		BeforeEach(func() {
+			repository = store.NewMemoryStore()
+			repository.SaveCustomer(store.Customer{ID: "ACME", Name: "Acme Ltd"})
+			quote(repository, "PKG1", "ACME", 700, 35, 68.25, may20)
+			quote(repository, "PKG2", "GLOBEX", 300, 0, 0, may1)
+			quote(repository, "PKG3", "ACME", 800, 40, 40, may1)
+			quote(repository, "PKG4", "ACME", 200, 0, 0, june3)
+			quote(repository, "PKG5", "", 175, 0, 0, may1)
+		})
+
+		It("should group the latest quotes by period and customer", func() {
+			quote(repository, "PKG3", "ACME", 800, 40, 78, may1)
+
+			invoices, withoutCustomer, err := buildInvoices(repository, "month", "", config.Tax{Name: "VAT", Rate: 0.2}, june3)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(withoutCustomer).To(Equal(1))
+			Expect(invoices).To(HaveLen(3))
+			Expect([]string{invoices[0].CustomerID, invoices[1].CustomerID, invoices[2].CustomerID}).To(Equal([]string{"ACME", "GLOBEX", "ACME"}))
+
+			acme := invoices[0]
+			Expect(acme.CustomerName).To(Equal("Acme Ltd"))
+			Expect(acme.Period).To(Equal("2024-05"))
+			Expect(acme.Lines).To(HaveLen(2))
+			Expect(acme.Lines[0].PackageID).To(Equal("PKG3"))
+			Expect(acme.Lines[0].Discount).To(Equal(38.0))
+			Expect(acme.Subtotal).To(Equal(1500.0))
+			Expect(acme.ContractDiscount).To(Equal(75.0))
+			Expect(acme.Discount).To(Equal(71.25))
+			Expect(acme.Net).To(Equal(1353.75))
+			Expect(acme.Tax).To(Equal(270.75))
+			Expect(acme.Total).To(Equal(1624.5))
+		})
+
+		It("should leave out packages already invoiced", func() {
+			invoices, _, _ := buildInvoices(repository, "month", "ACME", config.Tax{}, june3)
+			Expect(invoices).To(HaveLen(2))
+			for _, invoice := range invoices {
+				repository.SaveInvoice(invoice)
+			}
+
+			invoices, _, err := buildInvoices(repository, "month", "", config.Tax{}, june3)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(invoices).To(HaveLen(1))
+			Expect(invoices[0].CustomerID).To(Equal("GLOBEX"))
+		})
+		It("should leave out returned packages", func() {
+			for _, status := range []string{store.StatusQuoted, store.StatusScheduled, store.StatusOutForDelivery, store.StatusFailed, store.StatusReturned} {
+				_, err := repository.UpdatePackageStatus("PKG3", status, may20)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			invoices, _, err := buildInvoices(repository, "month", "ACME", config.Tax{}, june3)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(invoices).To(HaveLen(2))
+			Expect(invoices[0].Lines).To(HaveLen(1))
+			Expect(invoices[0].Lines[0].PackageID).To(Equal("PKG1"))
+		})
+	})
+
+	Describe("invoice command", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+			dir    string
+		)
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+			storePath = filepath.Join(dir, "store.jsonl")
+			invoiceOutputDir = filepath.Join(dir, "invoices")
+			invoicePeriod, invoiceFormats = "month", []string{"json", "csv", "html"}
+
+			repository, err := store.NewFileStore(storePath)
+			Expect(err).ToNot(HaveOccurred())
+			repository.SaveCustomer(store.Customer{ID: "ACME", Name: "Acme & Sons"})
+			quote(repository, "PKG1", "ACME", 700, 35, 68.25, may20)
+			quote(repository, "PKG2", "ACME", 200, 0, 0, june3)
+			repository.Close()
+
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			storePath, customerID, invoicePeriod, invoiceOutputDir, invoiceFormats = "", "", "", "", nil
+		})
+
+		It("should number the invoices and write every format", func() {
+			err := invoiceCmd.RunE(nil, nil)
+
+			w.Close()
+			output.ReadFrom(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(Equal("INV-000001  ACME  2024-05  1 packages  total 631.75\nINV-000002  ACME  2024-06  1 packages  total 200.00\n"))
+
+			csvContent, err := os.ReadFile(filepath.Join(invoiceOutputDir, "INV-000001.csv"))
+			Expect(err).ToNot(HaveOccurred())
+			lines := strings.Split(strings.TrimSpace(string(csvContent)), "\n")
+			Expect(lines[1]).To(Equal("INV-000001,ACME,2024-05,PKG1,2024-05-20T08:00:00Z,50,40,OFR003,700.00,35.00,33.25,631.75"))
+			Expect(lines[len(lines)-1]).To(Equal("INV-000001,ACME,2024-05,total,,,,,,,,631.75"))
+
+			htmlContent, _ := os.ReadFile(filepath.Join(invoiceOutputDir, "INV-000001.html"))
+			Expect(string(htmlContent)).To(ContainSubstring("Acme &amp; Sons"))
+			Expect(string(htmlContent)).To(ContainSubstring("<td>PKG1</td>"))
+
+			jsonContent, _ := os.ReadFile(filepath.Join(invoiceOutputDir, "INV-000002.json"))
+			Expect(string(jsonContent)).To(ContainSubstring(`"number": "INV-000002"`))
+		})
+
+		It("should not invoice a package twice", func() {
+			Expect(invoiceCmd.RunE(nil, nil)).To(Succeed())
+			Expect(invoiceCmd.RunE(nil, nil)).To(Succeed())
+
+			w.Close()
+			output.ReadFrom(r)
+			Expect(output.String()).To(HaveSuffix("No packages to invoice\n"))
+		})
+
+		It("should reject an unknown format or period", func() {
+			invoiceFormats = []string{"pdf"}
+			Expect(invoiceCmd.RunE(nil, nil)).To(MatchError("Invalid invoice format pdf"))
+
+			invoiceFormats, invoicePeriod = []string{"json"}, "year"
+			Expect(invoiceCmd.RunE(nil, nil)).To(MatchError("Invalid invoice period year"))
+		})
+	})
+})
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Depot is a hub with its own fleet. A depot is located either by coordinates
+// or by a road network node; when both are given the node is used for roads
+// and the coordinates for straight-line routing.
+type Depot struct {
+	ID        string   `json:"id"`
+	Latitude  *float64 `json:"lat"`
+	Longitude *float64 `json:"lon"`
+	Node      string   `json:"node"`
+	Vehicles  int      `json:"vehicles"`
+}
+
+type DepotPlan struct {
+	Depot          Depot
+	Packages       []Package
+	Trips          []Trip
+	Unscheduled    []Package
+	Moved          []MovedShipment
+	FirstVehicleID int
+	NumVehicles    int
+}
+
+var depotsFilePath string
+
+func loadDepots(path string) ([]Depot, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read depots file: %s", err)
+	}
+
+	var depots []Depot
+	if err := json.Unmarshal(content, &depots); err != nil {
+		return nil, fmt.Errorf("Invalid depots file: %s", err)
+	}
+	if len(depots) == 0 {
+		return nil, fmt.Errorf("Depots file defines no depots")
+	}
+
+	seen := make(map[string]bool)
+	for _, depot := range depots {
+		if depot.ID == "" || seen[depot.ID] {
+			return nil, fmt.Errorf("Depot IDs must be present and unique")
+		}
+		seen[depot.ID] = true
+
+		if depot.Vehicles <= 0 {
+			return nil, fmt.Errorf("Invalid number of vehicles for depot %s", depot.ID)
+		}
+		if (depot.Latitude == nil) != (depot.Longitude == nil) || (depot.Latitude == nil && depot.Node == "") {
+			return nil, fmt.Errorf("Depot %s needs lat and lon or a road network node", depot.ID)
+		}
+	}
+
+	return depots, nil
+}
+
+func (d Depot) getLocation() *GeoPoint {
+	if d.Latitude == nil {
+		return nil
+	}
+	return &GeoPoint{Latitude: *d.Latitude, Longitude: *d.Longitude}
+}
+
+func (d Depot) getRoadNode(network *RoadNetwork) string {
+	if d.Node != "" {
+		return d.Node
+	}
+	return network.nearestNode(*d.getLocation())
+}
+
+// assignPackagesToDepots groups packages by the depot that will ship them. A
+// package's depot= option wins; otherwise it goes to the depot nearest by road,
+// then by straight line, and packages without any location go to the first
+// depot.
+func assignPackagesToDepots(packages []Package, depots []Depot, network *RoadNetwork) ([][]Package, error) {
+	groups := make([][]Package, len(depots))
+
+	for _, pkg := range packages {
+		if network != nil && pkg.RoadNode == "" && pkg.Location != nil {
+			pkg.RoadNode = network.nearestNode(*pkg.Location)
+		}
+
+		depotIdx, err := getBestDepot(pkg, depots, network)
+		if err != nil {
+			return nil, err
+		}
+		pkg.DepotID = depots[depotIdx].ID
+		groups[depotIdx] = append(groups[depotIdx], pkg)
+	}
+
+	return groups, nil
+}
+
+func getBestDepot(pkg Package, depots []Depot, network *RoadNetwork) (int, error) {
+	if pkg.DepotID != "" {
+		for i, depot := range depots {
+			if depot.ID == pkg.DepotID {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("Unknown depot %s for package %s", pkg.DepotID, pkg.ID)
+	}
+
+	bestIdx, bestDistance := 0, math.Inf(1)
+	for i, depot := range depots {
+		distance := math.Inf(1)
+		if network != nil && pkg.RoadNode != "" {
+			if roadDistance, found := network.shortestDistance(depot.getRoadNode(network), pkg.RoadNode); found {
+				distance = roadDistance
+			}
+		} else if pkg.Location != nil && depot.getLocation() != nil {
+			distance = haversineDistance(*depot.getLocation(), *pkg.Location)
+		}
+		if distance < bestDistance {
+			bestIdx, bestDistance = i, distance
+		}
+	}
+
+	return bestIdx, nil
+}
+
+// planDepots plans every depot separately with its own fleet. Vehicle IDs run
+// on across depots so they stay unique in the consolidated plan. Packages on
+// the road network are priced again with price by their road distance.
+func planDepots(ctx context.Context, packages []Package, depots []Depot, network *RoadNetwork, maxSpeed, maxLoadCapacity, baseDeliveryCost int, price func(pkg *Package) error, options SchedulerOptions) ([]DepotPlan, error) {
+	groups, err := assignPackagesToDepots(packages, depots, network)
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []DepotPlan
+	firstVehicleID := 1
+
+	for i, depot := range depots {
+		depotOptions := options
+		depotOptions.Depot = depot.getLocation()
+
+		if network != nil {
+			depotOptions.Roads = network
+			depotOptions.DepotNode = depot.getRoadNode(network)
+			if _, found := network.Nodes[depotOptions.DepotNode]; !found {
+				return nil, fmt.Errorf("Unknown depot node %s", depotOptions.DepotNode)
+			}
+			for j := range groups[i] {
+				if err := resolvePackageRoadNode(network, &groups[i][j], depotOptions.DepotNode); err != nil {
+					return nil, err
+				}
+				if distance, found := getRoadDistance(network, depotOptions.DepotNode, groups[i][j]); found {
+					groups[i][j].Distance = distance
+					if err := price(&groups[i][j]); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		depotOptions.Vehicles, depotOptions.Breakdowns = getDepotVehicles(options, firstVehicleID, depot.Vehicles)
+		if options.Explanation != nil {
+			options.Explanation.Context = "Depot " + depot.ID
+			options.Explanation.VehicleOffset = firstVehicleID - 1
+		}
+		if options.Optimiser != nil {
+			options.Optimiser.Context = "Depot " + depot.ID
+		}
+
+		trips, unscheduled, moved := planFleet(ctx, groups[i], depot.Vehicles, maxSpeed, maxLoadCapacity, baseDeliveryCost, depotOptions)
+		for j := range trips {
+			trips[j].VehicleID += firstVehicleID - 1
+			trips[j].DepotID = depot.ID
+		}
+		for j := range moved {
+			moved[j].FromVehicle += firstVehicleID - 1
+			if moved[j].ToVehicle != 0 {
+				moved[j].ToVehicle += firstVehicleID - 1
+			}
+		}
+
+		plans = append(plans, DepotPlan{Depot: depot, Packages: groups[i], Trips: trips, Unscheduled: unscheduled, Moved: moved, FirstVehicleID: firstVehicleID, NumVehicles: depot.Vehicles})
+		firstVehicleID += depot.Vehicles
+	}
+
+	return plans, nil
+}
+
+// getDepotVehicles picks out the availability and breakdowns of one depot's
+// fleet and renumbers its vehicles from 1, as the scheduler expects.
+func getDepotVehicles(options SchedulerOptions, firstVehicleID, numVehicles int) ([]Vehicle, []Breakdown) {
+	isDepotVehicle := func(vehicleID int) bool {
+		return vehicleID >= firstVehicleID && vehicleID < firstVehicleID+numVehicles
+	}
+
+	var vehicles []Vehicle
+	for _, vehicle := range options.Vehicles {
+		if isDepotVehicle(vehicle.ID) {
+			vehicle.ID -= firstVehicleID - 1
+			vehicles = append(vehicles, vehicle)
+		}
+	}
+
+	var breakdowns []Breakdown
+	for _, breakdown := range options.Breakdowns {
+		if isDepotVehicle(breakdown.VehicleID) {
+			breakdown.VehicleID -= firstVehicleID - 1
+			breakdowns = append(breakdowns, breakdown)
+		}
+	}
+
+	return vehicles, breakdowns
+}
+
+func flattenDepotPlans(plans []DepotPlan) ([]Trip, int) {
+	var trips []Trip
+	numVehicles := 0
+	for _, plan := range plans {
+		trips = append(trips, plan.Trips...)
+		numVehicles += plan.NumVehicles
+	}
+	return trips, numVehicles
+}
+
+func getDepotPlanChanges(plans []DepotPlan) ([]Package, []MovedShipment) {
+	var unscheduled []Package
+	var moved []MovedShipment
+	for _, plan := range plans {
+		unscheduled = append(unscheduled, plan.Unscheduled...)
+		moved = append(moved, plan.Moved...)
+	}
+	return unscheduled, moved
+}
+
+func printDepotPlans(plans []DepotPlan, fleet FleetCapacity, calendar *DispatchCalendar) {
+	for _, plan := range plans {
+		fmt.Printf("Depot: %s\n\n", plan.Depot.ID)
+		printTripDetails(plan.Trips, fleet, calendar)
+	}
+}
+
+// printDepotSummary totals each depot's plan. Revenue counts only the
+// packages on a trip, so unscheduled ones earn nothing.
+func printDepotSummary(plans []DepotPlan) {
+	fmt.Println("Depot summary:")
+
+	totalPackages, totalVehicles, totalTrips := 0, 0, 0
+	totalMakespan, totalRevenue := 0.0, 0.0
+	for _, plan := range plans {
+		makespan := summariseSchedule(plan.Trips, 0).Makespan
+		revenue := 0.0
+		for _, trip := range plan.Trips {
+			for _, pkg := range trip.Packages {
+				revenue += pkg.FinalCost
+			}
+		}
+
+		fmt.Printf("  %s: %d packages, %d vehicles, %d trips, makespan %.2f hours, revenue %.2f\n",
+			plan.Depot.ID, len(plan.Packages), plan.NumVehicles, len(plan.Trips), makespan, revenue)
+
+		totalPackages += len(plan.Packages)
+		totalVehicles += plan.NumVehicles
+		totalTrips += len(plan.Trips)
+		totalMakespan = math.Max(totalMakespan, makespan)
+		totalRevenue += revenue
+	}
+
+	fmt.Printf("  Total: %d packages, %d vehicles, %d trips, makespan %.2f hours, revenue %.2f\n",
+		totalPackages, totalVehicles, totalTrips, totalMakespan, totalRevenue)
+	fmt.Println()
+}
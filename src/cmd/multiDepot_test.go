@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const testDepotsJSON = `[
+	{"id": "NORTH", "lat": 1, "lon": 0, "vehicles": 1},
+	{"id": "SOUTH", "lat": -1, "lon": 0, "vehicles": 1}
+]`
+
+var _ = Describe("multi-depot dispatch", func() {
+	writeDepots := func(content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), "depots.json")
+		Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+		return path
+	}
+
+	Describe("loadDepots", func() {
+		It("should reject depots without a location", func() {
+			_, err := loadDepots(writeDepots(`[{"id": "NORTH", "vehicles": 1}]`))
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Depot NORTH needs lat and lon or a road network node"))
+		})
+
+		It("should reject duplicate depots", func() {
+			_, err := loadDepots(writeDepots(`[{"id": "A", "node": "N", "vehicles": 1}, {"id": "A", "node": "M", "vehicles": 1}]`))
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Depot IDs must be present and unique"))
+		})
+	})
+
+	Describe("assignPackagesToDepots", func() {
+		var depots []Depot
+
+		BeforeEach(func() {
+			var err error
+			depots, err = loadDepots(writeDepots(testDepotsJSON))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should send packages to the nearest depot unless one is configured", func() {
+			packages := []Package{
+				{ID: "PKG1", Location: &GeoPoint{1.1, 0}},
+				{ID: "PKG2", Location: &GeoPoint{-1.2, 0}},
+				{ID: "PKG3", Location: &GeoPoint{1.2, 0}, DepotID: "SOUTH"},
+				{ID: "PKG4"},
+			}
+
+			groups, err := assignPackagesToDepots(packages, depots, nil)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(getPackageIDs(groups[0])).To(Equal([]string{"PKG1", "PKG4"}))
+			Expect(getPackageIDs(groups[1])).To(Equal([]string{"PKG2", "PKG3"}))
+		})
+
+		It("should reject unknown depots", func() {
+			_, err := assignPackagesToDepots([]Package{{ID: "PKG1", DepotID: "EAST"}}, depots, nil)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Unknown depot EAST for package PKG1"))
+		})
+	})
+
+	Describe("printDepotSummary", func() {
+		It("should not count unscheduled packages as revenue", func() {
+			stdout := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = stdout }()
+
+			scheduled := Package{ID: "PKG1", FinalCost: 100}
+			unscheduled := Package{ID: "PKG2", FinalCost: 250}
+			printDepotSummary([]DepotPlan{{
+				Depot:       Depot{ID: "NORTH"},
+				Packages:    []Package{scheduled, unscheduled},
+				Trips:       []Trip{{VehicleID: 1, Return: 1, Packages: []Package{scheduled}}},
+				Unscheduled: []Package{unscheduled},
+				NumVehicles: 1,
+			}})
+
+			w.Close()
+			var output bytes.Buffer
+			output.ReadFrom(r)
+
+			Expect(output.String()).To(ContainSubstring("NORTH: 2 packages, 1 vehicles, 1 trips, makespan 1.00 hours, revenue 100.00\n"))
+			Expect(output.String()).To(ContainSubstring("Total: 2 packages, 1 vehicles, 1 trips, makespan 1.00 hours, revenue 100.00\n"))
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with depots", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			depotsFilePath = writeDepots(testDepotsJSON)
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			depotsFilePath = ""
+		})
+
+		It("should plan each depot and print a consolidated summary", func() {
+			args := []string{"100", "3", "PKG1 50 11 NA lat=1.1 lon=0", "PKG2 50 22 NA lat=-1.2 lon=0", "PKG3 60 50 NA depot=SOUTH", "0", "50", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(HavePrefix("Depot: NORTH\n\nPackage: PKG1\n  Vehicle: 1\n"))
+			Expect(output.String()).To(ContainSubstring("Depot: SOUTH\n\nPackage: PKG2\n  Vehicle: 2\n"))
+			Expect(output.String()).To(ContainSubstring("Delivery Time: 1.00 hours"))
+			Expect(output.String()).To(MatchRegexp(`NORTH: 1 packages, 1 vehicles, 1 trips, makespan 0\.44 hours`))
+			Expect(output.String()).To(MatchRegexp(`SOUTH: 2 packages, 1 vehicles, 1 trips, makespan 2\.00 hours`))
+			Expect(output.String()).To(MatchRegexp(`Total: 3 packages, 2 vehicles, 2 trips, makespan 2\.00 hours`))
+		})
+
+		It("should not mix --depots with a single depot", func() {
+			depotLocation = "0,0"
+			defer func() { depotLocation = "" }()
+
+			args := []string{"100", "1", "PKG1 50 11 NA", "0", "50", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Use either --depots or --depot/--depot-node"))
+		})
+	})
+})
+
+func getPackageIDs(packages []Package) []string {
+	var ids []string
+	for _, pkg := range packages {
+		ids = append(ids, pkg.ID)
+	}
+	return ids
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+
+	"courier_service/config"
+)
+
+// TripCost is what one planned trip costs the operator. Fixed is the trip's
+// share of the fixed cost of its vehicle, which is split evenly over all the
+// trips the vehicle makes in the batch.
+type TripCost struct {
+	Trip    Trip
+	Fuel    float64
+	Driver  float64
+	Fixed   float64
+	Revenue float64
+}
+
+type PackageMargin struct {
+	ID        string
+	VehicleID int
+	Revenue   float64
+	Cost      float64
+}
+
+// MarginReport sets the operating cost of a batch against what its customers
+// pay, per trip, per package and for the batch as a whole.
+type MarginReport struct {
+	Trips    []TripCost
+	Packages []PackageMargin
+	Revenue  float64
+	Cost     float64
+}
+
+var showMarginReport bool
+
+func (t TripCost) getCost() float64 {
+	return t.Fuel + t.Driver + t.Fixed
+}
+
+func getMarginPercentage(revenue, cost float64) float64 {
+	if revenue == 0 {
+		return 0
+	}
+	return (revenue - cost) * 100 / revenue
+}
+
+// calculateOperatingCosts prices the planned trips with the operator cost
+// model. A trip's cost is shared among its packages by weight.
+func calculateOperatingCosts(trips []Trip, costs config.OperatingCosts) MarginReport {
+	tripsPerVehicle := make(map[int]int)
+	for _, trip := range trips {
+		tripsPerVehicle[trip.VehicleID]++
+	}
+
+	report := MarginReport{}
+	for _, trip := range trips {
+		tripCost := TripCost{
+			Trip:   trip,
+			Fuel:   trip.Distance * costs.FuelCostPerKM,
+			Driver: (trip.Return - trip.Departure) * costs.DriverCostPerHour,
+			Fixed:  costs.VehicleFixedCost / float64(tripsPerVehicle[trip.VehicleID]),
+		}
+
+		tripWeight := 0
+		for _, pkg := range trip.Packages {
+			tripCost.Revenue += pkg.FinalCost
+			tripWeight += pkg.Weight
+		}
+
+		for _, pkg := range trip.Packages {
+			share := 1 / float64(len(trip.Packages))
+			if tripWeight > 0 {
+				share = float64(pkg.Weight) / float64(tripWeight)
+			}
+			report.Packages = append(report.Packages, PackageMargin{ID: pkg.ID, VehicleID: trip.VehicleID, Revenue: pkg.FinalCost, Cost: tripCost.getCost() * share})
+		}
+
+		report.Trips = append(report.Trips, tripCost)
+		report.Revenue += tripCost.Revenue
+		report.Cost += tripCost.getCost()
+	}
+
+	return report
+}
+
+func printMarginReport(report MarginReport) {
+	fmt.Println("Operating costs and margin:")
+	for i, trip := range report.Trips {
+		fmt.Printf("  Trip %d: vehicle %d, packages %d, cost %.2f (fuel %.2f, driver %.2f, vehicle %.2f), revenue %.2f, margin %.2f (%.1f%%)\n",
+			i+1, trip.Trip.VehicleID, len(trip.Trip.Packages), trip.getCost(), trip.Fuel, trip.Driver, trip.Fixed,
+			trip.Revenue, trip.Revenue-trip.getCost(), getMarginPercentage(trip.Revenue, trip.getCost()))
+	}
+	for _, pkg := range report.Packages {
+		fmt.Printf("  %s: cost %.2f, revenue %.2f, margin %.2f (%.1f%%)\n",
+			pkg.ID, pkg.Cost, pkg.Revenue, pkg.Revenue-pkg.Cost, getMarginPercentage(pkg.Revenue, pkg.Cost))
+	}
+	fmt.Printf("  Batch: cost %.2f, revenue %.2f, margin %.2f (%.1f%%)\n",
+		report.Cost, report.Revenue, report.Revenue-report.Cost, getMarginPercentage(report.Revenue, report.Cost))
+	fmt.Println()
+}
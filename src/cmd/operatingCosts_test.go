@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+
+	"courier_service/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("operating costs", func() {
+	costs := config.OperatingCosts{FuelCostPerKM: 1, DriverCostPerHour: 20, VehicleFixedCost: 60}
+	trips := []Trip{
+		{VehicleID: 1, Departure: 0, Return: 2, Distance: 100, Packages: []Package{
+			{ID: "PKG1", Weight: 50, FinalCost: 100},
+			{ID: "PKG2", Weight: 150, FinalCost: 300},
+		}},
+		{VehicleID: 1, Departure: 2, Return: 3, Distance: 50, Packages: []Package{
+			{ID: "PKG3", Weight: 100, FinalCost: 200},
+		}},
+	}
+
+	Describe("calculateOperatingCosts", func() {
+		It("should split the vehicle fixed cost over its trips", func() {
+			report := calculateOperatingCosts(trips, costs)
+
+			Expect(report.Trips).To(HaveLen(2))
+			Expect(report.Trips[0].getCost()).To(BeNumerically("~", 170, 1e-9))
+			Expect(report.Trips[1].getCost()).To(BeNumerically("~", 100, 1e-9))
+			Expect(report.Trips[1].Fixed).To(BeNumerically("~", 30, 1e-9))
+		})
+
+		It("should share the trip cost among packages by weight", func() {
+			report := calculateOperatingCosts(trips, costs)
+
+			Expect(report.Packages[0].Cost).To(BeNumerically("~", 42.5, 1e-9))
+			Expect(report.Packages[1].Cost).To(BeNumerically("~", 127.5, 1e-9))
+			Expect(report.Packages[2].Cost).To(BeNumerically("~", 100, 1e-9))
+		})
+
+		It("should total the batch", func() {
+			report := calculateOperatingCosts(trips, costs)
+
+			Expect(report.Revenue).To(Equal(600.0))
+			Expect(report.Cost).To(BeNumerically("~", 270, 1e-9))
+			Expect(getMarginPercentage(report.Revenue, report.Cost)).To(BeNumerically("~", 55, 1e-9))
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with --margin", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+			viper.Set("weightCostPerKG", 10)
+			viper.Set("distanceCostPerKM", 5)
+			viper.Set("operatingCosts", map[string]interface{}{"fuelCostPerKM": 2, "driverCostPerHour": 30, "vehicleFixedCost": 50})
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			showMarginReport = false
+			viper.Set("operatingCosts", map[string]interface{}{})
+		})
+
+		It("should print the margin of each trip, package and the batch", func() {
+			showMarginReport = true
+
+			args := []string{"100", "1", "PKG1 50 30 NA", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Operating costs and margin:\n"))
+			Expect(output.String()).To(ContainSubstring("  Trip 1: vehicle 1, packages 1, cost 195.71 (fuel 120.00, driver 25.71, vehicle 50.00), revenue 750.00, margin 554.29 (73.9%)\n"))
+			Expect(output.String()).To(ContainSubstring("  PKG1: cost 195.71, revenue 750.00, margin 554.29 (73.9%)\n"))
+			Expect(output.String()).To(ContainSubstring("  Batch: cost 195.71, revenue 750.00, margin 554.29 (73.9%)\n"))
+		})
+	})
+})
@@ -0,0 +1,419 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// The optimiser only takes on batches it can search in reasonable time; larger
+// ones keep the greedy plan.
+const (
+	optimiserPackageLimit = 40
+	optimiserRestarts     = 20
+	optimiserSeed         = 1
+)
+
+// PlanOptimiser improves greedy plans by local search when --optimise is set.
+// Every batch it sees is recorded in Reports for the comparison printed after
+// the plan. A nil optimiser leaves plans as they are.
+type PlanOptimiser struct {
+	Budget  time.Duration
+	Context string
+	Reports []OptimiserReport
+}
+
+type OptimiserReport struct {
+	Context   string
+	Packages  int
+	Skipped   bool
+	TimedOut  bool
+	Evaluated int
+	Elapsed   time.Duration
+	Greedy    PlanMetrics
+	Optimised PlanMetrics
+}
+
+// PlanMetrics are the measures plans are compared on, in order: dispatch
+// priority, fewer unscheduled packages, less total lateness, an earlier last
+// delivery and a smaller sum of delivery times. Priority is compared level by
+// level from the highest down, laid out like getShipmentScore: first fewer
+// packages of the level left unscheduled, then a smaller sum of their delivery
+// times, so no move can hold back a same-day or re-attempted parcel to speed
+// up standard ones.
+type PlanMetrics struct {
+	PriorityUnscheduled  []int
+	PriorityDeliveryTime []float64
+	Unscheduled          int
+	Lateness             float64
+	LatestDelivery       float64
+	TotalDeliveryTime    float64
+	Trips                int
+	Distance             float64
+}
+
+var (
+	optimisePlan   bool
+	optimiseBudget time.Duration
+)
+
+// planTrips plans a batch greedily and, when an optimiser is set, hands the
+// result to it to improve.
+func planTrips(ctx context.Context, packages []Package, numVehicles, maxSpeed, maxWeight, baseDeliveryCost int, options SchedulerOptions) ([]Trip, []Package) {
+	trips, unscheduled := calculateDeliveryTime(ctx, packages, numVehicles, maxSpeed, maxWeight, baseDeliveryCost, options)
+	return options.Optimiser.improve(ctx, trips, numVehicles, maxSpeed, maxWeight, options), unscheduled
+}
+
+func measurePlan(trips []Trip, unscheduled []Package) PlanMetrics {
+	levels := len(serviceLevelPriority) - 1
+	metrics := PlanMetrics{
+		PriorityUnscheduled:  make([]int, levels),
+		PriorityDeliveryTime: make([]float64, levels),
+		Unscheduled:          len(unscheduled),
+		Trips:                len(trips),
+	}
+	for _, pkg := range unscheduled {
+		if priority := getDispatchPriority(pkg); priority > 0 {
+			metrics.PriorityUnscheduled[levels-priority]++
+		}
+	}
+	for _, trip := range trips {
+		metrics.Distance += trip.Distance
+		for _, pkg := range trip.Packages {
+			if priority := getDispatchPriority(pkg); priority > 0 {
+				metrics.PriorityDeliveryTime[levels-priority] += pkg.DeliveryTime
+			}
+			metrics.LatestDelivery = math.Max(metrics.LatestDelivery, pkg.DeliveryTime)
+			metrics.TotalDeliveryTime += pkg.DeliveryTime
+			if pkg.LatestDelivery > 0 && pkg.DeliveryTime > pkg.LatestDelivery {
+				metrics.Lateness += pkg.DeliveryTime - pkg.LatestDelivery
+			}
+		}
+	}
+	return metrics
+}
+
+func (m PlanMetrics) isBetterThan(other PlanMetrics) bool {
+	for level := range m.PriorityUnscheduled {
+		if m.PriorityUnscheduled[level] != other.PriorityUnscheduled[level] {
+			return m.PriorityUnscheduled[level] < other.PriorityUnscheduled[level]
+		}
+		if math.Abs(m.PriorityDeliveryTime[level]-other.PriorityDeliveryTime[level]) > 1e-9 {
+			return m.PriorityDeliveryTime[level] < other.PriorityDeliveryTime[level]
+		}
+	}
+	if m.Unscheduled != other.Unscheduled {
+		return m.Unscheduled < other.Unscheduled
+	}
+	for _, values := range [][2]float64{
+		{m.Lateness, other.Lateness},
+		{m.LatestDelivery, other.LatestDelivery},
+		{m.TotalDeliveryTime, other.TotalDeliveryTime},
+	} {
+		if math.Abs(values[0]-values[1]) > 1e-9 {
+			return values[0] < values[1]
+		}
+	}
+	return false
+}
+
+// improve searches for a better grouping and order of the greedy plan's
+// shipments. It starts from the greedy plan, so it never returns anything
+// worse. Packages greedy could not schedule stay out of the search. The
+// search stops at its budget or once ctx is done, whichever comes first.
+func (o *PlanOptimiser) improve(ctx context.Context, trips []Trip, numVehicles, maxSpeed, maxWeight int, options SchedulerOptions) []Trip {
+	if o == nil || len(trips) == 0 {
+		return trips
+	}
+
+	var packages []Package
+	var shipments [][]int
+	for _, trip := range trips {
+		var shipment []int
+		for _, pkg := range trip.Packages {
+			shipment = append(shipment, len(packages))
+			packages = append(packages, pkg)
+		}
+		shipments = append(shipments, shipment)
+	}
+
+	report := OptimiserReport{Context: o.Context, Packages: len(packages), Greedy: measurePlan(trips, nil)}
+	report.Optimised = report.Greedy
+	if len(packages) > optimiserPackageLimit {
+		report.Skipped = true
+		o.Reports = append(o.Reports, report)
+		return trips
+	}
+
+	options.Explanation = nil
+	capacity := getCapacity(maxWeight, options)
+	_, vehicleList := initializeVehicles(numVehicles, capacity, options)
+	search := &optimiserSearch{
+		packages:    packages,
+		vehicles:    vehicleList,
+		capacity:    capacity,
+		numVehicles: numVehicles,
+		maxSpeed:    maxSpeed,
+		options:     options,
+		ctx:         ctx,
+		started:     time.Now(),
+		deadline:    time.Now().Add(o.Budget),
+		random:      rand.New(rand.NewSource(optimiserSeed)),
+	}
+	bestTrips, bestMetrics := search.run(shipments)
+
+	report.Evaluated = search.evaluated
+	report.TimedOut = search.timedOut
+	report.Elapsed = time.Since(search.started)
+	if bestMetrics.isBetterThan(report.Greedy) {
+		report.Optimised = bestMetrics
+		trips = bestTrips
+	}
+	o.Reports = append(o.Reports, report)
+
+	return trips
+}
+
+type optimiserSearch struct {
+	packages    []Package
+	vehicles    []Vehicle
+	capacity    Capacity
+	numVehicles int
+	maxSpeed    int
+	options     SchedulerOptions
+	ctx         context.Context
+	started     time.Time
+	deadline    time.Time
+	random      *rand.Rand
+	evaluated   int
+	timedOut    bool
+}
+
+// run climbs from the starting shipments to a local optimum, then restarts the
+// climb from small random changes to the best plan found until the restarts or
+// the time budget run out. The random source is seeded so that a search that
+// finishes within its budget always gives the same plan.
+func (s *optimiserSearch) run(shipments [][]int) ([]Trip, PlanMetrics) {
+	bestShipments := shipments
+	bestTrips, bestMetrics := s.evaluate(shipments)
+	bestShipments, bestTrips, bestMetrics = s.climb(bestShipments, bestTrips, bestMetrics)
+
+	for restart := 0; restart < optimiserRestarts && !s.isExpired(); restart++ {
+		candidate := s.perturb(bestShipments)
+		trips, metrics := s.evaluate(candidate)
+		candidate, trips, metrics = s.climb(candidate, trips, metrics)
+		if metrics.isBetterThan(bestMetrics) {
+			bestShipments, bestTrips, bestMetrics = candidate, trips, metrics
+		}
+	}
+
+	return bestTrips, bestMetrics
+}
+
+func (s *optimiserSearch) isExpired() bool {
+	if !s.timedOut && (time.Now().After(s.deadline) || s.ctx.Err() != nil) {
+		s.timedOut = true
+	}
+	return s.timedOut
+}
+
+// evaluate dispatches the shipments in order, each to the vehicle that can
+// leave first, exactly as the greedy scheduler would.
+func (s *optimiserSearch) evaluate(shipments [][]int) ([]Trip, PlanMetrics) {
+	s.evaluated++
+
+	vehicleAvailabilityArray, vehicleList := initializeVehicles(s.numVehicles, s.capacity, s.options)
+	packageList := append([]Package(nil), s.packages...)
+	var trips []Trip
+	var unscheduled []Package
+
+	for _, shipment := range shipments {
+		trip, scheduled := processNextDelivery(shipment, packageList, vehicleAvailabilityArray, vehicleList, s.maxSpeed, s.options)
+		if !scheduled {
+			for _, idx := range shipment {
+				unscheduled = append(unscheduled, packageList[idx])
+			}
+			continue
+		}
+		trips = append(trips, trip)
+	}
+
+	return trips, measurePlan(trips, unscheduled)
+}
+
+// climb applies the first improving move it finds until none is left: moving a
+// package to another or a new shipment, swapping two packages between
+// shipments, or swapping the dispatch order of two shipments.
+func (s *optimiserSearch) climb(shipments [][]int, trips []Trip, metrics PlanMetrics) ([][]int, []Trip, PlanMetrics) {
+	for !s.isExpired() {
+		improved := false
+		s.forEachNeighbour(shipments, func(neighbour [][]int) bool {
+			if s.isExpired() {
+				return false
+			}
+			neighbourTrips, neighbourMetrics := s.evaluate(neighbour)
+			if neighbourMetrics.isBetterThan(metrics) {
+				shipments, trips, metrics = neighbour, neighbourTrips, neighbourMetrics
+				improved = true
+				return false
+			}
+			return true
+		})
+		if !improved {
+			break
+		}
+	}
+	return shipments, trips, metrics
+}
+
+func (s *optimiserSearch) forEachNeighbour(shipments [][]int, visit func([][]int) bool) {
+	for from := range shipments {
+		for position := range shipments[from] {
+			for to := 0; to <= len(shipments); to++ {
+				if to == from {
+					continue
+				}
+				if neighbour, ok := s.relocate(shipments, from, position, to); ok && !visit(neighbour) {
+					return
+				}
+			}
+		}
+	}
+
+	for first := range shipments {
+		for second := first + 1; second < len(shipments); second++ {
+			for i := range shipments[first] {
+				for j := range shipments[second] {
+					if neighbour, ok := s.exchange(shipments, first, i, second, j); ok && !visit(neighbour) {
+						return
+					}
+				}
+			}
+		}
+	}
+
+	for first := range shipments {
+		for second := first + 1; second < len(shipments); second++ {
+			neighbour := copyShipments(shipments)
+			neighbour[first], neighbour[second] = neighbour[second], neighbour[first]
+			if !visit(neighbour) {
+				return
+			}
+		}
+	}
+}
+
+// relocate moves one package to another shipment, or to a new shipment of its
+// own dispatched last when to is past the end.
+func (s *optimiserSearch) relocate(shipments [][]int, from, position, to int) ([][]int, bool) {
+	neighbour := copyShipments(shipments)
+	idx := neighbour[from][position]
+	neighbour[from] = append(neighbour[from][:position], neighbour[from][position+1:]...)
+
+	if to == len(neighbour) {
+		neighbour = append(neighbour, []int{idx})
+	} else {
+		neighbour[to] = append(neighbour[to], idx)
+		if !s.fits(neighbour[to]) {
+			return nil, false
+		}
+	}
+
+	if len(neighbour[from]) == 0 {
+		if to == len(shipments) && len(shipments) > 0 && from == len(shipments)-1 {
+			return nil, false
+		}
+		neighbour = append(neighbour[:from], neighbour[from+1:]...)
+	}
+	return neighbour, true
+}
+
+func (s *optimiserSearch) exchange(shipments [][]int, first, i, second, j int) ([][]int, bool) {
+	neighbour := copyShipments(shipments)
+	neighbour[first][i], neighbour[second][j] = neighbour[second][j], neighbour[first][i]
+	return neighbour, s.fits(neighbour[first]) && s.fits(neighbour[second])
+}
+
+// perturb makes two random package moves that respect the capacity, so the
+// next climb starts somewhere new.
+func (s *optimiserSearch) perturb(shipments [][]int) [][]int {
+	candidate := shipments
+	for moves := 0; moves < 2; moves++ {
+		from := s.random.Intn(len(candidate))
+		position := s.random.Intn(len(candidate[from]))
+		to := s.random.Intn(len(candidate) + 1)
+		if to == from {
+			continue
+		}
+		if neighbour, ok := s.relocate(candidate, from, position, to); ok {
+			candidate = neighbour
+		}
+	}
+	return candidate
+}
+
+func (s *optimiserSearch) fits(shipment []int) bool {
+	return fitsAnyVehicle(s.vehicles, getShipmentLoad(shipment, s.packages))
+}
+
+func copyShipments(shipments [][]int) [][]int {
+	copied := make([][]int, len(shipments))
+	for i, shipment := range shipments {
+		copied[i] = append([]int(nil), shipment...)
+	}
+	return copied
+}
+
+// changedPlan reports whether the optimiser replaced any of the greedy plans
+// it was handed.
+func (o *PlanOptimiser) changedPlan() bool {
+	if o == nil {
+		return false
+	}
+	for _, report := range o.Reports {
+		if report.Optimised.isBetterThan(report.Greedy) {
+			return true
+		}
+	}
+	return false
+}
+
+func printOptimiserReports(optimiser *PlanOptimiser) {
+	fmt.Println("Optimiser comparison:")
+	for _, report := range optimiser.Reports {
+		if report.Context != "" {
+			fmt.Printf("  %s:\n", report.Context)
+		}
+		if report.Skipped {
+			fmt.Printf("  Kept the greedy plan: %d packages is more than the optimiser handles (%d)\n", report.Packages, optimiserPackageLimit)
+			continue
+		}
+
+		status := "searched"
+		if report.TimedOut {
+			status = "time budget used up"
+		}
+		fmt.Printf("  Local search: %d plans evaluated in %s, %s\n", report.Evaluated, report.Elapsed.Round(time.Millisecond), status)
+		printPlanMetrics("Greedy", report.Greedy)
+		printPlanMetrics("Optimised", report.Optimised)
+
+		improvement := report.Greedy.LatestDelivery - report.Optimised.LatestDelivery
+		percentage := 0.0
+		if report.Greedy.LatestDelivery > 0 {
+			percentage = improvement * 100 / report.Greedy.LatestDelivery
+		}
+		fmt.Printf("  Last delivery %.2f hours earlier (%.1f%%)\n", improvement, percentage)
+	}
+	fmt.Println()
+}
+
+func printPlanMetrics(label string, metrics PlanMetrics) {
+	fmt.Printf("  %-10s last delivery %.2f hours, total delivery time %.2f hours, %d trips, %.0f km", label+":",
+		metrics.LatestDelivery, metrics.TotalDeliveryTime, metrics.Trips, metrics.Distance)
+	if metrics.Lateness > 0 {
+		fmt.Printf(", %.2f hours late", metrics.Lateness)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("optimiser", func() {
+	packages := []Package{
+		{ID: "PKG1", Weight: 50, Distance: 30},
+		{ID: "PKG2", Weight: 75, Distance: 125},
+		{ID: "PKG3", Weight: 175, Distance: 100},
+		{ID: "PKG4", Weight: 110, Distance: 60},
+		{ID: "PKG5", Weight: 155, Distance: 95},
+	}
+
+	Describe("isBetterThan", func() {
+		It("should rank lateness before the last delivery time", func() {
+			onTime := PlanMetrics{LatestDelivery: 5}
+			late := PlanMetrics{LatestDelivery: 4, Lateness: 0.5}
+
+			Expect(onTime.isBetterThan(late)).To(BeTrue())
+			Expect(late.isBetterThan(onTime)).To(BeFalse())
+		})
+
+		It("should rank dispatch priority before everything else", func() {
+			sameDayFirst := PlanMetrics{PriorityUnscheduled: []int{0, 0}, PriorityDeliveryTime: []float64{0.5, 0}, LatestDelivery: 5}
+			sameDayLater := PlanMetrics{PriorityUnscheduled: []int{0, 0}, PriorityDeliveryTime: []float64{2, 0}, LatestDelivery: 4}
+			sameDayLeftOut := PlanMetrics{PriorityUnscheduled: []int{1, 0}, PriorityDeliveryTime: []float64{0, 0}, LatestDelivery: 3}
+
+			Expect(sameDayFirst.isBetterThan(sameDayLater)).To(BeTrue())
+			Expect(sameDayLater.isBetterThan(sameDayLeftOut)).To(BeTrue())
+		})
+	})
+
+	Describe("measurePlan", func() {
+		It("should add up delivery times and unscheduled packages by dispatch priority", func() {
+			trips := []Trip{{Packages: []Package{
+				{ID: "PKG1", ServiceLevel: ServiceLevelSameDay, DeliveryTime: 1},
+				{ID: "PKG2", Attempts: 1, DeliveryTime: 2},
+				{ID: "PKG3", DeliveryTime: 3},
+			}}}
+
+			metrics := measurePlan(trips, []Package{{ID: "PKG4", ServiceLevel: ServiceLevelExpress}})
+
+			Expect(metrics.PriorityDeliveryTime).To(Equal([]float64{1, 2}))
+			Expect(metrics.PriorityUnscheduled).To(Equal([]int{0, 1}))
+			Expect(metrics.Unscheduled).To(Equal(1))
+		})
+	})
+
+	Describe("planTrips", func() {
+		It("should deliver the last package sooner than the greedy plan", func() {
+			greedyTrips, _ := planTrips(context.Background(), packages, 2, 70, 200, 100, SchedulerOptions{})
+			optimiser := &PlanOptimiser{Budget: time.Minute}
+
+			trips, unscheduled := planTrips(context.Background(), packages, 2, 70, 200, 100, SchedulerOptions{Optimiser: optimiser})
+
+			Expect(unscheduled).To(BeEmpty())
+			Expect(measurePlan(greedyTrips, nil).LatestDelivery).To(BeNumerically("~", 4.21, 0.01))
+			Expect(measurePlan(trips, nil).LatestDelivery).To(BeNumerically("~", 4.14, 0.01))
+			Expect(optimiser.Reports).To(HaveLen(1))
+			Expect(optimiser.Reports[0].TimedOut).To(BeFalse())
+		})
+
+		It("should not deliver a same-day package later than the greedy plan", func() {
+			prioritised := append([]Package(nil), packages...)
+			prioritised[0].ServiceLevel = ServiceLevelSameDay
+			greedyTrips, _ := planTrips(context.Background(), prioritised, 2, 70, 200, 100, SchedulerOptions{})
+
+			trips, _ := planTrips(context.Background(), prioritised, 2, 70, 200, 100, SchedulerOptions{Optimiser: &PlanOptimiser{Budget: time.Minute}})
+
+			Expect(measurePlan(trips, nil).PriorityDeliveryTime[0]).To(BeNumerically("<=", measurePlan(greedyTrips, nil).PriorityDeliveryTime[0]))
+		})
+
+		It("should keep every trip within the vehicle capacity", func() {
+			trips, _ := planTrips(context.Background(), packages, 2, 70, 200, 100, SchedulerOptions{Optimiser: &PlanOptimiser{Budget: time.Minute}})
+
+			for _, trip := range trips {
+				load, _ := Capacity{Weight: 200}.getTripLoad(trip)
+				Expect(load).To(BeNumerically("<=", 100))
+			}
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with --optimise", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			optimisePlan = false
+			optimiseBudget = 2 * time.Second
+			explainPlan = false
+		})
+
+		It("should compare the optimised plan with the greedy one", func() {
+			optimisePlan = true
+
+			args := []string{"100", "5", "PKG1 50 30 NA", "PKG2 75 125 NA", "PKG3 175 100 NA", "PKG4 110 60 NA", "PKG5 155 95 NA", "2", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Optimiser comparison:\n"))
+			Expect(output.String()).To(ContainSubstring("  Greedy:    last delivery 4.21 hours"))
+			Expect(output.String()).To(ContainSubstring("  Optimised: last delivery 4.14 hours"))
+			Expect(output.String()).To(ContainSubstring("  Last delivery 0.07 hours earlier (1.7%)\n"))
+		})
+
+		It("should say the explanation is of the greedy plan when the optimiser changed it", func() {
+			optimisePlan = true
+			explainPlan = true
+
+			args := []string{"100", "5", "PKG1 50 30 NA", "PKG2 75 125 NA", "PKG3 175 100 NA", "PKG4 110 60 NA", "PKG5 155 95 NA", "2", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Plan explanation:\nThe optimiser changed the plan above. These steps explain the greedy plan it started from.\n"))
+		})
+
+		It("should not label the explanation when the optimiser kept the greedy plan", func() {
+			optimisePlan = true
+			explainPlan = true
+
+			args := []string{"100", "1", "PKG1 50 30 NA", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Plan explanation:\n\n"))
+		})
+
+		It("should reject a budget that is not positive", func() {
+			optimisePlan = true
+			optimiseBudget = 0
+
+			args := []string{"100", "1", "PKG1 50 30 NA", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Invalid optimiser time budget"))
+		})
+	})
+})
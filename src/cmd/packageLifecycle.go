@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"courier_service/store"
+
+	"github.com/spf13/cobra"
+)
+
+// schedulableStatuses are the states a package may be planned from. Packages
+// on the road, delivered or returned are left out of any plan. A package the
+// store has not seen has no status and counts as created.
+var schedulableStatuses = map[string]bool{
+	"":                    true,
+	store.StatusCreated:   true,
+	store.StatusQuoted:    true,
+	store.StatusScheduled: true,
+	store.StatusFailed:    true,
+}
+
+func isSchedulable(pkg Package) bool {
+	return schedulableStatuses[pkg.Status]
+}
+
+// loadPackageStatuses sets the stored status, failed attempts and customer on
+// every package the store knows.
+func loadPackageStatuses(repository store.Repository, packages []Package) error {
+	for i := range packages {
+		stored, err := repository.GetPackage(packages[i].ID)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		packages[i].Status, packages[i].Attempts = stored.Status, stored.Attempts
+		if packages[i].CustomerID == "" {
+			packages[i].CustomerID = stored.CustomerID
+		}
+	}
+	return nil
+}
+
+// recordScheduled moves the packages of the planned trips to scheduled.
+// Packages already scheduled, or past being scheduled, are left as they are.
+func recordScheduled(repository store.Repository, trips []Trip, at time.Time) error {
+	for _, trip := range trips {
+		for _, pkg := range trip.Packages {
+			stored, err := repository.GetPackage(pkg.ID)
+			if err != nil {
+				return err
+			}
+			if stored.Status == store.StatusScheduled || !store.CanTransition(stored.Status, store.StatusScheduled) {
+				continue
+			}
+			if _, err := repository.UpdatePackageStatus(pkg.ID, store.StatusScheduled, at); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func openRequiredStore() (store.Repository, error) {
+	if storePath == "" {
+		return nil, fmt.Errorf("The --store flag is required")
+	}
+	return openStore()
+}
+
+func printPackageHistory(pkg store.Package) {
+	fmt.Printf("Package %s: %s\n", pkg.ID, pkg.Status)
+	for _, change := range pkg.History {
+		fmt.Printf("  %s  %s\n", change.At.Format("2006-01-02 15:04:05"), change.Status)
+	}
+}
+
+var trackCmd = &cobra.Command{
+	Use:   "track",
+	Short: "Show the status history of a package",
+	Long:  `This command shows the current status of a package kept in the store and every status it has been through, with the time of each change.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("Usage: courier_service track <packageID> --store <store_file>")
+		}
+
+		repository, err := openRequiredStore()
+		if err != nil {
+			return err
+		}
+		defer repository.Close()
+
+		pkg, err := repository.GetPackage(args[0])
+		if err == store.ErrNotFound {
+			return fmt.Errorf("Package %s not found", args[0])
+		}
+		if err != nil {
+			return err
+		}
+
+		printPackageHistory(pkg)
+		return nil
+	},
+}
+
+var updateStatusCmd = &cobra.Command{
+	Use:   "updateStatus",
+	Short: "Move a package to a new status",
+	Long:  `This command records a status change for a package kept in the store, e.g. when it leaves the depot or is delivered. Only changes the package lifecycle allows are accepted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("Usage: courier_service updateStatus <packageID> <status> --store <store_file>")
+		}
+
+		repository, err := openRequiredStore()
+		if err != nil {
+			return err
+		}
+		defer repository.Close()
+
+		pkg, err := repository.UpdatePackageStatus(args[0], args[1], time.Now())
+		if err == store.ErrNotFound {
+			return fmt.Errorf("Package %s not found", args[0])
+		}
+		if err != nil {
+			return err
+		}
+
+		printPackageHistory(pkg)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(trackCmd)
+	rootCmd.AddCommand(updateStatusCmd)
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"courier_service/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("package lifecycle", func() {
+	Describe("calculateDeliveryTime", func() {
+		It("should leave out packages that are on the road or done", func() {
+			packages := []Package{
+				{ID: "PKG1", Weight: 50, Distance: 30, Status: store.StatusQuoted},
+				{ID: "PKG2", Weight: 75, Distance: 125, Status: store.StatusDelivered},
+				{ID: "PKG3", Weight: 75, Distance: 100, Status: store.StatusFailed},
+			}
+
+			trips, unscheduled := calculateDeliveryTime(context.Background(), packages, 1, 70, 200, 100, SchedulerOptions{})
+
+			Expect(trips).To(HaveLen(1))
+			Expect(getPackageIDs(trips[0].Packages)).To(ConsistOf("PKG1", "PKG3"))
+			Expect(getPackageIDs(unscheduled)).To(Equal([]string{"PKG2"}))
+		})
+	})
+
+	Describe("commands", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			storePath = filepath.Join(GinkgoT().TempDir(), "store.jsonl")
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+			viper.Set("weightCostPerKG", 10)
+			viper.Set("distanceCostPerKM", 5)
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			storePath = ""
+		})
+
+		It("should schedule planned packages and skip delivered ones", func() {
+			repository, _ := store.NewFileStore(storePath)
+			repository.SavePackage(store.Package{ID: "PKG2", Weight: 75, Distance: 125})
+			for _, status := range []string{store.StatusQuoted, store.StatusScheduled, store.StatusOutForDelivery, store.StatusDelivered} {
+				repository.UpdatePackageStatus("PKG2", status, time.Now())
+			}
+			repository.Close()
+
+			args := []string{"100", "2", "PKG1 50 30 NA", "PKG2 75 125 NA", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(trackCmd.RunE(nil, []string{"PKG1"})).To(Succeed())
+			Expect(trackCmd.RunE(nil, []string{"PKG2"})).To(Succeed())
+
+			w.Close()
+			output.ReadFrom(r)
+			Expect(output.String()).To(ContainSubstring("Packages that could not be scheduled:\n  PKG2\n"))
+			Expect(output.String()).To(MatchRegexp(`Package PKG1: scheduled\n  [0-9: -]+  created\n  [0-9: -]+  quoted\n  [0-9: -]+  scheduled\n`))
+			Expect(output.String()).To(ContainSubstring("Package PKG2: delivered\n"))
+		})
+
+		It("should only accept changes the lifecycle allows", func() {
+			Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG1 50 30 NA"})).To(Succeed())
+
+			err := updateStatusCmd.RunE(nil, []string{"PKG1", store.StatusDelivered})
+
+			Expect(err).To(MatchError("Package PKG1 cannot move from quoted to delivered"))
+		})
+
+		It("should need a store", func() {
+			storePath = ""
+
+			err := trackCmd.RunE(nil, []string{"PKG1"})
+
+			Expect(err).To(MatchError("The --store flag is required"))
+		})
+
+		It("should report a package the store does not have", func() {
+			err := trackCmd.RunE(nil, []string{"PKG9"})
+
+			Expect(err).To(MatchError("Package PKG9 not found"))
+		})
+	})
+})
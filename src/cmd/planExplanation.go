@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Shipments are ranked on these criteria in order; the first one on which two
+// candidates differ decides between them. The first three follow the layout of
+// getShipmentScore. Vehicles are then chosen by earliest departure, and among
+// vehicles leaving at the same time the lowest vehicle ID wins.
+const (
+	criterionSameDayWeight = iota
+	criterionExpressWeight
+	criterionWeight
+	criterionPackageCount
+	criterionDistance
+	criterionPackageIDs
+	criterionNone
+)
+
+const explainCandidateLimit = 5
+
+// shipmentKey holds the values a candidate shipment is ranked on.
+type shipmentKey struct {
+	score      []int
+	count      int
+	distance   int
+	packageIDs []string
+}
+
+// PlanExplanation collects, when --explain-plan is set, the candidates the
+// scheduler weighed at every step. A nil explanation records nothing.
+type PlanExplanation struct {
+	Context       string
+	VehicleOffset int
+	Steps         []PlanStep
+
+	// The shipment search fills these in as it goes, for the next step.
+	searchUrgentID string
+	searchFeasible int
+	searchBest     []shipmentKey
+}
+
+type PlanStep struct {
+	Context         string
+	Waiting         int
+	Feasible        int
+	UrgentPackageID string
+	Candidates      []ShipmentCandidate
+	DecidedBy       int
+	Vehicles        []VehicleCandidate
+	VehicleID       int
+	Departure       float64
+	Scheduled       bool
+}
+
+type ShipmentCandidate struct {
+	PackageIDs []string
+	Weight     int
+	Count      int
+	Distance   int
+	LostOn     string
+}
+
+type VehicleCandidate struct {
+	VehicleID int
+	Departure float64
+	Available bool
+}
+
+var explainPlan bool
+
+func getShipmentKey(subset []int, packageList []Package) shipmentKey {
+	key := shipmentKey{score: getShipmentScore(subset, packageList), count: len(subset)}
+	for _, idx := range subset {
+		if packageList[idx].Distance > key.distance {
+			key.distance = packageList[idx].Distance
+		}
+		key.packageIDs = append(key.packageIDs, packageList[idx].ID)
+	}
+	sort.Strings(key.packageIDs)
+	return key
+}
+
+// compareShipmentKeys returns a positive number when a ranks before b, and the
+// criterion that decided.
+func compareShipmentKeys(a, b shipmentKey) (int, int) {
+	for i := range a.score {
+		if a.score[i] != b.score[i] {
+			return a.score[i] - b.score[i], i
+		}
+	}
+	if a.count != b.count {
+		return a.count - b.count, criterionPackageCount
+	}
+	if a.distance != b.distance {
+		return b.distance - a.distance, criterionDistance
+	}
+	if comparison := strings.Compare(strings.Join(b.packageIDs, ","), strings.Join(a.packageIDs, ",")); comparison != 0 {
+		return comparison, criterionPackageIDs
+	}
+	return 0, criterionNone
+}
+
+func describeShipmentLoss(winner, loser shipmentKey, criterion int) string {
+	switch criterion {
+	case criterionSameDayWeight:
+		return fmt.Sprintf("less same-day weight (%d kg vs %d kg)", loser.score[criterion], winner.score[criterion])
+	case criterionExpressWeight:
+		return fmt.Sprintf("less express weight (%d kg vs %d kg)", loser.score[criterion], winner.score[criterion])
+	case criterionWeight:
+		return fmt.Sprintf("lighter (%d kg vs %d kg)", loser.score[criterion], winner.score[criterion])
+	case criterionPackageCount:
+		return fmt.Sprintf("fewer packages (%d vs %d)", loser.count, winner.count)
+	case criterionDistance:
+		return fmt.Sprintf("farther (%d km vs %d km)", loser.distance, winner.distance)
+	case criterionPackageIDs:
+		return "later package IDs"
+	}
+	return ""
+}
+
+func getCriterionName(criterion int) string {
+	return []string{"same-day weight", "express weight", "weight", "package count", "distance", "package IDs"}[criterion]
+}
+
+// startShipmentSearch clears the candidates of the previous search. The
+// package whose bit is set in requiredMask is the urgent one the search is
+// restricted to.
+func (e *PlanExplanation) startShipmentSearch(packageList []Package, requiredMask int) {
+	if e == nil {
+		return
+	}
+	e.searchUrgentID, e.searchFeasible, e.searchBest = "", 0, nil
+	for i := range packageList {
+		if requiredMask == 1<<i {
+			e.searchUrgentID = packageList[i].ID
+		}
+	}
+}
+
+// recordCandidate is called by the shipment search for every subset that fits
+// the vehicle. It counts them and keeps the best few in rank order.
+func (e *PlanExplanation) recordCandidate(subset []int, packageList []Package) {
+	if e == nil {
+		return
+	}
+	e.searchFeasible++
+
+	key := getShipmentKey(subset, packageList)
+	position := sort.Search(len(e.searchBest), func(i int) bool {
+		comparison, _ := compareShipmentKeys(key, e.searchBest[i])
+		return comparison > 0
+	})
+	if position == explainCandidateLimit {
+		return
+	}
+	e.searchBest = append(e.searchBest, shipmentKey{})
+	copy(e.searchBest[position+1:], e.searchBest[position:])
+	e.searchBest[position] = key
+	if len(e.searchBest) > explainCandidateLimit {
+		e.searchBest = e.searchBest[:explainCandidateLimit]
+	}
+}
+
+// recordShipmentChoice lists the best shipments the search found to fit the
+// vehicle, the one chosen first, and notes why each of the others lost to it.
+func (e *PlanExplanation) recordShipmentChoice(packageList []Package, chosen []int) {
+	if e == nil {
+		return
+	}
+
+	step := PlanStep{Context: e.Context, Waiting: len(packageList), Feasible: e.searchFeasible, UrgentPackageID: e.searchUrgentID, DecidedBy: criterionNone}
+
+	winner := getShipmentKey(chosen, packageList)
+	for i, key := range e.searchBest {
+		candidate := ShipmentCandidate{PackageIDs: key.packageIDs, Weight: key.score[criterionWeight], Count: key.count, Distance: key.distance}
+		if _, criterion := compareShipmentKeys(winner, key); criterion != criterionNone {
+			candidate.LostOn = describeShipmentLoss(winner, key, criterion)
+			if i == 1 {
+				step.DecidedBy = criterion
+			}
+		}
+		step.Candidates = append(step.Candidates, candidate)
+	}
+
+	e.Steps = append(e.Steps, step)
+}
+
+// recordVehicleChoice notes when each vehicle could leave on the trip of the
+// latest step. Only the first call per step is kept, so a shipment that had to
+// be split still shows why no vehicle could take it whole.
+func (e *PlanExplanation) recordVehicleChoice(vehicleList []Vehicle, vehicleAvailabilityArray []float64, load Capacity, readyAt, duration float64, calendar *DispatchCalendar) {
+	if e == nil || len(e.Steps) == 0 {
+		return
+	}
+	step := &e.Steps[len(e.Steps)-1]
+	if step.Vehicles != nil {
+		return
+	}
+
+	step.Vehicles = []VehicleCandidate{}
+	for i, vehicle := range vehicleList {
+		departure, available := vehicle.getDeparture(math.Max(vehicleAvailabilityArray[i], readyAt), duration, calendar)
+		available = available && vehicle.Capacity.holds(load)
+		step.Vehicles = append(step.Vehicles, VehicleCandidate{VehicleID: vehicle.ID + e.VehicleOffset, Departure: departure, Available: available})
+	}
+}
+
+func (e *PlanExplanation) recordTrip(trip Trip) {
+	if e == nil || len(e.Steps) == 0 {
+		return
+	}
+	step := &e.Steps[len(e.Steps)-1]
+	if !step.Scheduled {
+		step.Scheduled = true
+		step.VehicleID = trip.VehicleID + e.VehicleOffset
+		step.Departure = trip.Departure
+	}
+}
+
+func printPlanExplanation(explanation *PlanExplanation, optimised bool) {
+	fmt.Println("Plan explanation:")
+	if optimised {
+		fmt.Println("The optimiser changed the plan above. These steps explain the greedy plan it started from.")
+	}
+	fmt.Println()
+
+	context := ""
+	for i, step := range explanation.Steps {
+		if step.Context != context {
+			context = step.Context
+			fmt.Printf("%s:\n\n", context)
+		}
+
+		fmt.Printf("Step %d: %d waiting, %d candidate shipments fit the vehicle\n", i+1, step.Waiting, step.Feasible)
+		if step.UrgentPackageID != "" {
+			fmt.Printf("  Must carry %s, the earliest deadline\n", step.UrgentPackageID)
+		}
+		for j, candidate := range step.Candidates {
+			marker := " "
+			if j == 0 {
+				marker = "*"
+			}
+			fmt.Printf("  %s %s: weight %d kg, packages %d, farthest %d km", marker, strings.Join(candidate.PackageIDs, ","), candidate.Weight, candidate.Count, candidate.Distance)
+			if candidate.LostOn != "" {
+				fmt.Printf(" - %s", candidate.LostOn)
+			}
+			fmt.Println()
+		}
+		if step.DecidedBy == criterionNone {
+			fmt.Println("  Only candidate")
+		} else {
+			fmt.Printf("  Chosen on %s\n", getCriterionName(step.DecidedBy))
+		}
+		printVehicleChoice(step)
+		fmt.Println()
+	}
+}
+
+func printVehicleChoice(step PlanStep) {
+	var options []string
+	ties := 0
+	for _, vehicle := range step.Vehicles {
+		if !vehicle.Available {
+			options = append(options, fmt.Sprintf("%d unavailable", vehicle.VehicleID))
+			continue
+		}
+		options = append(options, fmt.Sprintf("%d at %.2f", vehicle.VehicleID, vehicle.Departure))
+		if math.Abs(vehicle.Departure-step.Departure) <= 1e-9 {
+			ties++
+		}
+	}
+	fmt.Printf("  Vehicles: %s\n", strings.Join(options, ", "))
+
+	switch {
+	case !step.Scheduled:
+		fmt.Println("  No vehicle can take this shipment whole, so its packages are sent one at a time")
+	case ties > 1:
+		fmt.Printf("  Vehicle %d leaves first at %.2f hours (lowest vehicle ID among ties)\n", step.VehicleID, step.Departure)
+	default:
+		fmt.Printf("  Vehicle %d leaves first at %.2f hours\n", step.VehicleID, step.Departure)
+	}
+}
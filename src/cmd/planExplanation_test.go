@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("tie-breaking and plan explanation", func() {
+	Describe("getShipmentWithLessDistanceAmongPossibleSubsets", func() {
+		It("should prefer more packages over a shorter distance", func() {
+			packages := []Package{
+				{ID: "PKG1", Weight: 100, Distance: 10},
+				{ID: "PKG2", Weight: 50, Distance: 40},
+				{ID: "PKG3", Weight: 50, Distance: 40},
+			}
+
+			Expect(getShipmentWithLessDistanceAmongPossibleSubsets([][]int{{0}, {1, 2}}, packages)).To(Equal([]int{1, 2}))
+		})
+
+		It("should fall back to package IDs whatever the input order", func() {
+			packages := []Package{{ID: "PKG2", Weight: 50, Distance: 30}, {ID: "PKG1", Weight: 50, Distance: 30}}
+
+			Expect(getShipmentWithLessDistanceAmongPossibleSubsets([][]int{{0}, {1}}, packages)).To(Equal([]int{1}))
+			Expect(getShipmentWithLessDistanceAmongPossibleSubsets([][]int{{1}, {0}}, packages)).To(Equal([]int{1}))
+		})
+	})
+
+	Describe("getFirstVehicleToDepart", func() {
+		It("should give the lowest vehicle ID a tie despite rounding", func() {
+			vehicles := []Vehicle{{ID: 1}, {ID: 2}}
+
+			vehicleIdx, _, found := getFirstVehicleToDepart(vehicles, []float64{0.1 + 0.2, 0.3}, Capacity{}, 0, 1, nil)
+
+			Expect(found).To(BeTrue())
+			Expect(vehicleIdx).To(Equal(0))
+		})
+	})
+
+	Describe("PlanExplanation", func() {
+		It("should keep the best candidates the search found and count the rest", func() {
+			packages := []Package{{ID: "PKG1", Weight: 50, Distance: 30}, {ID: "PKG2", Weight: 75, Distance: 125}, {ID: "PKG3", Weight: 110, Distance: 60}}
+			explanation := &PlanExplanation{}
+
+			possible := getShipmentsSubSetsWhichFallsUnderMaxCarriable(context.Background(), packages, Capacity{Weight: 200}, explanation)
+			explanation.recordShipmentChoice(packages, getShipmentWithLessDistanceAmongPossibleSubsets(possible, packages))
+
+			Expect(explanation.Steps).To(HaveLen(1))
+			Expect(explanation.Steps[0].Feasible).To(Equal(6))
+			Expect(explanation.Steps[0].Candidates[0].PackageIDs).To(Equal([]string{"PKG2", "PKG3"}))
+			Expect(explanation.Steps[0].Candidates).To(HaveLen(5))
+		})
+
+		It("should stop with the search once the context is done", func() {
+			var packages []Package
+			for i := 0; i < 24; i++ {
+				packages = append(packages, Package{ID: fmt.Sprintf("PKG%d", i+1), Weight: 10, Distance: 10})
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			explanation := &PlanExplanation{}
+
+			trips, unscheduled := calculateDeliveryTime(ctx, packages, 1, 70, 200, 100, SchedulerOptions{Explanation: explanation})
+
+			Expect(trips).To(BeEmpty())
+			Expect(unscheduled).To(HaveLen(24))
+			Expect(explanation.Steps).To(BeEmpty())
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with --explain-plan", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			explainPlan = false
+		})
+
+		It("should list the candidates and why the chosen shipment won", func() {
+			explainPlan = true
+
+			args := []string{"100", "3", "PKG1 50 30 NA", "PKG2 50 30 NA", "PKG3 100 20 NA latest=1", "2", "70", "100"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Step 1: 3 waiting, 1 candidate shipments fit the vehicle\n" +
+				"  Must carry PKG3, the earliest deadline\n"))
+			Expect(output.String()).To(ContainSubstring("  * PKG1,PKG2: weight 100 kg, packages 2, farthest 30 km\n" +
+				"    PKG1: weight 50 kg, packages 1, farthest 30 km - lighter (50 kg vs 100 kg)\n"))
+			Expect(output.String()).To(ContainSubstring("  Vehicle 1 leaves first at 0.00 hours (lowest vehicle ID among ties)\n"))
+			Expect(output.String()).To(ContainSubstring("  Vehicles: 1 at 0.57, 2 at 0.00\n  Vehicle 2 leaves first at 0.00 hours\n"))
+		})
+	})
+})
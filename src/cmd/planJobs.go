@@ -0,0 +1,377 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"courier_service/config"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a plan request run in the background. Result is set once the job
+// has succeeded and Error once it has failed.
+type Job struct {
+	ID          string        `json:"id"`
+	Status      string        `json:"status"`
+	WebhookURL  string        `json:"webhookUrl,omitempty"`
+	SubmittedAt time.Time     `json:"submittedAt"`
+	StartedAt   *time.Time    `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time    `json:"finishedAt,omitempty"`
+	Result      *PlanResponse `json:"result,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+type planJob struct {
+	Job
+	keyID      string
+	secretHash string
+	request    PlanRequest
+	packages   []Package
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// maxSearchPackages is the most packages the shipment search can hold in
+// the int bit masks it enumerates subsets with.
+const maxSearchPackages = 62
+
+var (
+	errJobQueueFull = errors.New("The plan queue is full")
+	errJobNotFound  = errors.New("Job not found")
+)
+
+// jobQueue runs plan jobs on a fixed number of workers. Jobs wait in a
+// bounded queue; a job that does not fit is refused rather than held.
+type jobQueue struct {
+	mu        sync.Mutex
+	settings  config.JobSettings
+	jobs      map[string]*planJob
+	submitted int
+	pending   chan *planJob
+	workers   sync.WaitGroup
+	ctx       context.Context
+	stop      context.CancelFunc
+	client    *http.Client
+	now       func() time.Time
+	plan      func(ctx context.Context, request PlanRequest, packages []Package) (PlanResponse, error)
+}
+
+func newJobQueue(settings config.JobSettings) *jobQueue {
+	ctx, stop := context.WithCancel(context.Background())
+	queue := &jobQueue{
+		settings: settings,
+		jobs:     make(map[string]*planJob),
+		pending:  make(chan *planJob, settings.QueueSize),
+		ctx:      ctx,
+		stop:     stop,
+		now:      time.Now,
+		plan:     runPlanRequest,
+	}
+	queue.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: queue.dialWebhook},
+	}
+
+	workers := settings.Workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	for i := 0; i < workers; i++ {
+		queue.workers.Add(1)
+		go queue.work()
+	}
+	return queue
+}
+
+func runPlanRequest(ctx context.Context, request PlanRequest, packages []Package) (PlanResponse, error) {
+	trips, unscheduled, _ := planFleet(ctx, packages, request.NumVehicles, request.MaxSpeed, request.MaxLoad, request.BaseDeliveryCost, SchedulerOptions{})
+	if trips == nil {
+		trips = []Trip{}
+	}
+	if unscheduled == nil {
+		unscheduled = []Package{}
+	}
+	return PlanResponse{Trips: trips, Unscheduled: unscheduled, TimedOut: isPlanTimedOut(ctx)}, nil
+}
+
+// getMaxPackages is the most packages a plan request may carry.
+func (q *jobQueue) getMaxPackages() int {
+	if q.settings.MaxPackages == 0 || q.settings.MaxPackages > maxSearchPackages {
+		return maxSearchPackages
+	}
+	return q.settings.MaxPackages
+}
+
+// Close stops the workers. Jobs still queued are left as they are.
+func (q *jobQueue) Close() {
+	q.stop()
+	q.workers.Wait()
+}
+
+func (q *jobQueue) submit(keyID, secretHash string, request PlanRequest, packages []Package) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.purge()
+	ctx, cancel := context.WithCancel(q.ctx)
+	job := &planJob{
+		Job:        Job{ID: fmt.Sprintf("JOB-%d", q.submitted+1), Status: JobQueued, WebhookURL: request.WebhookURL, SubmittedAt: q.now()},
+		keyID:      keyID,
+		secretHash: secretHash,
+		request:    request,
+		packages:   packages,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	select {
+	case q.pending <- job:
+	default:
+		cancel()
+		return Job{}, errJobQueueFull
+	}
+	q.jobs[job.ID] = job
+	q.submitted++
+	return job.Job, nil
+}
+
+// get returns a job submitted with keyID, or with any key when keyID is
+// empty.
+func (q *jobQueue) get(id, keyID string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.purge()
+	job, found := q.jobs[id]
+	if !found || (keyID != "" && job.keyID != keyID) {
+		return Job{}, errJobNotFound
+	}
+	return job.Job, nil
+}
+
+// cancel stops a job that has not finished. A queued job never runs; a
+// running job stops planning and its result is dropped.
+func (q *jobQueue) cancel(id, keyID string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, found := q.jobs[id]
+	if !found || (keyID != "" && job.keyID != keyID) {
+		return Job{}, errJobNotFound
+	}
+	if job.Status != JobQueued && job.Status != JobRunning {
+		return job.Job, fmt.Errorf("Job %s has already %s", id, job.Status)
+	}
+
+	job.cancel()
+	q.finish(job, JobCancelled)
+	return job.Job, nil
+}
+
+// purge drops finished jobs older than the retention period. The caller
+// holds the lock.
+func (q *jobQueue) purge() {
+	if q.settings.RetentionMinutes == 0 {
+		return
+	}
+	cutoff := q.now().Add(-time.Duration(q.settings.RetentionMinutes * float64(time.Minute)))
+	for id, job := range q.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// finish moves a job to a final status. The caller holds the lock.
+func (q *jobQueue) finish(job *planJob, status string) {
+	finishedAt := q.now()
+	job.Status, job.FinishedAt = status, &finishedAt
+}
+
+func (q *jobQueue) work() {
+	defer q.workers.Done()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case job := <-q.pending:
+			q.run(job)
+		}
+	}
+}
+
+func (q *jobQueue) run(job *planJob) {
+	q.mu.Lock()
+	if job.Status != JobQueued {
+		q.mu.Unlock()
+		return
+	}
+	startedAt := q.now()
+	job.Status, job.StartedAt = JobRunning, &startedAt
+	q.mu.Unlock()
+
+	result, err := q.runSafely(job)
+
+	q.mu.Lock()
+	if job.Status != JobRunning {
+		q.mu.Unlock()
+		return
+	}
+	if err != nil {
+		job.Error = err.Error()
+		q.finish(job, JobFailed)
+	} else {
+		job.Result = &result
+		q.finish(job, JobSucceeded)
+	}
+	finished := job.Job
+	q.mu.Unlock()
+
+	if finished.WebhookURL != "" {
+		q.deliverWebhook(finished, job.keyID, job.secretHash)
+	}
+}
+
+// runSafely runs the plan within the job timeout, turning a panic into a
+// failed job rather than taking the server down.
+func (q *jobQueue) runSafely(job *planJob) (result PlanResponse, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("Plan failed: %v", recovered)
+		}
+	}()
+
+	ctx := job.ctx
+	if q.settings.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(q.settings.TimeoutSeconds*float64(time.Second)))
+		defer cancel()
+	}
+	return q.plan(ctx, job.request, job.packages)
+}
+
+// deliverWebhook posts the finished job to its webhook, signed like an API
+// request with the key the job was submitted with. Failed deliveries are
+// retried with exponential backoff.
+func (q *jobQueue) deliverWebhook(job Job, keyID, secretHash string) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+
+	attempts := q.settings.WebhookAttempts
+	if attempts == 0 {
+		attempts = 1
+	}
+	backoff := time.Duration(q.settings.WebhookBackoffSeconds * float64(time.Second))
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = q.postWebhook(job.WebhookURL, keyID, secretHash, body)
+		if err == nil {
+			return
+		}
+		requestLog.Printf("Webhook for job %s failed (attempt %d of %d): %s", job.ID, attempt, attempts, err)
+		if attempt == attempts {
+			return
+		}
+
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (q *jobQueue) postWebhook(webhookURL, keyID, secretHash string, body []byte) error {
+	target, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(q.ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(q.now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(keyIDHeader, keyID)
+	request.Header.Set(timestampHeader, timestamp)
+	request.Header.Set(signatureHeader, signRequest(secretHash, http.MethodPost, target.RequestURI(), timestamp, body))
+
+	response, err := q.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("Webhook answered %s", response.Status)
+	}
+	return nil
+}
+
+// dialWebhook connects to a webhook host. Unless the host is allowed, the
+// address it resolves to must be public, so that a webhook cannot be used to
+// reach the server's own network.
+func (q *jobQueue) dialWebhook(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(q.settings.WebhookAllowedHosts, host) {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalAddress(ip) {
+				return fmt.Errorf("Webhook address %s is not public", host)
+			}
+			return nil
+		}
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// isInternalAddress tells whether ip is a loopback, link-local, private,
+// multicast or unspecified address.
+func isInternalAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// isValidWebhookURL checks that a webhook is an http(s) URL. A host given as
+// localhost or as an internal IP address is refused unless it is allowed;
+// names that resolve to one are refused when the webhook is posted.
+func isValidWebhookURL(webhookURL string, allowedHosts []string) bool {
+	target, err := url.Parse(webhookURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return false
+	}
+
+	host := target.Hostname()
+	if slices.Contains(allowedHosts, host) {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return host != "localhost" && (ip == nil || !isInternalAddress(ip))
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"courier_service/config"
+	"courier_service/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("plan jobs", func() {
+	const plan = `{"baseDeliveryCost":100,"packages":["PKG1 50 30 NA","PKG2 75 125 NA"],"numVehicles":1,"maxSpeed":70,"maxLoad":100}`
+
+	var (
+		handler http.Handler
+		jobs    *jobQueue
+		release chan struct{}
+	)
+	secretHash := hashAPISecret("secret")
+
+	blockingPlan := func(ctx context.Context, request PlanRequest, packages []Package) (PlanResponse, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return PlanResponse{Trips: []Trip{}, Unscheduled: []Package{}}, nil
+	}
+
+	BeforeEach(func() {
+		viper.Set("weightCostPerKG", 10)
+		viper.Set("distanceCostPerKM", 5)
+
+		repository := store.NewMemoryStore()
+		repository.SaveAPIKey(store.APIKey{Name: "partner", SecretHash: secretHash, Scopes: []string{store.ScopePlan}})
+		repository.SaveAPIKey(store.APIKey{Name: "other", SecretHash: secretHash, Scopes: []string{store.ScopePlan}})
+		jobs = newJobQueue(config.JobSettings{Workers: 1, QueueSize: 1, WebhookAttempts: 3, WebhookBackoffSeconds: 0.01})
+		handler = newAPIHandler(repository, jobs)
+		release = make(chan struct{})
+	})
+
+	AfterEach(func() {
+		jobs.Close()
+	})
+
+	request := func(method, keyID, path, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+keyID+".secret")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	getJob := func(keyID, id string) Job {
+		var job Job
+		json.Unmarshal(request(http.MethodGet, keyID, "/v1/jobs/"+id, "").Body.Bytes(), &job)
+		return job
+	}
+
+	It("should run a submitted plan in the background", func() {
+		recorder := request(http.MethodPost, "KEY-1", "/v1/plans", plan)
+
+		Expect(recorder.Code).To(Equal(http.StatusAccepted))
+		Expect(recorder.Header().Get("Location")).To(Equal("/v1/jobs/JOB-1"))
+		Eventually(func() string { return getJob("KEY-1", "JOB-1").Status }).Should(Equal(JobSucceeded))
+
+		job := getJob("KEY-1", "JOB-1")
+		Expect(job.Result.Trips).To(HaveLen(2))
+		Expect(job.StartedAt).ToNot(BeNil())
+		Expect(job.FinishedAt).ToNot(BeNil())
+	})
+
+	It("should stop planning at the job timeout and report the partial plan", func() {
+		jobs.settings.TimeoutSeconds = 0.05
+		var packages []string
+		for i := 1; i <= 30; i++ {
+			packages = append(packages, fmt.Sprintf(`"PKG%d %d 30 NA"`, i, 10+i))
+		}
+		largePlan := `{"baseDeliveryCost":100,"packages":[` + strings.Join(packages, ",") + `],"numVehicles":1,"maxSpeed":70,"maxLoad":200}`
+
+		Expect(request(http.MethodPost, "KEY-1", "/v1/plans", largePlan).Code).To(Equal(http.StatusAccepted))
+		Eventually(func() string { return getJob("KEY-1", "JOB-1").Status }, "5s").Should(Equal(JobSucceeded))
+
+		job := getJob("KEY-1", "JOB-1")
+		Expect(job.Result.TimedOut).To(BeTrue())
+		Expect(job.Result.Unscheduled).ToNot(BeEmpty())
+	})
+
+	It("should refuse requests with more packages than allowed", func() {
+		jobs.settings.MaxPackages = 1
+
+		recorder := request(http.MethodPost, "KEY-1", "/v1/plans", plan)
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"error":"A plan request may have at most 1 packages"}`))
+		jobs.settings.MaxPackages = 0
+		Expect(jobs.getMaxPackages()).To(Equal(maxSearchPackages))
+	})
+
+	It("should only show a job to the key that submitted it", func() {
+		request(http.MethodPost, "KEY-1", "/v1/plans", plan)
+
+		recorder := request(http.MethodGet, "KEY-2", "/v1/jobs/JOB-1", "")
+
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"error":"Job JOB-1 not found"}`))
+	})
+
+	It("should cancel queued and running jobs", func() {
+		jobs.plan = blockingPlan
+		request(http.MethodPost, "KEY-1", "/v1/plans", plan)
+		Eventually(func() string { return getJob("KEY-1", "JOB-1").Status }).Should(Equal(JobRunning))
+		request(http.MethodPost, "KEY-1", "/v1/plans", plan)
+
+		Expect(request(http.MethodPost, "KEY-1", "/v1/jobs/JOB-2/cancel", "").Code).To(Equal(http.StatusOK))
+		Expect(request(http.MethodPost, "KEY-1", "/v1/jobs/JOB-1/cancel", "").Code).To(Equal(http.StatusOK))
+
+		Expect(getJob("KEY-1", "JOB-1").Status).To(Equal(JobCancelled))
+		Expect(getJob("KEY-1", "JOB-2").Status).To(Equal(JobCancelled))
+		Expect(getJob("KEY-1", "JOB-2").StartedAt).To(BeNil())
+
+		recorder := request(http.MethodPost, "KEY-1", "/v1/jobs/JOB-1/cancel", "")
+		Expect(recorder.Code).To(Equal(http.StatusConflict))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"error":"Job JOB-1 has already cancelled"}`))
+	})
+
+	It("should refuse jobs once the queue is full", func() {
+		jobs.plan = blockingPlan
+		defer close(release)
+		request(http.MethodPost, "KEY-1", "/v1/plans", plan)
+		Eventually(func() string { return getJob("KEY-1", "JOB-1").Status }).Should(Equal(JobRunning))
+		request(http.MethodPost, "KEY-1", "/v1/plans", plan)
+
+		recorder := request(http.MethodPost, "KEY-1", "/v1/plans", plan)
+
+		Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(recorder.Header().Get("Retry-After")).To(Equal("1"))
+	})
+
+	It("should drop finished jobs after the retention period", func() {
+		now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+		var mu sync.Mutex
+		jobs.settings.RetentionMinutes = 60
+		jobs.now = func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		}
+
+		request(http.MethodPost, "KEY-1", "/v1/plans", plan)
+		Eventually(func() string { return getJob("KEY-1", "JOB-1").Status }).Should(Equal(JobSucceeded))
+
+		mu.Lock()
+		now = now.Add(61 * time.Minute)
+		mu.Unlock()
+		Expect(request(http.MethodGet, "KEY-1", "/v1/jobs/JOB-1", "").Code).To(Equal(http.StatusNotFound))
+		Expect(request(http.MethodPost, "KEY-1", "/v1/plans", plan).Header().Get("Location")).To(Equal("/v1/jobs/JOB-2"))
+	})
+
+	It("should post the finished job to its webhook, retrying failures", func() {
+		var (
+			mu         sync.Mutex
+			attempts   int
+			delivered  Job
+			signatures []bool
+		)
+		stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			defer mu.Unlock()
+
+			attempts++
+			expected := signRequest(secretHash, r.Method, r.URL.RequestURI(), r.Header.Get(timestampHeader), body)
+			signatures = append(signatures, r.Header.Get(keyIDHeader) == "KEY-1" && r.Header.Get(signatureHeader) == expected)
+			if attempts == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			json.Unmarshal(body, &delivered)
+		}))
+		defer stub.Close()
+		jobs.settings.WebhookAllowedHosts = []string{"127.0.0.1"}
+
+		webhookPlan := strings.Replace(plan, `"maxLoad":100`, `"maxLoad":100,"webhookUrl":"`+stub.URL+`/hooks/plans"`, 1)
+		Expect(request(http.MethodPost, "KEY-1", "/v1/plans", webhookPlan).Code).To(Equal(http.StatusAccepted))
+
+		Eventually(func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return attempts
+		}).Should(Equal(2))
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(signatures).To(Equal([]bool{true, true}))
+		Expect(delivered.ID).To(Equal("JOB-1"))
+		Expect(delivered.Status).To(Equal(JobSucceeded))
+	})
+
+	It("should reject an invalid webhook URL", func() {
+		webhookPlan := strings.Replace(plan, `"maxLoad":100`, `"maxLoad":100,"webhookUrl":"ftp://example.com"`, 1)
+
+		recorder := request(http.MethodPost, "KEY-1", "/v1/plans", webhookPlan)
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"error":"Invalid webhook URL ftp://example.com"}`))
+
+		for _, webhookURL := range []string{"http://localhost:8080/hooks", "http://10.0.0.1/hooks", "http://[::1]/hooks", "http://169.254.169.254/latest"} {
+			webhookPlan = strings.Replace(plan, `"maxLoad":100`, `"maxLoad":100,"webhookUrl":"`+webhookURL+`"`, 1)
+			Expect(request(http.MethodPost, "KEY-1", "/v1/plans", webhookPlan).Code).To(Equal(http.StatusBadRequest))
+		}
+	})
+
+	It("should not post webhooks to internal addresses unless the host is allowed", func() {
+		var posted atomic.Int32
+		stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			posted.Add(1)
+		}))
+		defer stub.Close()
+
+		err := jobs.postWebhook(stub.URL+"/hooks/plans", "KEY-1", secretHash, []byte("{}"))
+
+		Expect(err).To(MatchError(ContainSubstring("Webhook address 127.0.0.1 is not public")))
+		Expect(posted.Load()).To(BeZero())
+
+		jobs.settings.WebhookAllowedHosts = []string{"127.0.0.1"}
+		Expect(jobs.postWebhook(stub.URL+"/hooks/plans", "KEY-1", secretHash, []byte("{}"))).To(Succeed())
+		Expect(posted.Load()).To(Equal(int32(1)))
+	})
+})
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// subsetSearchCheckInterval is how many subsets the shipment search tries
+// between checks of its context, keeping the check off the hot path.
+const subsetSearchCheckInterval = 1024
+
+var planTimeout time.Duration
+
+// newPlanContext bounds planning by the --timeout flag; zero means planning
+// runs until it is done.
+func newPlanContext(timeout time.Duration) (context.Context, context.CancelFunc, error) {
+	if timeout < 0 {
+		return nil, nil, fmt.Errorf("Invalid plan timeout")
+	}
+	if timeout == 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	return ctx, cancel, nil
+}
+
+func isPlanTimedOut(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+func printPlanTimedOut(timeout time.Duration) {
+	fmt.Printf("Plan status: timed out after %s; showing the best partial plan found\n", timeout)
+	fmt.Println("Packages not planned in time are listed as unscheduled.")
+	fmt.Println()
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("plan timeout", func() {
+	packages := []Package{
+		{ID: "PKG1", Weight: 50, Distance: 30},
+		{ID: "PKG2", Weight: 75, Distance: 125},
+		{ID: "PKG3", Weight: 175, Distance: 100},
+	}
+
+	Describe("calculateDeliveryTime", func() {
+		It("should leave every package unscheduled once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			trips, unscheduled := calculateDeliveryTime(ctx, packages, 1, 70, 200, 100, SchedulerOptions{})
+
+			Expect(trips).To(BeEmpty())
+			Expect(unscheduled).To(HaveLen(3))
+		})
+	})
+
+	Describe("getShipmentsSubSetsWhichFallsUnderMaxCarriable", func() {
+		It("should stop the search once the context is done", func() {
+			var many []Package
+			for i := 0; i < 12; i++ {
+				many = append(many, Package{ID: fmt.Sprintf("PKG%d", i+1), Weight: 10, Distance: 10})
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			Expect(getShipmentsSubSetsWhichFallsUnderMaxCarriable(ctx, many, Capacity{Weight: 1000}, nil)).ToNot(ContainElement(HaveLen(12)))
+			Expect(getShipmentsSubSetsWhichFallsUnderMaxCarriable(context.Background(), many, Capacity{Weight: 1000}, nil)).To(Equal([][]int{{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}}))
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with --timeout", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			planTimeout = 0
+		})
+
+		It("should show the partial plan with a timed out status", func() {
+			planTimeout = time.Nanosecond
+
+			args := []string{"100", "2", "PKG1 50 30 NA", "PKG2 75 125 NA", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Plan status: timed out after 1ns; showing the best partial plan found\n"))
+			Expect(output.String()).To(ContainSubstring("Packages that could not be scheduled:\n  PKG1\n  PKG2\n"))
+		})
+
+		It("should plan in full within the time limit", func() {
+			planTimeout = time.Minute
+
+			args := []string{"100", "1", "PKG1 50 30 NA", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).ToNot(ContainSubstring("Plan status"))
+			Expect(output.String()).ToNot(ContainSubstring("could not be scheduled"))
+		})
+
+		It("should reject a negative timeout", func() {
+			planTimeout = -time.Second
+
+			args := []string{"100", "1", "PKG1 50 30 NA", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			Expect(err).To(MatchError("Invalid plan timeout"))
+		})
+	})
+})
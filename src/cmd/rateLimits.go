@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"courier_service/config"
+	"courier_service/store"
+)
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// endpointLimiter enforces the EndpointLimits of one kind of endpoint: a
+// token bucket per API key and a cap on requests running at once.
+type endpointLimiter struct {
+	mu      sync.Mutex
+	limits  config.EndpointLimits
+	buckets map[string]*tokenBucket
+	running chan struct{}
+	now     func() time.Time
+}
+
+func newEndpointLimiter(limits config.EndpointLimits) *endpointLimiter {
+	limiter := &endpointLimiter{limits: limits, buckets: make(map[string]*tokenBucket), now: time.Now}
+	if limits.MaxConcurrent > 0 {
+		limiter.running = make(chan struct{}, limits.MaxConcurrent)
+	}
+	return limiter
+}
+
+// take spends one of the key's tokens. When the bucket is empty it returns
+// how long until the next token is due instead.
+func (l *endpointLimiter) take(keyID string) (bool, time.Duration) {
+	if l.limits.RequestsPerSecond == 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	burst := math.Max(float64(l.limits.Burst), 1)
+	now := l.now()
+	bucket, found := l.buckets[keyID]
+	if !found {
+		bucket = &tokenBucket{tokens: burst, updated: now}
+		l.buckets[keyID] = bucket
+	}
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.limits.RequestsPerSecond)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.limits.RequestsPerSecond * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+func (l *endpointLimiter) acquire() bool {
+	if l.running == nil {
+		return true
+	}
+	select {
+	case l.running <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *endpointLimiter) release() {
+	if l.running != nil {
+		<-l.running
+	}
+}
+
+// writeTooManyRequests answers 429 with a Retry-After of whole seconds,
+// rounded up so that a client retrying then finds a token.
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeError(w, http.StatusTooManyRequests, message)
+}
+
+func limitRequests(limiter *endpointLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, _ := r.Context().Value(apiKeyContextKey).(store.APIKey)
+		if allowed, retryAfter := limiter.take(key.ID); !allowed {
+			writeTooManyRequests(w, retryAfter, "Rate limit exceeded")
+			return
+		}
+		if !limiter.acquire() {
+			writeTooManyRequests(w, time.Second, "Too many requests in progress")
+			return
+		}
+		defer limiter.release()
+
+		next(w, r)
+	}
+}
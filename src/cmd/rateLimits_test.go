@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"courier_service/config"
+	"courier_service/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("rate limits", func() {
+	Describe("endpointLimiter", func() {
+		It("should refill each key's bucket over time", func() {
+			now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+			limiter := newEndpointLimiter(config.EndpointLimits{RequestsPerSecond: 0.5, Burst: 2})
+			limiter.now = func() time.Time { return now }
+
+			Expect(limiter.take("KEY-1")).To(BeTrue())
+			Expect(limiter.take("KEY-1")).To(BeTrue())
+			allowed, retryAfter := limiter.take("KEY-1")
+			Expect(allowed).To(BeFalse())
+			Expect(retryAfter).To(Equal(2 * time.Second))
+			Expect(limiter.take("KEY-2")).To(BeTrue())
+
+			now = now.Add(time.Second)
+			allowed, retryAfter = limiter.take("KEY-1")
+			Expect(allowed).To(BeFalse())
+			Expect(retryAfter).To(Equal(time.Second))
+
+			now = now.Add(time.Second)
+			Expect(limiter.take("KEY-1")).To(BeTrue())
+		})
+
+		It("should cap the requests running at once", func() {
+			limiter := newEndpointLimiter(config.EndpointLimits{MaxConcurrent: 1})
+
+			Expect(limiter.acquire()).To(BeTrue())
+			Expect(limiter.acquire()).To(BeFalse())
+			limiter.release()
+			Expect(limiter.acquire()).To(BeTrue())
+		})
+
+		It("should not limit when no limits are set", func() {
+			limiter := newEndpointLimiter(config.EndpointLimits{})
+
+			for i := 0; i < 100; i++ {
+				Expect(limiter.take("KEY-1")).To(BeTrue())
+				Expect(limiter.acquire()).To(BeTrue())
+			}
+		})
+	})
+
+	Describe("API", func() {
+		var (
+			handler http.Handler
+			jobs    *jobQueue
+		)
+
+		BeforeEach(func() {
+			viper.Set("rateLimits", map[string]interface{}{
+				"quote": map[string]interface{}{"requestsPerSecond": 1, "burst": 1},
+				"plan":  map[string]interface{}{"requestsPerSecond": 0.1, "burst": 1},
+			})
+			viper.Set("weightCostPerKG", 10)
+			viper.Set("distanceCostPerKM", 5)
+
+			repository := store.NewMemoryStore()
+			repository.SaveAPIKey(store.APIKey{Name: "partner", SecretHash: hashAPISecret("secret"), Scopes: []string{store.ScopePlan}})
+			repository.SaveAPIKey(store.APIKey{Name: "other", SecretHash: hashAPISecret("secret"), Scopes: []string{store.ScopePlan}})
+			jobs = newJobQueue(config.JobSettings{Workers: 1, QueueSize: 4})
+			handler = newAPIHandler(repository, jobs)
+		})
+
+		AfterEach(func() {
+			viper.Set("rateLimits", map[string]interface{}{})
+			jobs.Close()
+		})
+
+		post := func(keyID, path, body string) *httptest.ResponseRecorder {
+			request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			request.Header.Set("Authorization", "Bearer "+keyID+".secret")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			return recorder
+		}
+
+		It("should answer 429 with Retry-After once a key's quota is spent", func() {
+			plan := `{"baseDeliveryCost":100,"packages":["PKG1 50 30 NA"],"numVehicles":1,"maxSpeed":70,"maxLoad":200}`
+
+			Expect(post("KEY-1", "/v1/plans", plan).Code).To(Equal(http.StatusAccepted))
+			recorder := post("KEY-1", "/v1/plans", plan)
+
+			Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(recorder.Header().Get("Retry-After")).To(Equal("10"))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"error":"Rate limit exceeded"}`))
+			Expect(post("KEY-2", "/v1/plans", plan).Code).To(Equal(http.StatusAccepted))
+		})
+
+		It("should keep separate quotas for quote and plan calls", func() {
+			Expect(post("KEY-1", "/v1/plans", `{"baseDeliveryCost":100,"packages":["PKG1 50 30 NA"],"numVehicles":1,"maxSpeed":70,"maxLoad":200}`).Code).To(Equal(http.StatusAccepted))
+
+			recorder := post("KEY-1", "/v1/quotes", `{"baseDeliveryCost":100,"packages":["PKG1 50 30 NA"]}`)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(post("KEY-1", "/v1/quotes", `{"baseDeliveryCost":100,"packages":["PKG1 50 30 NA"]}`).Header().Get("Retry-After")).To(Equal("1"))
+		})
+	})
+})
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"courier_service/config"
+	"courier_service/store"
+)
+
+// getReattemptFee is what a package pays for its failed delivery attempts: the
+// flat fee plus a share of its delivery price, once for every attempt.
+func getReattemptFee(price float64, attempts int) float64 {
+	fees := config.GetReattemptFees()
+	return float64(attempts) * (fees.FlatFee + price*fees.PriceRate)
+}
+
+// getDispatchPriority is the service level priority of a package, raised one
+// level for every failed attempt up to the highest level, so packages that
+// already missed a drop go out ahead of fresh ones.
+func getDispatchPriority(pkg Package) int {
+	priority := serviceLevelPriority[getServiceLevel(pkg)] + pkg.Attempts
+	return min(priority, len(serviceLevelPriority)-1)
+}
+
+// addReattempts brings the failed attempts kept in the store onto the
+// packages of the batch and adds every failed package the batch does not
+// name, so failed deliveries go out again with the next plan.
+func addReattempts(repository store.Repository, packages []Package, baseDeliveryCost int) ([]Package, error) {
+	if err := loadPackageStatuses(repository, packages); err != nil {
+		return nil, err
+	}
+	if err := priceStoredPackages(repository, packages, baseDeliveryCost); err != nil {
+		return nil, err
+	}
+
+	offers := config.GetOffers()
+	inBatch := make(map[string]bool)
+	for i := range packages {
+		inBatch[packages[i].ID] = true
+	}
+
+	stored, err := repository.ListPackages()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(stored, func(i, j int) bool { return stored[i].ID < stored[j].ID })
+	for _, pkg := range stored {
+		if pkg.Status != store.StatusFailed || inBatch[pkg.ID] {
+			continue
+		}
+		reattempt := Package{
+			ID:           pkg.ID,
+			Weight:       pkg.Weight,
+			Volume:       pkg.Volume,
+			Distance:     pkg.Distance,
+			OfferCode:    pkg.OfferCode,
+			ServiceLevel: pkg.ServiceLevel,
+			CustomerID:   pkg.CustomerID,
+			Status:       pkg.Status,
+			Attempts:     pkg.Attempts,
+		}
+		if err := priceStoredPackage(repository, &reattempt, baseDeliveryCost, offers); err != nil {
+			return nil, err
+		}
+		packages = append(packages, reattempt)
+	}
+
+	return packages, nil
+}
+
+// priceStoredPackages prices again the packages whose stored details change
+// their price: a customer's packages go under its contract and failed
+// packages pay their re-attempt fees.
+func priceStoredPackages(repository store.Repository, packages []Package, baseDeliveryCost int) error {
+	offers := config.GetOffers()
+	for i := range packages {
+		if packages[i].CustomerID == "" && packages[i].Attempts == 0 {
+			continue
+		}
+		if err := priceStoredPackage(repository, &packages[i], baseDeliveryCost, offers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newPackagePricer prices a package again once its road distance is known,
+// through priceStoredPackage so that a customer's package keeps its contract
+// price. The repository may be nil when nothing is stored.
+func newPackagePricer(repository store.Repository, baseDeliveryCost int) func(pkg *Package) error {
+	offers := config.GetOffers()
+	return func(pkg *Package) error {
+		return priceStoredPackage(repository, pkg, baseDeliveryCost, offers)
+	}
+}
+
+// priceStoredPackage prices a package at public rates, or under its
+// customer's contract when it has one, re-attempt fees included.
+func priceStoredPackage(repository store.Repository, pkg *Package, baseDeliveryCost int, offers []config.Offer) error {
+	if pkg.CustomerID == "" {
+		pricePackage(pkg, baseDeliveryCost, offers)
+		return nil
+	}
+
+	customer, err := loadCustomer(repository, pkg.CustomerID)
+	if err != nil {
+		return err
+	}
+	serviceLevel := getServiceLevel(*pkg)
+	price := calculateContractDeliveryCost(baseDeliveryCost, pkg.Weight, pkg.Distance, pkg.OfferCode, offers, customer)
+	totalCost, discount, _ := applyServiceLevel(price.TotalCost, price.OfferDiscount, serviceLevel)
+	_, contractDiscount, _ := applyServiceLevel(0, price.ContractDiscount, serviceLevel)
+	pkg.ReattemptFee = getReattemptFee(totalCost, pkg.Attempts)
+	totalCost += pkg.ReattemptFee
+	pkg.OfferCode = price.OfferCode
+	pkg.TotalCost = totalCost
+	pkg.ContractDiscount = contractDiscount
+	pkg.Discount = contractDiscount + discount
+	pkg.FinalCost = totalCost - contractDiscount - discount
+	return nil
+}
+
+func printReattempts(packages []Package) {
+	var reattempts []Package
+	for _, pkg := range packages {
+		if pkg.Attempts > 0 && isSchedulable(pkg) {
+			reattempts = append(reattempts, pkg)
+		}
+	}
+	if len(reattempts) == 0 {
+		return
+	}
+
+	fmt.Println("Re-attempting failed deliveries:")
+	for _, pkg := range reattempts {
+		fmt.Printf("  %s: attempt %d, re-attempt fee %.2f\n", pkg.ID, pkg.Attempts+1, pkg.ReattemptFee)
+	}
+	fmt.Println()
+}
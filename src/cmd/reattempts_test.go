@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"courier_service/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("failed delivery attempts", func() {
+	BeforeEach(func() {
+		viper.Set("reattemptFees", map[string]interface{}{"flatFee": 50, "priceRate": 0.1})
+	})
+
+	AfterEach(func() {
+		viper.Set("reattemptFees", map[string]interface{}{})
+	})
+
+	Describe("getReattemptFee", func() {
+		It("should charge the fee once for every failed attempt", func() {
+			Expect(getReattemptFee(750, 0)).To(BeZero())
+			Expect(getReattemptFee(750, 2)).To(Equal(250.0))
+		})
+	})
+
+	Describe("getDispatchPriority", func() {
+		It("should raise the priority one level per attempt up to the highest", func() {
+			Expect(getDispatchPriority(Package{Attempts: 1})).To(Equal(serviceLevelPriority[ServiceLevelExpress]))
+			Expect(getDispatchPriority(Package{ServiceLevel: ServiceLevelExpress, Attempts: 3})).To(Equal(serviceLevelPriority[ServiceLevelSameDay]))
+		})
+	})
+
+	Describe("calculateDeliveryTime", func() {
+		It("should send a re-attempt ahead of a heavier fresh package", func() {
+			packages := []Package{
+				{ID: "PKG1", Weight: 60, Distance: 30},
+				{ID: "PKG2", Weight: 50, Distance: 30, Status: store.StatusFailed, Attempts: 1},
+			}
+
+			trips, _ := calculateDeliveryTime(context.Background(), packages, 1, 70, 100, 100, SchedulerOptions{})
+
+			Expect(trips).To(HaveLen(2))
+			Expect(getPackageIDs(trips[0].Packages)).To(Equal([]string{"PKG2"}))
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with a store", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			storePath = filepath.Join(GinkgoT().TempDir(), "store.jsonl")
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+			viper.Set("weightCostPerKG", 10)
+			viper.Set("distanceCostPerKM", 5)
+
+			repository, _ := store.NewFileStore(storePath)
+			repository.SavePackage(store.Package{ID: "PKG3", Weight: 75, Distance: 125, OfferCode: "NA"})
+			for _, status := range []string{store.StatusQuoted, store.StatusScheduled, store.StatusOutForDelivery, store.StatusFailed} {
+				repository.UpdatePackageStatus("PKG3", status, time.Now())
+			}
+			repository.Close()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			storePath = ""
+		})
+
+		It("should put failed packages back into the next plan with the fee", func() {
+			args := []string{"100", "1", "PKG1 50 30 NA", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(trackCmd.RunE(nil, []string{"PKG3"})).To(Succeed())
+
+			w.Close()
+			output.ReadFrom(r)
+			Expect(output.String()).To(ContainSubstring("Re-attempting failed deliveries:\n  PKG3: attempt 2, re-attempt fee 197.50\n"))
+			Expect(output.String()).To(ContainSubstring("Package: PKG3\n  Vehicle: 1\n  Delivery Attempt: 2\n  Re-attempt Fee: 197.50\n  Discount: 0.00\n  Total Cost: 1672.50\n"))
+			Expect(output.String()).To(ContainSubstring("Package PKG3: scheduled\n"))
+		})
+	})
+})
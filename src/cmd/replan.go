@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"courier_service/config"
+
+	"github.com/spf13/cobra"
+)
+
+// PlanState is a saved plan that replan can pick up from later in the day. It
+// keeps the fleet settings the plan was made with next to its trips.
+type PlanState struct {
+	NumVehicles int         `json:"numVehicles"`
+	MaxSpeed    int         `json:"maxSpeed"`
+	MaxLoad     int         `json:"maxLoad"`
+	MaxVolume   float64     `json:"maxVolume,omitempty"`
+	MaxPackages int         `json:"maxPackages,omitempty"`
+	Depot       *GeoPoint   `json:"depot,omitempty"`
+	Vehicles    []Vehicle   `json:"vehicles,omitempty"`
+	Breakdowns  []Breakdown `json:"breakdowns,omitempty"`
+	Trips       []Trip      `json:"trips"`
+	Unscheduled []Package   `json:"unscheduled,omitempty"`
+}
+
+var savePlanPath string
+
+func savePlanState(path string, state PlanState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("Unable to write plan file: %s", err)
+	}
+	return nil
+}
+
+func loadPlanState(path string) (PlanState, error) {
+	var state PlanState
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return state, fmt.Errorf("Unable to read plan file: %s", err)
+	}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return state, fmt.Errorf("Invalid plan file: %s", err)
+	}
+	if state.NumVehicles <= 0 || state.MaxSpeed <= 0 || state.MaxLoad <= 0 {
+		return state, fmt.Errorf("Invalid plan file: fleet settings are missing")
+	}
+
+	return state, nil
+}
+
+// splitPlanAt keeps the trips that left before the given time, since those are
+// under way or done, and hands back the packages of the later trips so they
+// can be planned again. busyUntil holds when each vehicle gets back from the
+// trips that stand.
+func splitPlanAt(trips []Trip, at float64) ([]Trip, []Package, map[int]float64) {
+	var keptTrips []Trip
+	var pending []Package
+	busyUntil := make(map[int]float64)
+
+	for _, trip := range trips {
+		if trip.Departure >= at {
+			for _, pkg := range trip.Packages {
+				pkg.DeliveryTime = 0
+				pending = append(pending, pkg)
+			}
+			continue
+		}
+
+		keptTrips = append(keptTrips, trip)
+		busyUntil[trip.VehicleID] = math.Max(busyUntil[trip.VehicleID], trip.Return)
+	}
+
+	return keptTrips, pending, busyUntil
+}
+
+// replanWithNewPackages re-plans everything that has not left the depot by the
+// given time together with the new packages. Trips already under way keep
+// their vehicle and times.
+func replanWithNewPackages(ctx context.Context, state PlanState, at float64, newPackages []Package, baseDeliveryCost int) (PlanState, []MovedShipment) {
+	keptTrips, pending, busyUntil := splitPlanAt(state.Trips, at)
+	for _, pkg := range state.Unscheduled {
+		pkg.DeliveryTime = 0
+		pending = append(pending, pkg)
+	}
+	pending = append(pending, newPackages...)
+
+	options := SchedulerOptions{
+		Depot:        state.Depot,
+		ServiceTimes: config.GetServiceTimes(),
+		Vehicles:     state.Vehicles,
+		Breakdowns:   state.Breakdowns,
+		MaxVolume:    state.MaxVolume,
+		MaxPackages:  state.MaxPackages,
+		ReadyAt:      at,
+		BusyUntil:    busyUntil,
+	}
+	replannedTrips, unscheduled := calculateDeliveryTime(ctx, pending, state.NumVehicles, state.MaxSpeed, state.MaxLoad, baseDeliveryCost, options)
+
+	updated := state
+	updated.Trips = append(keptTrips, replannedTrips...)
+	updated.Unscheduled = unscheduled
+
+	return updated, findMovedShipments(state.Trips, updated.Trips)
+}
+
+func getPlannedPackageIDs(state PlanState) map[string]bool {
+	ids := make(map[string]bool)
+	for _, trip := range state.Trips {
+		for _, pkg := range trip.Packages {
+			ids[pkg.ID] = true
+		}
+	}
+	for _, pkg := range state.Unscheduled {
+		ids[pkg.ID] = true
+	}
+	return ids
+}
+
+var replanCmd = &cobra.Command{
+	Use:   "replan",
+	Short: "Add packages to a saved plan without changing trips under way",
+	Long:  `This command loads a plan saved with --save-plan, keeps the trips that have left the depot by the given time and plans the remaining and new packages around them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 4 {
+			return fmt.Errorf("Usage: courier_service replan <plan_file> <hours_since_start> <baseDeliveryCost> <numberOfPackages> <packages>")
+		}
+
+		state, err := loadPlanState(args[0])
+		if err != nil {
+			return err
+		}
+
+		at, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || at < 0 {
+			return fmt.Errorf("Invalid re-plan time")
+		}
+
+		baseDeliveryCost, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("Invalid base delivery cost")
+		}
+
+		numPackages, err := strconv.Atoi(args[3])
+		if err != nil || numPackages < 0 || len(args) < 4+numPackages {
+			return fmt.Errorf("Invalid number of packages")
+		}
+
+		newPackages, err := parsePackages(args[4:4+numPackages], baseDeliveryCost)
+		if err != nil {
+			return err
+		}
+
+		plannedIDs := getPlannedPackageIDs(state)
+		for _, pkg := range newPackages {
+			if plannedIDs[pkg.ID] {
+				return fmt.Errorf("Package %s is already in the plan", pkg.ID)
+			}
+		}
+
+		repository, err := openStore()
+		if err != nil {
+			return err
+		}
+		if repository != nil {
+			defer repository.Close()
+			for i := range state.Trips {
+				if err := loadPackageStatuses(repository, state.Trips[i].Packages); err != nil {
+					return err
+				}
+			}
+			if err := loadPackageStatuses(repository, state.Unscheduled); err != nil {
+				return err
+			}
+			if err := loadPackageStatuses(repository, newPackages); err != nil {
+				return err
+			}
+			if err := priceStoredPackages(repository, newPackages, baseDeliveryCost); err != nil {
+				return err
+			}
+		}
+
+		ctx, cancel, err := newPlanContext(planTimeout)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		updated, moved := replanWithNewPackages(ctx, state, at, newPackages, baseDeliveryCost)
+
+		if isPlanTimedOut(ctx) {
+			printPlanTimedOut(planTimeout)
+		}
+		printTripDetails(updated.Trips, getFleetCapacity(updated.MaxLoad, SchedulerOptions{Vehicles: updated.Vehicles, MaxVolume: updated.MaxVolume, MaxPackages: updated.MaxPackages}), nil)
+		printMissedDeliveryWindows(findMissedDeliveryWindows(updated.Trips, updated.Unscheduled))
+		printUnscheduledPackages(updated.Unscheduled)
+		printMovedShipments("Shipments moved by re-planning:", moved)
+
+		if repository != nil {
+			now := time.Now()
+			for _, pkg := range newPackages {
+				if !isSchedulable(pkg) {
+					continue
+				}
+				if err := recordQuote(repository, pkg, baseDeliveryCost, now); err != nil {
+					return err
+				}
+			}
+			if err := recordScheduled(repository, updated.Trips, now); err != nil {
+				return err
+			}
+			planID, err := recordPlan(repository, updated, now)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Plan stored as %s\n", planID)
+		}
+
+		if savePlanPath != "" {
+			return savePlanState(savePlanPath, updated)
+		}
+		return nil
+	},
+}
+
+func init() {
+	replanCmd.Flags().DurationVar(&planTimeout, "timeout", 0, "Stop planning after this long and show the best partial plan found, e.g. 30s (0 for no limit)")
+	replanCmd.Flags().StringVar(&savePlanPath, "save-plan", "", "Write the updated plan to this file")
+	rootCmd.AddCommand(replanCmd)
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("replan", func() {
+	state := PlanState{
+		NumVehicles: 1,
+		MaxSpeed:    50,
+		MaxLoad:     100,
+		Trips: []Trip{
+			{VehicleID: 1, Departure: 0, Return: 2, Packages: []Package{{ID: "PKG1", Weight: 40, Distance: 50, DeliveryTime: 1}}},
+			{VehicleID: 1, Departure: 2, Return: 4, Packages: []Package{{ID: "PKG2", Weight: 40, Distance: 50, DeliveryTime: 3}}},
+		},
+	}
+
+	Describe("splitPlanAt", func() {
+		It("should keep trips under way and release the rest", func() {
+			keptTrips, pending, busyUntil := splitPlanAt(state.Trips, 1.5)
+
+			Expect(keptTrips).To(Equal(state.Trips[:1]))
+			Expect(getPackageIDs(pending)).To(Equal([]string{"PKG2"}))
+			Expect(pending[0].DeliveryTime).To(BeZero())
+			Expect(busyUntil).To(Equal(map[int]float64{1: 2}))
+		})
+	})
+
+	Describe("replanWithNewPackages", func() {
+		It("should add new packages to trips that have not left yet", func() {
+			newPackages := []Package{{ID: "PKG3", Weight: 50, Distance: 100}}
+
+			updated, moved := replanWithNewPackages(context.Background(), state, 1.5, newPackages, 100)
+
+			Expect(updated.Trips).To(HaveLen(2))
+			Expect(updated.Trips[0]).To(Equal(state.Trips[0]))
+			Expect(getPackageIDs(updated.Trips[1].Packages)).To(ConsistOf("PKG2", "PKG3"))
+			Expect(updated.Trips[1].Departure).To(Equal(2.0))
+			Expect(moved).To(BeEmpty())
+		})
+	})
+
+	Describe("ReplanCmd", func() {
+		var (
+			planPath string
+			stdout   *os.File
+			r, w     *os.File
+			output   bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			planPath = filepath.Join(GinkgoT().TempDir(), "plan.json")
+			Expect(savePlanState(planPath, state)).To(Succeed())
+
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			savePlanPath = ""
+		})
+
+		It("should print the updated plan and save it", func() {
+			savePlanPath = planPath
+
+			err := replanCmd.RunE(nil, []string{planPath, "2.5", "100", "1", "PKG3 50 100 NA"})
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Package: PKG3\n  Vehicle: 1\n"))
+			Expect(output.String()).To(ContainSubstring("Delivery Time: 6.00 hours"))
+
+			updated, err := loadPlanState(planPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated.Trips).To(HaveLen(3))
+			Expect(updated.Trips[:2]).To(Equal(state.Trips))
+		})
+
+		It("should reject packages that are already planned", func() {
+			err := replanCmd.RunE(nil, []string{planPath, "1", "100", "1", "PKG2 10 10 NA"})
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Package PKG2 is already in the plan"))
+		})
+	})
+})
@@ -0,0 +1,407 @@
+package cmd
+
+import (
+	"container/heap"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type RoadEdge struct {
+	To         string
+	Length     float64
+	SpeedLimit float64
+}
+
+// RoadNetwork is a directed road graph. Edge lengths are in km and speed
+// limits in km/h; a speed limit of 0 means the vehicle's own top speed.
+type RoadNetwork struct {
+	Nodes map[string]GeoPoint
+	Edges map[string][]RoadEdge
+
+	// admissible is false when some edge is shorter than the straight line
+	// between its ends, in which case A* would not be exact and the search
+	// falls back to plain Dijkstra.
+	admissible bool
+}
+
+type RoadPath struct {
+	Distance float64
+	Duration float64
+}
+
+var (
+	roadNetworkPath string
+	depotNode       string
+)
+
+func newRoadNetwork() *RoadNetwork {
+	return &RoadNetwork{Nodes: make(map[string]GeoPoint), Edges: make(map[string][]RoadEdge), admissible: true}
+}
+
+func loadRoadNetwork(path string) (*RoadNetwork, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open road network: %s", err)
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return parseRoadNetworkCSV(file)
+	case ".geojson", ".json":
+		return parseRoadNetworkGeoJSON(file)
+	default:
+		return nil, fmt.Errorf("Unsupported road network format %s", filepath.Ext(path))
+	}
+}
+
+// parseRoadNetworkCSV reads rows of the form
+//
+//	node,<id>,<lat>,<lon>
+//	edge,<from>,<to>,<length_km>,<speed_kmh>[,oneway]
+//
+// Nodes must be declared before the edges that use them. An empty length is
+// replaced by the straight-line distance between the two nodes.
+func parseRoadNetworkCSV(r io.Reader) (*RoadNetwork, error) {
+	network := newRoadNetwork()
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid road network: %s", err)
+	}
+
+	for i, record := range records {
+		switch strings.TrimSpace(record[0]) {
+		case "node":
+			if len(record) != 4 {
+				return nil, fmt.Errorf("Invalid road network node on line %d", i+1)
+			}
+			location, err := parseGeoPoint(record[2] + "," + record[3])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid road network node on line %d", i+1)
+			}
+			network.Nodes[strings.TrimSpace(record[1])] = *location
+		case "edge":
+			if len(record) < 5 || len(record) > 6 {
+				return nil, fmt.Errorf("Invalid road network edge on line %d", i+1)
+			}
+			length, speed, err := parseEdgeValues(record[3], record[4])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid road network edge on line %d", i+1)
+			}
+			oneway := len(record) == 6 && strings.TrimSpace(record[5]) == "oneway"
+			if err := network.addEdge(strings.TrimSpace(record[1]), strings.TrimSpace(record[2]), length, speed, oneway); err != nil {
+				return nil, fmt.Errorf("%s on line %d", err, i+1)
+			}
+		default:
+			return nil, fmt.Errorf("Invalid road network record on line %d", i+1)
+		}
+	}
+
+	return network, nil
+}
+
+func parseEdgeValues(lengthValue, speedValue string) (float64, float64, error) {
+	length := 0.0
+	if strings.TrimSpace(lengthValue) != "" {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(lengthValue), 64)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid length")
+		}
+		length = parsed
+	}
+
+	speed := 0.0
+	if strings.TrimSpace(speedValue) != "" {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(speedValue), 64)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid speed")
+		}
+		speed = parsed
+	}
+
+	return length, speed, nil
+}
+
+type geoJSONFeatureCollection struct {
+	Features []struct {
+		Geometry struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+		Properties struct {
+			ID     string  `json:"id"`
+			From   string  `json:"from"`
+			To     string  `json:"to"`
+			Length float64 `json:"length"`
+			Speed  float64 `json:"speed"`
+			Oneway bool    `json:"oneway"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+// parseRoadNetworkGeoJSON reads a FeatureCollection in which Point features
+// with an "id" property are nodes and LineString features with "from" and "to"
+// properties are roads, optionally carrying "length", "speed" and "oneway".
+func parseRoadNetworkGeoJSON(r io.Reader) (*RoadNetwork, error) {
+	var collection geoJSONFeatureCollection
+	if err := json.NewDecoder(r).Decode(&collection); err != nil {
+		return nil, fmt.Errorf("Invalid road network: %s", err)
+	}
+
+	network := newRoadNetwork()
+	for i, feature := range collection.Features {
+		if feature.Geometry.Type != "Point" {
+			continue
+		}
+		var coordinates []float64
+		if err := json.Unmarshal(feature.Geometry.Coordinates, &coordinates); err != nil || len(coordinates) < 2 || feature.Properties.ID == "" {
+			return nil, fmt.Errorf("Invalid road network node in feature %d", i+1)
+		}
+		network.Nodes[feature.Properties.ID] = GeoPoint{Latitude: coordinates[1], Longitude: coordinates[0]}
+	}
+
+	for i, feature := range collection.Features {
+		if feature.Geometry.Type != "LineString" {
+			continue
+		}
+		properties := feature.Properties
+		if properties.Length < 0 || properties.Speed < 0 {
+			return nil, fmt.Errorf("Invalid road network edge in feature %d", i+1)
+		}
+		if err := network.addEdge(properties.From, properties.To, properties.Length, properties.Speed, properties.Oneway); err != nil {
+			return nil, fmt.Errorf("%s in feature %d", err, i+1)
+		}
+	}
+
+	return network, nil
+}
+
+func (n *RoadNetwork) addEdge(from, to string, length, speed float64, oneway bool) error {
+	fromLocation, fromFound := n.Nodes[from]
+	toLocation, toFound := n.Nodes[to]
+	if !fromFound || !toFound {
+		return fmt.Errorf("Unknown road network node in edge %s-%s", from, to)
+	}
+
+	straightLine := haversineDistance(fromLocation, toLocation)
+	if length == 0 {
+		length = straightLine
+	}
+	if length < straightLine-0.001 {
+		n.admissible = false
+	}
+
+	n.Edges[from] = append(n.Edges[from], RoadEdge{To: to, Length: length, SpeedLimit: speed})
+	if !oneway {
+		n.Edges[to] = append(n.Edges[to], RoadEdge{To: from, Length: length, SpeedLimit: speed})
+	}
+
+	return nil
+}
+
+func (n *RoadNetwork) nearestNode(point GeoPoint) string {
+	nearest := ""
+	nearestDistance := math.MaxFloat64
+	for id, location := range n.Nodes {
+		distance := haversineDistance(point, location)
+		if distance < nearestDistance || (distance == nearestDistance && id < nearest) {
+			nearest = id
+			nearestDistance = distance
+		}
+	}
+	return nearest
+}
+
+func getEdgeSpeed(edge RoadEdge, maxSpeed float64) float64 {
+	if edge.SpeedLimit == 0 || edge.SpeedLimit > maxSpeed {
+		return maxSpeed
+	}
+	return edge.SpeedLimit
+}
+
+// shortestDistance is the length of the shortest road path between two nodes.
+func (n *RoadNetwork) shortestDistance(from, to string) (float64, bool) {
+	path, found := n.search(from, to, math.MaxFloat64, false)
+	return path.Distance, found
+}
+
+// fastestPath is the quickest road path between two nodes for a vehicle whose
+// top speed is maxSpeed.
+func (n *RoadNetwork) fastestPath(from, to string, maxSpeed float64) (RoadPath, bool) {
+	return n.search(from, to, maxSpeed, true)
+}
+
+type searchItem struct {
+	node     string
+	priority float64
+}
+
+type searchQueue []searchItem
+
+func (q searchQueue) Len() int           { return len(q) }
+func (q searchQueue) Less(i, j int) bool { return q[i].priority < q[j].priority }
+func (q searchQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *searchQueue) Push(item any)     { *q = append(*q, item.(searchItem)) }
+
+func (q *searchQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// search runs A* from one node to another, minimising travel time when byTime
+// is set and road length otherwise. The straight-line distance to the target,
+// driven at the vehicle's top speed, is the heuristic; it is dropped when edge
+// lengths make it unsafe, which turns the search into Dijkstra.
+func (n *RoadNetwork) search(from, to string, maxSpeed float64, byTime bool) (RoadPath, bool) {
+	if _, found := n.Nodes[from]; !found {
+		return RoadPath{}, false
+	}
+	if _, found := n.Nodes[to]; !found {
+		return RoadPath{}, false
+	}
+
+	cost := func(edge RoadEdge) float64 {
+		if byTime {
+			return edge.Length / getEdgeSpeed(edge, maxSpeed)
+		}
+		return edge.Length
+	}
+
+	heuristic := func(node string) float64 {
+		if !n.admissible {
+			return 0
+		}
+		straightLine := haversineDistance(n.Nodes[node], n.Nodes[to])
+		if byTime {
+			return straightLine / maxSpeed
+		}
+		return straightLine
+	}
+
+	costs := map[string]float64{from: 0}
+	paths := map[string]RoadPath{from: {}}
+	done := make(map[string]bool)
+	queue := &searchQueue{{node: from, priority: heuristic(from)}}
+
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(searchItem).node
+		if done[current] {
+			continue
+		}
+		if current == to {
+			return paths[current], true
+		}
+		done[current] = true
+
+		for _, edge := range n.Edges[current] {
+			nextCost := costs[current] + cost(edge)
+			if known, found := costs[edge.To]; found && known <= nextCost {
+				continue
+			}
+			costs[edge.To] = nextCost
+			paths[edge.To] = RoadPath{
+				Distance: paths[current].Distance + edge.Length,
+				Duration: paths[current].Duration + edge.Length/getEdgeSpeed(edge, maxSpeed),
+			}
+			heap.Push(queue, searchItem{node: edge.To, priority: nextCost + heuristic(edge.To)})
+		}
+	}
+
+	return RoadPath{}, false
+}
+
+// resolveRoadNodes finds the depot node and places every package on the road
+// network, either by its node= option or by snapping its coordinates to the
+// nearest node.
+func resolveRoadNodes(network *RoadNetwork, packages []Package, depotNodeID, depotLocation string) (string, error) {
+	depot := depotNodeID
+	if depot == "" {
+		if depotLocation == "" {
+			return "", fmt.Errorf("Road network requires --depot or --depot-node")
+		}
+		location, err := parseGeoPoint(depotLocation)
+		if err != nil {
+			return "", fmt.Errorf("Invalid depot location")
+		}
+		depot = network.nearestNode(*location)
+	}
+	if _, found := network.Nodes[depot]; !found {
+		return "", fmt.Errorf("Unknown depot node %s", depot)
+	}
+
+	for i := range packages {
+		if err := resolvePackageRoadNode(network, &packages[i], depot); err != nil {
+			return "", err
+		}
+	}
+
+	return depot, nil
+}
+
+func resolvePackageRoadNode(network *RoadNetwork, pkg *Package, depot string) error {
+	if pkg.RoadNode == "" && pkg.Location != nil {
+		pkg.RoadNode = network.nearestNode(*pkg.Location)
+	}
+	if pkg.RoadNode == "" {
+		return nil
+	}
+	if _, found := network.Nodes[pkg.RoadNode]; !found {
+		return fmt.Errorf("Unknown road network node %s for package %s", pkg.RoadNode, pkg.ID)
+	}
+
+	_, outbound := network.shortestDistance(depot, pkg.RoadNode)
+	_, inbound := network.shortestDistance(pkg.RoadNode, depot)
+	if !outbound || !inbound {
+		return fmt.Errorf("Package %s is not reachable from the depot on the road network", pkg.ID)
+	}
+
+	return nil
+}
+
+// getRoadDistance is the road distance from the depot to a package, rounded to
+// whole km for pricing.
+func getRoadDistance(network *RoadNetwork, depot string, pkg Package) (int, bool) {
+	if pkg.RoadNode == "" {
+		return 0, false
+	}
+	distance, found := network.shortestDistance(depot, pkg.RoadNode)
+	return int(math.Round(distance)), found
+}
+
+// loadRoadDistances loads the road network, places the packages on it and
+// re-prices every package on the network by its road distance from the depot.
+func loadRoadDistances(path string, packages []Package, price func(pkg *Package) error) (*RoadNetwork, string, error) {
+	network, err := loadRoadNetwork(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	depot, err := resolveRoadNodes(network, packages, depotNode, depotLocation)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range packages {
+		if distance, found := getRoadDistance(network, depot, packages[i]); found {
+			packages[i].Distance = distance
+			if err := price(&packages[i]); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	return network, depot, nil
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/spf13/viper"
+)
+
+const testRoadNetworkCSV = `# id, lat, lon
+node,D,0,0
+node,A,0,1
+node,H,0.5,0.5
+node,X,5,5
+# from, to, length km, speed km/h
+edge,D,A,120,30
+edge,D,H,80,100
+edge,H,A,80,100
+edge,D,X,,60,oneway
+`
+
+var _ = Describe("RoadNetwork", func() {
+	var network *RoadNetwork
+
+	BeforeEach(func() {
+		var err error
+		network, err = parseRoadNetworkCSV(strings.NewReader(testRoadNetworkCSV))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should find the shortest road distance", func() {
+		distance, found := network.shortestDistance("D", "A")
+
+		Expect(found).To(BeTrue())
+		Expect(distance).To(Equal(120.0))
+	})
+
+	It("should find the fastest path within the vehicle speed", func() {
+		path, found := network.fastestPath("D", "A", 70)
+
+		Expect(found).To(BeTrue())
+		Expect(path.Distance).To(Equal(160.0))
+		Expect(path.Duration).To(BeNumerically("~", 160.0/70, 1e-9))
+	})
+
+	It("should respect one-way roads", func() {
+		_, found := network.shortestDistance("X", "D")
+		Expect(found).To(BeFalse())
+
+		distance, found := network.shortestDistance("D", "X")
+		Expect(found).To(BeTrue())
+		Expect(distance).To(BeNumerically("~", haversineDistance(GeoPoint{0, 0}, GeoPoint{5, 5}), 1e-9))
+	})
+
+	It("should snap coordinates to the nearest node", func() {
+		Expect(network.nearestNode(GeoPoint{0.1, 0.9})).To(Equal("A"))
+	})
+
+	It("should reject packages that cannot get back to the depot", func() {
+		packages := []Package{{ID: "PKG1", RoadNode: "X"}}
+		_, err := resolveRoadNodes(network, packages, "D", "")
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("Package PKG1 is not reachable from the depot on the road network"))
+	})
+
+	It("should reject edges to unknown nodes", func() {
+		_, err := parseRoadNetworkCSV(strings.NewReader("node,D,0,0\nedge,D,Z,10,50\n"))
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("Unknown road network node in edge D-Z on line 2"))
+	})
+
+	It("should read GeoJSON networks", func() {
+		geoJSON := `{"type": "FeatureCollection", "features": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [0, 0]}, "properties": {"id": "D"}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [1, 0]}, "properties": {"id": "A"}},
+			{"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[0, 0], [1, 0]]}, "properties": {"from": "D", "to": "A", "length": 115, "speed": 50}}
+		]}`
+		network, err := parseRoadNetworkGeoJSON(strings.NewReader(geoJSON))
+		Expect(err).ToNot(HaveOccurred())
+
+		path, found := network.fastestPath("A", "D", 70)
+		Expect(found).To(BeTrue())
+		Expect(path.Duration).To(Equal(115.0 / 50))
+	})
+})
+
+var _ = Describe("commands with a road network", func() {
+	var (
+		stdout *os.File
+		r, w   *os.File
+		output bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		roadNetworkPath = filepath.Join(GinkgoT().TempDir(), "roads.csv")
+		Expect(os.WriteFile(roadNetworkPath, []byte(testRoadNetworkCSV), 0644)).To(Succeed())
+		depotNode = "D"
+
+		viper.Set("weightCostPerKG", 10)
+		viper.Set("distanceCostPerKM", 5)
+
+		stdout = os.Stdout
+		r, w, _ = os.Pipe()
+		os.Stdout = w
+		output.Reset()
+	})
+
+	AfterEach(func() {
+		w.Close()
+		os.Stdout = stdout
+		roadNetworkPath = ""
+		depotNode = ""
+	})
+
+	It("should price packages by road distance", func() {
+		err := calculateCmd.RunE(nil, []string{"100", "1", "PKG1 10 5 NA node=A"})
+
+		w.Close()
+		output.ReadFrom(r)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(output.String()).To(ContainSubstring("Weight: 10 kg | Distance: 120 km"))
+		Expect(output.String()).To(ContainSubstring("Total Delivery Cost: 800.00"))
+	})
+
+	It("should time trips along the fastest roads", func() {
+		err := calculateTimeAndCostCmd.RunE(nil, []string{"100", "1", "PKG1 10 5 NA node=A", "1", "70", "200"})
+
+		w.Close()
+		output.ReadFrom(r)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(output.String()).To(ContainSubstring("Total Cost: 800.00"))
+		Expect(output.String()).To(ContainSubstring("Delivery Time: 2.29 hours"))
+	})
+
+	It("should require a depot", func() {
+		depotNode = ""
+		err := calculateTimeAndCostCmd.RunE(nil, []string{"100", "1", "PKG1 10 5 NA node=A", "1", "70", "200"})
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("Road network requires --depot or --depot-node"))
+	})
+})
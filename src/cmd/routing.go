@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const earthRadiusKM = 6371.0
+
+type GeoPoint struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+}
+
+// TripRoute is the order a vehicle drops its packages in. ArrivalTimes holds
+// the hours after departure at which each package is delivered, and Duration
+// and Distance cover the whole round trip back to the depot.
+type TripRoute struct {
+	Stops        []int
+	ArrivalTimes []float64
+	Duration     float64
+	Distance     float64
+}
+
+var depotLocation string
+
+func parseGeoPoint(value string) (*GeoPoint, error) {
+	coordinates := strings.Split(value, ",")
+	if len(coordinates) != 2 {
+		return nil, fmt.Errorf("Invalid location %s", value)
+	}
+
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(coordinates[0]), 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		return nil, fmt.Errorf("Invalid location %s", value)
+	}
+
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(coordinates[1]), 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		return nil, fmt.Errorf("Invalid location %s", value)
+	}
+
+	return &GeoPoint{Latitude: latitude, Longitude: longitude}, nil
+}
+
+func haversineDistance(from, to GeoPoint) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+
+	deltaLatitude := toRadians(to.Latitude - from.Latitude)
+	deltaLongitude := toRadians(to.Longitude - from.Longitude)
+
+	a := math.Sin(deltaLatitude/2)*math.Sin(deltaLatitude/2) +
+		math.Cos(toRadians(from.Latitude))*math.Cos(toRadians(to.Latitude))*math.Sin(deltaLongitude/2)*math.Sin(deltaLongitude/2)
+
+	return 2 * earthRadiusKM * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// planTripRoute decides the drop order for a shipment. When every package on the
+// trip sits on the road network the vehicle follows the roads; when the depot
+// and every package have coordinates it follows a straight-line route;
+// otherwise it falls back to driving out to each package and back, so the trip
+// lasts twice the distance of the farthest package.
+func planTripRoute(nextDelivery []int, packageList []Package, maxSpeed int, options SchedulerOptions) TripRoute {
+	if options.Roads != nil && haveRoadNodes(nextDelivery, packageList) {
+		return planRoadRoute(nextDelivery, packageList, maxSpeed, options.Roads, options.DepotNode)
+	}
+	if options.Depot != nil && haveLocations(nextDelivery, packageList) {
+		return planGeoRoute(nextDelivery, packageList, maxSpeed, *options.Depot)
+	}
+
+	route := TripRoute{Stops: nextDelivery}
+	maxDistance := 0
+	for _, idx := range nextDelivery {
+		route.ArrivalTimes = append(route.ArrivalTimes, float64(packageList[idx].Distance)/float64(maxSpeed))
+		if packageList[idx].Distance > maxDistance {
+			maxDistance = packageList[idx].Distance
+		}
+	}
+	route.Duration = 2 * calculateDurationForSingleTrip(nextDelivery, packageList, maxSpeed)
+	route.Distance = float64(2 * maxDistance)
+
+	return route
+}
+
+func haveLocations(nextDelivery []int, packageList []Package) bool {
+	for _, idx := range nextDelivery {
+		if packageList[idx].Location == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func haveRoadNodes(nextDelivery []int, packageList []Package) bool {
+	for _, idx := range nextDelivery {
+		if packageList[idx].RoadNode == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func planGeoRoute(nextDelivery []int, packageList []Package, maxSpeed int, depot GeoPoint) TripRoute {
+	points := []GeoPoint{depot}
+	for _, idx := range nextDelivery {
+		points = append(points, *packageList[idx].Location)
+	}
+	distance := func(from, to int) float64 { return haversineDistance(points[from], points[to]) }
+
+	order := improveRouteWithTwoOpt(orderStopsByNearestNeighbour(len(points), distance), distance)
+
+	route := TripRoute{}
+	previous := 0
+	for _, point := range order {
+		route.Distance += haversineDistance(points[previous], points[point])
+		route.Stops = append(route.Stops, nextDelivery[point-1])
+		route.ArrivalTimes = append(route.ArrivalTimes, route.Distance/float64(maxSpeed))
+		previous = point
+	}
+	route.Distance += haversineDistance(points[previous], points[0])
+	route.Duration = route.Distance / float64(maxSpeed)
+
+	return route
+}
+
+// planRoadRoute orders the stops by road travel time and times each drop along
+// the fastest road paths between them.
+func planRoadRoute(nextDelivery []int, packageList []Package, maxSpeed int, network *RoadNetwork, depot string) TripRoute {
+	nodes := []string{depot}
+	for _, idx := range nextDelivery {
+		nodes = append(nodes, packageList[idx].RoadNode)
+	}
+
+	paths := make([][]RoadPath, len(nodes))
+	for from := range nodes {
+		paths[from] = make([]RoadPath, len(nodes))
+		for to := range nodes {
+			path, found := network.fastestPath(nodes[from], nodes[to], float64(maxSpeed))
+			if !found {
+				path = RoadPath{Distance: math.Inf(1), Duration: math.Inf(1)}
+			}
+			paths[from][to] = path
+		}
+	}
+	duration := func(from, to int) float64 { return paths[from][to].Duration }
+
+	order := improveRouteWithTwoOpt(orderStopsByNearestNeighbour(len(nodes), duration), duration)
+
+	route := TripRoute{}
+	previous := 0
+	for _, point := range order {
+		route.Distance += paths[previous][point].Distance
+		route.Duration += paths[previous][point].Duration
+		route.Stops = append(route.Stops, nextDelivery[point-1])
+		route.ArrivalTimes = append(route.ArrivalTimes, route.Duration)
+		previous = point
+	}
+	route.Distance += paths[previous][0].Distance
+	route.Duration += paths[previous][0].Duration
+
+	return route
+}
+
+// orderStopsByNearestNeighbour builds a first route by always driving to the
+// closest stop not yet visited. Point 0 is the depot; the result lists the
+// other points in visiting order.
+func orderStopsByNearestNeighbour(count int, cost func(from, to int) float64) []int {
+	visited := make([]bool, count)
+	var order []int
+	current := 0
+
+	for len(order) < count-1 {
+		next := -1
+		for candidate := 1; candidate < count; candidate++ {
+			if visited[candidate] {
+				continue
+			}
+			if next < 0 || cost(current, candidate) < cost(current, next) {
+				next = candidate
+			}
+		}
+		visited[next] = true
+		order = append(order, next)
+		current = next
+	}
+
+	return order
+}
+
+// improveRouteWithTwoOpt reverses stretches of the route while doing so
+// shortens the round trip from and back to the depot. The whole tour is
+// re-measured for every candidate because road travel times need not be the
+// same in both directions.
+func improveRouteWithTwoOpt(order []int, cost func(from, to int) float64) []int {
+	tour := append([]int{0}, order...)
+	tour = append(tour, 0)
+	bestCost := getTourCost(tour, cost)
+
+	improved := true
+	for improved {
+		improved = false
+		for i := 1; i < len(tour)-2; i++ {
+			for k := i + 1; k < len(tour)-1; k++ {
+				reverseTourSection(tour, i, k)
+				if tourCost := getTourCost(tour, cost); tourCost < bestCost-1e-9 {
+					bestCost = tourCost
+					improved = true
+				} else {
+					reverseTourSection(tour, i, k)
+				}
+			}
+		}
+	}
+
+	return tour[1 : len(tour)-1]
+}
+
+func reverseTourSection(tour []int, from, to int) {
+	for left, right := from, to; left < right; left, right = left+1, right-1 {
+		tour[left], tour[right] = tour[right], tour[left]
+	}
+}
+
+func getTourCost(tour []int, cost func(from, to int) float64) float64 {
+	total := 0.0
+	for i := 1; i < len(tour); i++ {
+		total += cost(tour[i-1], tour[i])
+	}
+	return total
+}
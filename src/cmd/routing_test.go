@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("routing", func() {
+	Describe("haversineDistance", func() {
+		It("should return the great-circle distance in km", func() {
+			london := GeoPoint{Latitude: 51.5074, Longitude: -0.1278}
+			paris := GeoPoint{Latitude: 48.8566, Longitude: 2.3522}
+
+			Expect(haversineDistance(london, paris)).To(BeNumerically("~", 343.5, 0.5))
+		})
+	})
+
+	Describe("parseGeoPoint", func() {
+		It("should reject out of range coordinates", func() {
+			_, err := parseGeoPoint("91,10")
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Invalid location 91,10"))
+		})
+	})
+
+	Describe("improveRouteWithTwoOpt", func() {
+		It("should untangle a crossing route", func() {
+			points := []GeoPoint{{0, 0}, {0, 0.01}, {0.01, 0.01}, {0.01, 0}}
+			distance := func(from, to int) float64 { return haversineDistance(points[from], points[to]) }
+
+			Expect(improveRouteWithTwoOpt([]int{2, 1, 3}, distance)).To(Equal([]int{1, 2, 3}))
+		})
+	})
+
+	Describe("planTripRoute", func() {
+		It("should drive out and back to the farthest package without coordinates", func() {
+			packages := []Package{{ID: "PKG1", Distance: 30}, {ID: "PKG2", Distance: 140}}
+
+			route := planTripRoute([]int{0, 1}, packages, 70, SchedulerOptions{})
+
+			Expect(route.Stops).To(Equal([]int{0, 1}))
+			Expect(route.ArrivalTimes).To(Equal([]float64{30.0 / 70, 2}))
+			Expect(route.Duration).To(Equal(4.0))
+			Expect(route.Distance).To(Equal(280.0))
+		})
+
+		It("should visit located packages in route order", func() {
+			packages := []Package{
+				{ID: "PKG1", Location: &GeoPoint{0, 1}},
+				{ID: "PKG2", Location: &GeoPoint{0, 0.5}},
+			}
+
+			route := planTripRoute([]int{0, 1}, packages, 100, SchedulerOptions{Depot: &GeoPoint{0, 0}})
+
+			Expect(route.Stops).To(Equal([]int{1, 0}))
+			Expect(route.ArrivalTimes[0]).To(BeNumerically("~", 0.556, 0.001))
+			Expect(route.ArrivalTimes[1]).To(BeNumerically("~", 1.112, 0.001))
+			Expect(route.Distance).To(BeNumerically("~", 222.4, 0.1))
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with coordinates", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			depotLocation = ""
+		})
+
+		It("should compute delivery times along the route", func() {
+			depotLocation = "0,0"
+
+			args := []string{"100", "2", "PKG1 50 111 OFR001 lat=0 lon=1", "PKG2 50 56 OFR001 lat=0 lon=0.5", "1", "100", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(HavePrefix("Package: PKG2\n"))
+			Expect(output.String()).To(ContainSubstring("Delivery Time: 0.56 hours"))
+			Expect(output.String()).To(ContainSubstring("Delivery Time: 1.11 hours"))
+		})
+
+		It("should reject a package with only one coordinate", func() {
+			args := []string{"100", "1", "PKG1 50 111 OFR001 lat=0", "1", "100", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Invalid location for package 1"))
+		})
+	})
+})
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+type VehicleUtilisation struct {
+	VehicleID   int
+	Trips       []Trip
+	BusyHours   float64
+	IdleHours   float64
+	Utilisation float64
+}
+
+type ScheduleSummary struct {
+	Makespan         float64
+	FleetUtilisation float64
+	Vehicles         []VehicleUtilisation
+}
+
+var (
+	showGanttChart  bool
+	reportFilePath  string
+	ganttChartWidth = 60
+)
+
+const ganttTripMarkers = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+func summariseSchedule(trips []Trip, numVehicles int) ScheduleSummary {
+	summary := ScheduleSummary{}
+	for _, trip := range trips {
+		summary.Makespan = math.Max(summary.Makespan, trip.Return)
+	}
+
+	totalBusy := 0.0
+	for vehicleID := 1; vehicleID <= numVehicles; vehicleID++ {
+		vehicle := VehicleUtilisation{VehicleID: vehicleID}
+		for _, trip := range trips {
+			if trip.VehicleID == vehicleID {
+				vehicle.Trips = append(vehicle.Trips, trip)
+				vehicle.BusyHours += trip.Return - trip.Departure
+			}
+		}
+		sort.SliceStable(vehicle.Trips, func(i, j int) bool { return vehicle.Trips[i].Departure < vehicle.Trips[j].Departure })
+
+		vehicle.IdleHours = summary.Makespan - vehicle.BusyHours
+		if summary.Makespan > 0 {
+			vehicle.Utilisation = vehicle.BusyHours / summary.Makespan
+		}
+		totalBusy += vehicle.BusyHours
+		summary.Vehicles = append(summary.Vehicles, vehicle)
+	}
+
+	if summary.Makespan > 0 && numVehicles > 0 {
+		summary.FleetUtilisation = totalBusy / (summary.Makespan * float64(numVehicles))
+	}
+
+	return summary
+}
+
+func getTripPackageIDs(trip Trip) []string {
+	var ids []string
+	for _, pkg := range trip.Packages {
+		ids = append(ids, pkg.ID)
+	}
+	return ids
+}
+
+func renderGanttChart(w io.Writer, summary ScheduleSummary, fleet FleetCapacity, width int) {
+	fmt.Fprintf(w, "Vehicle schedule (0.00 - %.2f hours)\n", summary.Makespan)
+
+	for _, vehicle := range summary.Vehicles {
+		row := []byte(strings.Repeat(".", width))
+		for i, trip := range vehicle.Trips {
+			start, end := getGanttColumns(trip, summary.Makespan, width)
+			for col := start; col < end; col++ {
+				row[col] = ganttTripMarkers[i%len(ganttTripMarkers)]
+			}
+		}
+		fmt.Fprintf(w, "Vehicle %-3d|%s| %5.1f%% busy\n", vehicle.VehicleID, row, vehicle.Utilisation*100)
+	}
+
+	fmt.Fprintln(w)
+	for _, vehicle := range summary.Vehicles {
+		for i, trip := range vehicle.Trips {
+			load, constraint := fleet.getVehicleCapacity(trip.VehicleID).getTripLoad(trip)
+			fmt.Fprintf(w, "  Vehicle %d trip %c: %.2f - %.2f hours, load %.0f%% by %s, packages %s\n",
+				vehicle.VehicleID, ganttTripMarkers[i%len(ganttTripMarkers)], trip.Departure, trip.Return,
+				load, constraint, strings.Join(getTripPackageIDs(trip), ","))
+		}
+	}
+
+	fmt.Fprintf(w, "\nMakespan: %.2f hours\n", summary.Makespan)
+	fmt.Fprintf(w, "Fleet utilisation: %.1f%%\n", summary.FleetUtilisation*100)
+}
+
+// getGanttColumns maps a trip onto chart columns, always giving it at least one
+// column so very short trips stay visible.
+func getGanttColumns(trip Trip, makespan float64, width int) (int, int) {
+	if makespan == 0 {
+		return 0, 0
+	}
+	start := int(trip.Departure / makespan * float64(width))
+	end := int(trip.Return / makespan * float64(width))
+	if end <= start {
+		end = start + 1
+	}
+	if end > width {
+		end = width
+	}
+	if start >= end {
+		start = end - 1
+	}
+	return start, end
+}
+
+type reportTrip struct {
+	X, Width    float64
+	Y           int
+	Colour      string
+	Label       string
+	Title       string
+	LoadPercent float64
+}
+
+type reportGap struct {
+	X, Width float64
+	Y        int
+}
+
+type reportRow struct {
+	Label string
+	Y     int
+}
+
+type reportData struct {
+	Summary   ScheduleSummary
+	Width     int
+	Height    int
+	Rows      []reportRow
+	Trips     []reportTrip
+	Gaps      []reportGap
+	AxisTicks []reportTick
+}
+
+type reportTick struct {
+	X     float64
+	Label string
+}
+
+const (
+	reportChartLeft   = 90
+	reportChartWidth  = 800
+	reportRowHeight   = 36
+	reportChartTop    = 20
+	reportAxisPadding = 30
+)
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(value float64) string { return fmt.Sprintf("%.1f%%", value*100) },
+	"hours":   func(value float64) string { return fmt.Sprintf("%.2f", value) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Vehicle schedule report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-top: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.gap { fill: #f3f3f3; stroke: #bbb; stroke-dasharray: 3 3; }
+</style>
+</head>
+<body>
+<h1>Vehicle schedule report</h1>
+<p>Makespan: {{hours .Summary.Makespan}} hours &middot; Fleet utilisation: {{percent .Summary.FleetUtilisation}}</p>
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}">
+{{- range .Rows}}
+<text x="5" y="{{.Y}}" dy="22" font-size="13">{{.Label}}</text>
+{{- end}}
+{{- range .Gaps}}
+<rect class="gap" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="30"><title>idle</title></rect>
+{{- end}}
+{{- range .Trips}}
+<rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="30" fill="{{.Colour}}" stroke="#333"><title>{{.Title}}</title></rect>
+<text x="{{.X}}" y="{{.Y}}" dx="4" dy="20" font-size="11">{{.Label}}</text>
+{{- end}}
+{{- range .AxisTicks}}
+<text x="{{.X}}" y="{{$.Height}}" dy="-8" font-size="11" text-anchor="middle">{{.Label}}</text>
+{{- end}}
+</svg>
+<table>
+<tr><th>Vehicle</th><th>Trips</th><th>Busy (h)</th><th>Idle (h)</th><th>Utilisation</th></tr>
+{{- range .Summary.Vehicles}}
+<tr><td>Vehicle {{.VehicleID}}</td><td>{{len .Trips}}</td><td>{{hours .BusyHours}}</td><td>{{hours .IdleHours}}</td><td>{{percent .Utilisation}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+func buildReportData(summary ScheduleSummary, fleet FleetCapacity) reportData {
+	data := reportData{
+		Summary: summary,
+		Width:   reportChartLeft + reportChartWidth + 20,
+		Height:  reportChartTop + len(summary.Vehicles)*reportRowHeight + reportAxisPadding,
+	}
+
+	scale := 0.0
+	if summary.Makespan > 0 {
+		scale = reportChartWidth / summary.Makespan
+	}
+
+	for i, vehicle := range summary.Vehicles {
+		y := reportChartTop + i*reportRowHeight
+		data.Rows = append(data.Rows, reportRow{Label: fmt.Sprintf("Vehicle %d", vehicle.VehicleID), Y: y})
+
+		freeFrom := 0.0
+		for _, trip := range vehicle.Trips {
+			if trip.Departure > freeFrom {
+				data.Gaps = append(data.Gaps, reportGap{X: reportChartLeft + freeFrom*scale, Width: (trip.Departure - freeFrom) * scale, Y: y})
+			}
+			load, constraint := fleet.getVehicleCapacity(trip.VehicleID).getTripLoad(trip)
+			data.Trips = append(data.Trips, reportTrip{
+				X:           reportChartLeft + trip.Departure*scale,
+				Width:       (trip.Return - trip.Departure) * scale,
+				Y:           y,
+				Colour:      getLoadColour(load),
+				Label:       fmt.Sprintf("%.0f%%", load),
+				Title:       fmt.Sprintf("%.2f - %.2f h, load %.0f%% by %s, packages %s", trip.Departure, trip.Return, load, constraint, strings.Join(getTripPackageIDs(trip), ", ")),
+				LoadPercent: load,
+			})
+			freeFrom = trip.Return
+		}
+		if summary.Makespan > freeFrom {
+			data.Gaps = append(data.Gaps, reportGap{X: reportChartLeft + freeFrom*scale, Width: (summary.Makespan - freeFrom) * scale, Y: y})
+		}
+	}
+
+	const ticks = 5
+	for i := 0; i <= ticks; i++ {
+		hours := summary.Makespan * float64(i) / ticks
+		data.AxisTicks = append(data.AxisTicks, reportTick{X: reportChartLeft + hours*scale, Label: fmt.Sprintf("%.1fh", hours)})
+	}
+
+	return data
+}
+
+// getLoadColour shades trips from pale to dark green as the vehicle fills up.
+func getLoadColour(loadPercent float64) string {
+	if loadPercent > 100 {
+		loadPercent = 100
+	}
+	lightness := 85 - int(loadPercent*0.45)
+	return fmt.Sprintf("hsl(130, 45%%, %d%%)", lightness)
+}
+
+func renderHTMLReport(w io.Writer, summary ScheduleSummary, fleet FleetCapacity) error {
+	return reportTemplate.Execute(w, buildReportData(summary, fleet))
+}
+
+func writeHTMLReport(path string, summary ScheduleSummary, fleet FleetCapacity) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Unable to create report file: %s", err)
+	}
+	defer file.Close()
+
+	return renderHTMLReport(file, summary, fleet)
+}
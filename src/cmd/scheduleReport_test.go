@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("schedule report", func() {
+	var trips []Trip
+
+	BeforeEach(func() {
+		trips = []Trip{
+			{VehicleID: 1, Departure: 0, Return: 2, Packages: []Package{{ID: "PKG1", Weight: 100}}},
+			{VehicleID: 1, Departure: 2, Return: 4, Packages: []Package{{ID: "PKG2", Weight: 50}, {ID: "PKG3", Weight: 50}}},
+			{VehicleID: 2, Departure: 0, Return: 1, Packages: []Package{{ID: "PKG4", Weight: 200}}},
+		}
+	})
+
+	Describe("summariseSchedule", func() {
+		It("should compute makespan and utilisation", func() {
+			summary := summariseSchedule(trips, 2)
+
+			Expect(summary.Makespan).To(Equal(4.0))
+			Expect(summary.FleetUtilisation).To(Equal(5.0 / 8.0))
+			Expect(summary.Vehicles[0].Utilisation).To(Equal(1.0))
+			Expect(summary.Vehicles[1].BusyHours).To(Equal(1.0))
+			Expect(summary.Vehicles[1].IdleHours).To(Equal(3.0))
+		})
+	})
+
+	Describe("renderGanttChart", func() {
+		It("should draw trips and idle gaps per vehicle", func() {
+			var buffer bytes.Buffer
+			renderGanttChart(&buffer, summariseSchedule(trips, 2), FleetCapacity{Default: Capacity{Weight: 200}}, 8)
+
+			Expect(buffer.String()).To(ContainSubstring("Vehicle 1  |AAAABBBB| 100.0% busy"))
+			Expect(buffer.String()).To(ContainSubstring("Vehicle 2  |AA......|  25.0% busy"))
+			Expect(buffer.String()).To(ContainSubstring("Vehicle 1 trip B: 2.00 - 4.00 hours, load 50% by weight, packages PKG2,PKG3"))
+			Expect(buffer.String()).To(ContainSubstring("Fleet utilisation: 62.5%"))
+		})
+	})
+
+	Describe("renderHTMLReport", func() {
+		It("should render an SVG chart and the utilisation table", func() {
+			var buffer bytes.Buffer
+			err := renderHTMLReport(&buffer, summariseSchedule(trips, 2), FleetCapacity{Default: Capacity{Weight: 200}})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buffer.String()).To(ContainSubstring("<svg"))
+			Expect(buffer.String()).To(ContainSubstring("packages PKG2, PKG3"))
+			Expect(buffer.String()).To(ContainSubstring(`class="gap"`))
+			Expect(buffer.String()).To(ContainSubstring("<td>Vehicle 2</td><td>1</td><td>1.00</td><td>3.00</td><td>25.0%</td>"))
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with report", func() {
+		AfterEach(func() {
+			reportFilePath = ""
+		})
+
+		It("should write the HTML report file", func() {
+			reportFilePath = filepath.Join(GinkgoT().TempDir(), "report.html")
+
+			args := []string{"100", "3", "PKG1 50 30 OFR001", "PKG2 75 125 OFFR0008", "PKG3 175 100 OFFR003", "2", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+			Expect(err).ToNot(HaveOccurred())
+
+			content, err := os.ReadFile(reportFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(ContainSubstring("Makespan: 3.57 hours"))
+		})
+	})
+})
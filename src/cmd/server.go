@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"courier_service/config"
+	"courier_service/store"
+
+	"github.com/spf13/cobra"
+)
+
+type TrackingResponse struct {
+	ID      string               `json:"id"`
+	Status  string               `json:"status"`
+	History []store.StatusChange `json:"history"`
+}
+
+// QuoteRequest prices packages given as on the command line, e.g.
+// "PKG1 50 30 OFR001 service=express".
+type QuoteRequest struct {
+	BaseDeliveryCost int      `json:"baseDeliveryCost"`
+	Packages         []string `json:"packages"`
+}
+
+type QuoteResponse struct {
+	Packages []Package `json:"packages"`
+}
+
+// PlanRequest plans the delivery of packages given as on the command line
+// with a fleet of NumVehicles vehicles. The finished job is posted to
+// WebhookURL when one is given.
+type PlanRequest struct {
+	BaseDeliveryCost int      `json:"baseDeliveryCost"`
+	Packages         []string `json:"packages"`
+	NumVehicles      int      `json:"numVehicles"`
+	MaxSpeed         int      `json:"maxSpeed"`
+	MaxLoad          int      `json:"maxLoad"`
+	WebhookURL       string   `json:"webhookUrl,omitempty"`
+}
+
+// PlanResponse is a finished plan. TimedOut is set when planning ran out of
+// time and the plan is the best partial one found; the packages it did not
+// reach are unscheduled.
+type PlanResponse struct {
+	Trips       []Trip    `json:"trips"`
+	Unscheduled []Package `json:"unscheduled"`
+	TimedOut    bool      `json:"timedOut,omitempty"`
+}
+
+// ConfigResponse is the pricing configuration the service runs with.
+type ConfigResponse struct {
+	Offers            []config.Offer `json:"offers"`
+	WeightCostPerKG   int            `json:"weightCostPerKG"`
+	DistanceCostPerKM int            `json:"distanceCostPerKM"`
+	Tax               config.Tax     `json:"tax"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+var listenAddress string
+
+func newAPIHandler(repository store.Repository, jobs *jobQueue) http.Handler {
+	limits := config.GetRateLimits()
+	quoteLimiter, planLimiter := newEndpointLimiter(limits.Quote), newEndpointLimiter(limits.Plan)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/packages/{id}/track", requireScope(store.ScopeQuote, limitRequests(quoteLimiter, func(w http.ResponseWriter, r *http.Request) {
+		handleTrackPackage(w, r, repository)
+	})))
+	mux.Handle("POST /v1/quotes", requireScope(store.ScopeQuote, limitRequests(quoteLimiter, handleQuote)))
+	mux.Handle("POST /v1/plans", requireScope(store.ScopePlan, limitRequests(planLimiter, func(w http.ResponseWriter, r *http.Request) {
+		handleSubmitPlan(w, r, jobs)
+	})))
+	mux.Handle("GET /v1/jobs/{id}", requireScope(store.ScopePlan, limitRequests(quoteLimiter, func(w http.ResponseWriter, r *http.Request) {
+		handleGetJob(w, r, jobs)
+	})))
+	mux.Handle("POST /v1/jobs/{id}/cancel", requireScope(store.ScopePlan, limitRequests(quoteLimiter, func(w http.ResponseWriter, r *http.Request) {
+		handleCancelJob(w, r, jobs)
+	})))
+	mux.Handle("GET /v1/config", requireScope(store.ScopeAdminConfig, handleGetConfig))
+	return logRequests(authenticateRequests(repository, mux))
+}
+
+func handleTrackPackage(w http.ResponseWriter, r *http.Request, repository store.Repository) {
+	id := r.PathValue("id")
+	pkg, err := repository.GetPackage(id)
+	if err == store.ErrNotFound {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Package %s not found", id))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TrackingResponse{ID: pkg.ID, Status: pkg.Status, History: pkg.History})
+}
+
+func handleQuote(w http.ResponseWriter, r *http.Request) {
+	var request QuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %s", err))
+		return
+	}
+
+	packages, err := parsePackages(request.Packages, request.BaseDeliveryCost)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, QuoteResponse{Packages: packages})
+}
+
+func handleSubmitPlan(w http.ResponseWriter, r *http.Request, jobs *jobQueue) {
+	var request PlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %s", err))
+		return
+	}
+
+	packages, err := parsePackages(request.Packages, request.BaseDeliveryCost)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if request.NumVehicles <= 0 || request.MaxSpeed <= 0 || request.MaxLoad <= 0 {
+		writeError(w, http.StatusBadRequest, "numVehicles, maxSpeed and maxLoad must be positive")
+		return
+	}
+	if maxPackages := jobs.getMaxPackages(); len(packages) > maxPackages {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("A plan request may have at most %d packages", maxPackages))
+		return
+	}
+	if request.WebhookURL != "" && !isValidWebhookURL(request.WebhookURL, jobs.settings.WebhookAllowedHosts) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid webhook URL %s", request.WebhookURL))
+		return
+	}
+
+	key, _ := r.Context().Value(apiKeyContextKey).(store.APIKey)
+	job, err := jobs.submit(key.ID, key.SecretHash, request, packages)
+	if err == errJobQueueFull {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/v1/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// getJobOwner is the key whose jobs the caller may see: its own, or every
+// job for an admin key.
+func getJobOwner(r *http.Request) string {
+	key, _ := r.Context().Value(apiKeyContextKey).(store.APIKey)
+	if key.HasScope(store.ScopeAdminConfig) {
+		return ""
+	}
+	return key.ID
+}
+
+func handleGetJob(w http.ResponseWriter, r *http.Request, jobs *jobQueue) {
+	job, err := jobs.get(r.PathValue("id"), getJobOwner(r))
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Job %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func handleCancelJob(w http.ResponseWriter, r *http.Request, jobs *jobQueue) {
+	job, err := jobs.cancel(r.PathValue("id"), getJobOwner(r))
+	if err == errJobNotFound {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Job %s not found", r.PathValue("id")))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ConfigResponse{
+		Offers:            config.GetOffers(),
+		WeightCostPerKG:   config.GetWeightCostPerKG(),
+		DistanceCostPerKM: config.GetDistanceCostPerKM(),
+		Tax:               config.GetTax(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ErrorResponse{Error: message})
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the HTTP API",
+	Long:  `This command serves the HTTP API over the packages kept in the store, e.g. GET /v1/packages/{id}/track for the status history of a package. Plans are run as background jobs that can be polled at GET /v1/jobs/{id}. Every request must carry an API key issued with issueKey.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repository, err := openRequiredStore()
+		if err != nil {
+			return err
+		}
+		defer repository.Close()
+
+		jobs := newJobQueue(config.GetJobSettings())
+		defer jobs.Close()
+
+		fmt.Printf("Listening on %s\n", listenAddress)
+		return http.ListenAndServe(listenAddress, newAPIHandler(repository, jobs))
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&listenAddress, "listen", ":8080", "Address the HTTP API listens on")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"courier_service/config"
+	"courier_service/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("API server", func() {
+	var (
+		handler http.Handler
+		jobs    *jobQueue
+		token   string
+	)
+	createdAt := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		repository := store.NewMemoryStore()
+		repository.SavePackage(store.Package{ID: "PKG1", Weight: 50, Distance: 30, CreatedAt: createdAt})
+		repository.UpdatePackageStatus("PKG1", store.StatusQuoted, createdAt.Add(time.Minute))
+		id, _ := repository.SaveAPIKey(store.APIKey{Name: "partner", SecretHash: hashAPISecret("secret"), Scopes: []string{store.ScopeQuote}})
+		token = id + ".secret"
+		jobs = newJobQueue(config.JobSettings{Workers: 1, QueueSize: 4})
+		handler = newAPIHandler(repository, jobs)
+	})
+
+	AfterEach(func() {
+		jobs.Close()
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	Describe("GET /v1/packages/{id}/track", func() {
+		It("should return the status history of the package", func() {
+			recorder := get("/v1/packages/PKG1/track")
+
+			var response TrackingResponse
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Status).To(Equal(store.StatusQuoted))
+			Expect(response.History).To(Equal([]store.StatusChange{
+				{Status: store.StatusCreated, At: createdAt},
+				{Status: store.StatusQuoted, At: createdAt.Add(time.Minute)},
+			}))
+		})
+
+		It("should return 404 for an unknown package", func() {
+			recorder := get("/v1/packages/PKG9/track")
+
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"error":"Package PKG9 not found"}`))
+		})
+
+		It("should show status changes saved by another process", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "store.jsonl")
+			repository, _ := store.NewFileStore(path)
+			defer repository.Close()
+			repository.SavePackage(store.Package{ID: "PKG1", Weight: 50, Distance: 30, CreatedAt: createdAt})
+			id, _ := repository.SaveAPIKey(store.APIKey{Name: "partner", SecretHash: hashAPISecret("secret"), Scopes: []string{store.ScopeQuote}})
+			token = id + ".secret"
+			handler = newAPIHandler(repository, jobs)
+
+			other, _ := store.NewFileStore(path)
+			defer other.Close()
+			other.UpdatePackageStatus("PKG1", store.StatusQuoted, createdAt.Add(time.Minute))
+			recorder := get("/v1/packages/PKG1/track")
+
+			var response TrackingResponse
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Status).To(Equal(store.StatusQuoted))
+		})
+	})
+
+	Describe("POST /v1/quotes and /v1/plans", func() {
+		BeforeEach(func() {
+			viper.Set("weightCostPerKG", 10)
+			viper.Set("distanceCostPerKM", 5)
+		})
+
+		post := func(path, body string) *httptest.ResponseRecorder {
+			request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			request.Header.Set("Authorization", "Bearer "+token)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			return recorder
+		}
+
+		It("should price the packages", func() {
+			recorder := post("/v1/quotes", `{"baseDeliveryCost":100,"packages":["PKG1 5 5 NA"]}`)
+
+			var response QuoteResponse
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Packages).To(HaveLen(1))
+			Expect(response.Packages[0].FinalCost).To(Equal(175.0))
+		})
+
+		It("should reject invalid packages", func() {
+			recorder := post("/v1/quotes", `{"baseDeliveryCost":100,"packages":["PKG1 five 5 NA"]}`)
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"error":"Invalid weight for package 1"}`))
+		})
+
+		It("should need the plan scope to plan", func() {
+			recorder := post("/v1/plans", `{"baseDeliveryCost":100,"packages":["PKG1 5 5 NA"],"numVehicles":1,"maxSpeed":70,"maxLoad":200}`)
+
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"courier_service/config"
+)
+
+const (
+	ServiceLevelStandard = "standard"
+	ServiceLevelExpress  = "express"
+	ServiceLevelSameDay  = "same-day"
+)
+
+// serviceLevelPriority ranks service levels for dispatch; higher goes first.
+var serviceLevelPriority = map[string]int{
+	ServiceLevelStandard: 0,
+	ServiceLevelExpress:  1,
+	ServiceLevelSameDay:  2,
+}
+
+func isValidServiceLevel(serviceLevel string) bool {
+	_, ok := serviceLevelPriority[serviceLevel]
+	return ok
+}
+
+func getServiceLevel(pkg Package) string {
+	if pkg.ServiceLevel == "" {
+		return ServiceLevelStandard
+	}
+	return pkg.ServiceLevel
+}
+
+// applyServiceLevel scales the price of a package by its service level
+// multiplier. Offer discounts are a percentage of the price, so they scale too.
+func applyServiceLevel(totalCost, discount float64, serviceLevel string) (float64, float64, float64) {
+	multiplier := config.GetServiceLevelMultiplier(serviceLevel)
+	surcharge := totalCost * (multiplier - 1)
+	return totalCost + surcharge, discount * multiplier, surcharge
+}
+
+// getShipmentScore ranks a candidate shipment by the weight it carries of each
+// dispatch priority, highest first, followed by its total weight. Trips are
+// compared on these values in order, so a lighter trip carrying more same-day
+// parcels beats a heavier one of standard parcels.
+func getShipmentScore(subset []int, packageList []Package) []int {
+	score := make([]int, len(serviceLevelPriority))
+	top := len(serviceLevelPriority) - 1
+	for _, idx := range subset {
+		pkg := packageList[idx]
+		priority := getDispatchPriority(pkg)
+		if priority > 0 {
+			score[top-priority] += pkg.Weight
+		}
+		score[top] += pkg.Weight
+	}
+	return score
+}
+
+func compareShipmentScores(score, highestScore []int) int {
+	if highestScore == nil {
+		return 1
+	}
+	for i := range score {
+		if score[i] != highestScore[i] {
+			if score[i] > highestScore[i] {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
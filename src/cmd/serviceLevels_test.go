@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("service levels", func() {
+	BeforeEach(func() {
+		viper.Set("serviceLevels", map[string]interface{}{"standard": 1, "express": 1.5, "same-day": 2})
+	})
+
+	AfterEach(func() {
+		viper.Set("serviceLevels", map[string]interface{}{})
+	})
+
+	Describe("applyServiceLevel", func() {
+		It("should scale the price and the discount", func() {
+			totalCost, discount, surcharge := applyServiceLevel(1000, 100, ServiceLevelExpress)
+
+			Expect(totalCost).To(Equal(1500.0))
+			Expect(discount).To(Equal(150.0))
+			Expect(surcharge).To(Equal(500.0))
+		})
+
+		It("should leave standard packages unchanged", func() {
+			totalCost, discount, surcharge := applyServiceLevel(1000, 100, ServiceLevelStandard)
+
+			Expect(totalCost).To(Equal(1000.0))
+			Expect(discount).To(Equal(100.0))
+			Expect(surcharge).To(Equal(0.0))
+		})
+	})
+
+	Describe("getShipmentsSubSetsWhichFallsUnderMaxCarriable", func() {
+		It("should prefer the shipment with more high priority weight over a heavier one", func() {
+			packages := []Package{
+				{ID: "PKG1", Weight: 50, ServiceLevel: ServiceLevelExpress},
+				{ID: "PKG2", Weight: 75},
+				{ID: "PKG3", Weight: 175},
+			}
+
+			Expect(getShipmentsSubSetsWhichFallsUnderMaxCarriable(context.Background(), packages, Capacity{Weight: 200}, nil)).To(Equal([][]int{{0, 1}}))
+		})
+
+		It("should rank same-day above express", func() {
+			packages := []Package{
+				{ID: "PKG1", Weight: 150, ServiceLevel: ServiceLevelExpress},
+				{ID: "PKG2", Weight: 60, ServiceLevel: ServiceLevelSameDay},
+				{ID: "PKG3", Weight: 100},
+			}
+
+			Expect(getShipmentsSubSetsWhichFallsUnderMaxCarriable(context.Background(), packages, Capacity{Weight: 200}, nil)).To(Equal([][]int{{1, 2}}))
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with service levels", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+		})
+
+		It("should dispatch express packages first", func() {
+			args := []string{"100", "3", "PKG1 50 30 OFR001 service=express", "PKG2 75 125 OFFR0008", "PKG3 175 100 OFFR003", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(HavePrefix("Package: PKG1\n  Vehicle: 1\n  Service Level: express\n"))
+			Expect(output.String()).To(ContainSubstring("Delivery Time: 0.43 hours"))
+		})
+
+		It("should price same-day packages with a surcharge", func() {
+			viper.Set("weightCostPerKG", 10)
+			viper.Set("distanceCostPerKM", 5)
+
+			err := calculateCmd.RunE(nil, []string{"100", "1", "PKG1 5 5 OFR001 service=same-day"})
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Service level: same-day"))
+			Expect(output.String()).To(ContainSubstring("  Service Surcharge: 175.00"))
+			Expect(output.String()).To(ContainSubstring("Total Delivery Cost: 350.00"))
+		})
+
+		It("should reject unknown service levels", func() {
+			args := []string{"100", "1", "PKG1 50 30 OFR001 service=overnight", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Invalid service level overnight for package 1"))
+		})
+	})
+})
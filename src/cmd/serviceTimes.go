@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"courier_service/config"
+)
+
+// applyServiceTimes adds loading and handover time to a driving-only route.
+// The vehicle loads once before leaving the depot; at each stop the package is
+// delivered once it has been handed over, so every later stop and the return
+// to the depot shift by that stop's handover and handling time.
+func applyServiceTimes(route TripRoute, packageList []Package, serviceTimes config.ServiceTimes) TripRoute {
+	elapsed := serviceTimes.DepotLoadingMinutes / 60
+
+	timedRoute := TripRoute{Stops: route.Stops, Distance: route.Distance}
+	for stop, idx := range route.Stops {
+		elapsed += (serviceTimes.StopHandoverMinutes + serviceTimes.HandlingMinutesPerKG*float64(packageList[idx].Weight)) / 60
+		timedRoute.ArrivalTimes = append(timedRoute.ArrivalTimes, route.ArrivalTimes[stop]+elapsed)
+	}
+	timedRoute.Duration = route.Duration + elapsed
+
+	return timedRoute
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+
+	"courier_service/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("service times", func() {
+	Describe("applyServiceTimes", func() {
+		It("should add loading, handover and handling time", func() {
+			packages := []Package{{ID: "PKG1", Weight: 10}, {ID: "PKG2", Weight: 20}}
+			route := TripRoute{Stops: []int{0, 1}, ArrivalTimes: []float64{1, 2}, Duration: 4, Distance: 200}
+			serviceTimes := config.ServiceTimes{DepotLoadingMinutes: 30, StopHandoverMinutes: 6, HandlingMinutesPerKG: 0.6}
+
+			timedRoute := applyServiceTimes(route, packages, serviceTimes)
+
+			Expect(timedRoute.ArrivalTimes[0]).To(BeNumerically("~", 1.7, 1e-9))
+			Expect(timedRoute.ArrivalTimes[1]).To(BeNumerically("~", 3.0, 1e-9))
+			Expect(timedRoute.Duration).To(BeNumerically("~", 5.0, 1e-9))
+			Expect(timedRoute.Distance).To(Equal(200.0))
+		})
+
+		It("should leave the route alone without service times", func() {
+			route := TripRoute{Stops: []int{0}, ArrivalTimes: []float64{1}, Duration: 2}
+
+			Expect(applyServiceTimes(route, []Package{{ID: "PKG1", Weight: 10}}, config.ServiceTimes{})).To(Equal(route))
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with service times", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			viper.Set("serviceTimes", map[string]interface{}{"depotLoadingMinutes": 15, "stopHandoverMinutes": 5})
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			viper.Set("serviceTimes", map[string]interface{}{})
+		})
+
+		It("should include service times in delivery and return times", func() {
+			args := []string{"100", "2", "PKG1 50 70 NA", "PKG2 175 70 NA", "1", "70", "200"}
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(MatchRegexp(`Package: PKG2\n(.*\n){3}  Delivery Time: 1\.33 hours`))
+			Expect(output.String()).To(MatchRegexp(`Package: PKG1\n(.*\n){3}  Delivery Time: 3\.67 hours`))
+		})
+	})
+})
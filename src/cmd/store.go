@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"encoding/json"
+	"time"
+
+	"courier_service/store"
+)
+
+var storePath string
+
+// openStore opens the store given with --store. Without it nothing is kept
+// and a nil repository is returned.
+func openStore() (store.Repository, error) {
+	if storePath == "" {
+		return nil, nil
+	}
+	return store.NewFileStore(storePath)
+}
+
+// recordQuote keeps a priced package, its quote and the offer it redeemed, if
+// any, and marks the package quoted unless it is already further along.
+func recordQuote(repository store.Repository, pkg Package, baseDeliveryCost int, at time.Time) error {
+	err := repository.SavePackage(store.Package{
+		ID:           pkg.ID,
+		Weight:       pkg.Weight,
+		Volume:       pkg.Volume,
+		Distance:     pkg.Distance,
+		OfferCode:    pkg.OfferCode,
+		ServiceLevel: pkg.ServiceLevel,
+		CustomerID:   pkg.CustomerID,
+		CreatedAt:    at,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = repository.SaveQuote(store.Quote{
+		PackageID:        pkg.ID,
+		CustomerID:       pkg.CustomerID,
+		BaseDeliveryCost: baseDeliveryCost,
+		TotalCost:        pkg.TotalCost,
+		ContractDiscount: pkg.ContractDiscount,
+		Discount:         pkg.Discount,
+		FinalCost:        pkg.FinalCost,
+		QuotedAt:         at,
+	})
+	if err != nil {
+		return err
+	}
+
+	if offerDiscount := pkg.Discount - pkg.ContractDiscount; offerDiscount > 0 {
+		err = repository.SaveOfferRedemption(store.OfferRedemption{OfferCode: pkg.OfferCode, PackageID: pkg.ID, Discount: offerDiscount, RedeemedAt: at})
+		if err != nil {
+			return err
+		}
+	}
+
+	stored, err := repository.GetPackage(pkg.ID)
+	if err != nil {
+		return err
+	}
+	if store.CanTransition(stored.Status, store.StatusQuoted) {
+		_, err = repository.UpdatePackageStatus(pkg.ID, store.StatusQuoted, at)
+	}
+	return err
+}
+
+func getPlanPackages(state PlanState) []Package {
+	var packages []Package
+	for _, trip := range state.Trips {
+		packages = append(packages, trip.Packages...)
+	}
+	return append(packages, state.Unscheduled...)
+}
+
+// recordPlan keeps the plan and returns the ID the store gave it.
+func recordPlan(repository store.Repository, state PlanState, at time.Time) (string, error) {
+	var packageIDs []string
+	for _, pkg := range getPlanPackages(state) {
+		packageIDs = append(packageIDs, pkg.ID)
+	}
+
+	content, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	return repository.SavePlan(store.Plan{PackageIDs: packageIDs, State: content, CreatedAt: at})
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&storePath, "store", "", "Keep packages, quotes, plans and offer redemptions in this file across runs")
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"courier_service/config"
+	"courier_service/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("store", func() {
+	var (
+		stdout *os.File
+		r, w   *os.File
+		output bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		storePath = filepath.Join(GinkgoT().TempDir(), "store.jsonl")
+		stdout = os.Stdout
+		r, w, _ = os.Pipe()
+		os.Stdout = w
+		output.Reset()
+		viper.Set("weightCostPerKG", 10)
+		viper.Set("distanceCostPerKM", 5)
+		viper.Set("offers", []config.Offer{{Code: "OFR003", Discount: 0.05, MinDistance: 10, MaxDistance: 150, MinWeight: 50, MaxWeight: 250}})
+	})
+
+	AfterEach(func() {
+		w.Close()
+		os.Stdout = stdout
+		storePath = ""
+	})
+
+	It("should keep the packages, quotes, redemptions and plan of a run", func() {
+		args := []string{"100", "2", "PKG1 50 30 OFR003", "PKG2 75 125 NA", "1", "70", "200"}
+		err := calculateTimeAndCostCmd.RunE(nil, args)
+
+		w.Close()
+		output.ReadFrom(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(output.String()).To(ContainSubstring("Plan stored as PLAN-1\n"))
+
+		repository, err := store.NewFileStore(storePath)
+		Expect(err).ToNot(HaveOccurred())
+		defer repository.Close()
+
+		packages, _ := repository.ListPackages()
+		quotes, _ := repository.ListQuotes()
+		redemptions, _ := repository.ListOfferRedemptions()
+		plan, err := repository.GetPlan("PLAN-1")
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packages).To(HaveLen(2))
+		Expect(quotes).To(HaveLen(2))
+		Expect(redemptions).To(HaveLen(1))
+		Expect(redemptions[0].PackageID).To(Equal("PKG1"))
+		Expect(redemptions[0].Discount).To(Equal(37.5))
+		Expect(plan.PackageIDs).To(ConsistOf("PKG1", "PKG2"))
+	})
+
+	It("should add quotes from calculateCost to the same store", func() {
+		Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG1 50 30 OFR003"})).To(Succeed())
+		Expect(calculateCmd.RunE(nil, []string{"100", "1", "PKG1 50 30 NA"})).To(Succeed())
+
+		repository, err := store.NewFileStore(storePath)
+		Expect(err).ToNot(HaveOccurred())
+		defer repository.Close()
+
+		pkg, _ := repository.GetPackage("PKG1")
+		quotes, _ := repository.ListQuotes()
+		Expect(pkg.OfferCode).To(Equal("NA"))
+		Expect(quotes).To(HaveLen(2))
+		Expect(quotes[0].FinalCost).To(Equal(712.5))
+		Expect(quotes[1].FinalCost).To(Equal(750.0))
+	})
+})
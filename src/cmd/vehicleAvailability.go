@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TimeWindow is a stretch of the plan in hours from its start.
+type TimeWindow struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Breakdown takes a vehicle out of service from At onwards.
+type Breakdown struct {
+	VehicleID int     `json:"vehicleId"`
+	At        float64 `json:"at"`
+}
+
+// MovedShipment records a package whose delivery changed when the plan was
+// rebuilt. ToVehicle is 0 when it could not be rescheduled.
+type MovedShipment struct {
+	PackageID   string
+	FromVehicle int
+	FromTime    float64
+	ToVehicle   int
+	ToTime      float64
+}
+
+var (
+	vehicleAvailabilityPath string
+	breakdownSpecs          []string
+)
+
+func loadVehicleAvailability(path string) ([]Vehicle, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read vehicles file: %s", err)
+	}
+
+	var vehicles []Vehicle
+	if err := json.Unmarshal(content, &vehicles); err != nil {
+		return nil, fmt.Errorf("Invalid vehicles file: %s", err)
+	}
+
+	seen := make(map[int]bool)
+	for _, vehicle := range vehicles {
+		if vehicle.ID <= 0 || seen[vehicle.ID] {
+			return nil, fmt.Errorf("Vehicle IDs must be positive and unique")
+		}
+		seen[vehicle.ID] = true
+
+		if vehicle.ShiftStart < 0 || (vehicle.ShiftEnd != 0 && vehicle.ShiftEnd <= vehicle.ShiftStart) {
+			return nil, fmt.Errorf("Invalid shift for vehicle %d", vehicle.ID)
+		}
+		if vehicle.Capacity.Weight < 0 || vehicle.Capacity.Volume < 0 || vehicle.Capacity.Packages < 0 {
+			return nil, fmt.Errorf("Invalid capacity for vehicle %d", vehicle.ID)
+		}
+		for _, slot := range vehicle.Maintenance {
+			if slot.Start < 0 || slot.End <= slot.Start {
+				return nil, fmt.Errorf("Invalid maintenance slot for vehicle %d", vehicle.ID)
+			}
+		}
+	}
+
+	return vehicles, nil
+}
+
+// parseBreakdowns reads breakdowns written as vehicle@hours, e.g. 2@1.5.
+func parseBreakdowns(specs []string) ([]Breakdown, error) {
+	var breakdowns []Breakdown
+	for _, spec := range specs {
+		vehicle, at, found := strings.Cut(spec, "@")
+		vehicleID, err := strconv.Atoi(vehicle)
+		if !found || err != nil || vehicleID <= 0 {
+			return nil, fmt.Errorf("Invalid breakdown %s", spec)
+		}
+		hours, err := strconv.ParseFloat(at, 64)
+		if err != nil || hours < 0 {
+			return nil, fmt.Errorf("Invalid breakdown %s", spec)
+		}
+		breakdowns = append(breakdowns, Breakdown{VehicleID: vehicleID, At: hours})
+	}
+	return breakdowns, nil
+}
+
+// checkFleetVehicles makes sure the vehicles file and the breakdowns only
+// name vehicles in the fleet, so a typo fails before anything is planned.
+func checkFleetVehicles(fleetSize int, options SchedulerOptions) error {
+	for _, vehicle := range options.Vehicles {
+		if vehicle.ID > fleetSize {
+			return fmt.Errorf("Unknown vehicle %d in vehicles file", vehicle.ID)
+		}
+	}
+	for _, breakdown := range options.Breakdowns {
+		if breakdown.VehicleID > fleetSize {
+			return fmt.Errorf("Unknown vehicle %d in breakdown", breakdown.VehicleID)
+		}
+	}
+	return nil
+}
+
+func getVehicleAvailability(vehicleID int, options SchedulerOptions) Vehicle {
+	vehicle := Vehicle{ID: vehicleID}
+	for _, configured := range options.Vehicles {
+		if configured.ID == vehicleID {
+			vehicle = configured
+			vehicle.AssignedPackages = nil
+		}
+	}
+
+	for _, breakdown := range options.Breakdowns {
+		if breakdown.VehicleID == vehicleID && (!vehicle.BrokenDown || breakdown.At < vehicle.BrokenDownAt) {
+			vehicle.BrokenDown = true
+			vehicle.BrokenDownAt = breakdown.At
+		}
+	}
+
+	return vehicle
+}
+
+// getDeparture returns the earliest time at or after readyAt the vehicle can
+// leave on a trip of the given length without running into a maintenance slot,
+// the depot calendar, the end of its shift or its breakdown.
+func (v Vehicle) getDeparture(readyAt, duration float64, calendar *DispatchCalendar) (float64, bool) {
+	departure := math.Max(readyAt, v.ShiftStart)
+	for moved := true; moved; {
+		departure = calendar.scheduleTrip(departure, duration)
+		moved = false
+		for _, slot := range v.Maintenance {
+			if departure < slot.End && departure+duration > slot.Start {
+				departure = slot.End
+				moved = true
+			}
+		}
+	}
+
+	returnAt := departure + duration
+	if v.ShiftEnd > 0 && returnAt > v.ShiftEnd+1e-9 {
+		return 0, false
+	}
+	if v.BrokenDown && returnAt > v.BrokenDownAt+1e-9 {
+		return 0, false
+	}
+	return departure, true
+}
+
+// getFirstVehicleToDepart picks the vehicle that can leave soonest on the trip
+// with the load, preferring the lowest vehicle ID on a tie. Departures within a
+// nanohour of each other count as a tie so rounding in earlier trips cannot
+// decide.
+func getFirstVehicleToDepart(vehicleList []Vehicle, vehicleAvailabilityArray []float64, load Capacity, readyAt, duration float64, calendar *DispatchCalendar) (int, float64, bool) {
+	bestIdx, bestDeparture := -1, math.Inf(1)
+	for i, vehicle := range vehicleList {
+		departure, available := vehicle.getDeparture(math.Max(vehicleAvailabilityArray[i], readyAt), duration, calendar)
+		available = available && vehicle.Capacity.holds(load)
+		if available && departure < bestDeparture-1e-9 {
+			bestIdx, bestDeparture = i, departure
+		}
+	}
+	return bestIdx, bestDeparture, bestIdx >= 0
+}
+
+// planFleet plans the packages as if every vehicle stays in service, then
+// replays each breakdown in time order: trips that left before it stand, the
+// broken vehicle's trip stops where it is, and everything not yet delivered is
+// planned again from that moment with the vehicles that remain.
+func planFleet(ctx context.Context, packages []Package, numVehicles, maxSpeed, maxWeight, baseDeliveryCost int, options SchedulerOptions) ([]Trip, []Package, []MovedShipment) {
+	breakdowns := append([]Breakdown(nil), options.Breakdowns...)
+	sort.SliceStable(breakdowns, func(i, j int) bool { return breakdowns[i].At < breakdowns[j].At })
+
+	options.Breakdowns = nil
+	trips, unscheduled := planTrips(ctx, packages, numVehicles, maxSpeed, maxWeight, baseDeliveryCost, options)
+	if len(breakdowns) == 0 {
+		return trips, unscheduled, nil
+	}
+
+	originalTrips := trips
+	for _, breakdown := range breakdowns {
+		options.Breakdowns = append(options.Breakdowns, breakdown)
+
+		keptTrips, pending, busyUntil := splitPlanAtBreakdown(trips, breakdown)
+		for _, pkg := range unscheduled {
+			pkg.DeliveryTime = 0
+			pending = append(pending, pkg)
+		}
+
+		if options.Explanation != nil {
+			options.Explanation.Context = fmt.Sprintf("Re-plan after vehicle %d breaks down at %.2f hours", breakdown.VehicleID+options.Explanation.VehicleOffset, breakdown.At)
+		}
+		if options.Optimiser != nil {
+			options.Optimiser.Context = fmt.Sprintf("Re-plan after breakdown at %.2f hours", breakdown.At)
+		}
+		options.ReadyAt = breakdown.At
+		options.BusyUntil = busyUntil
+		var replannedTrips []Trip
+		replannedTrips, unscheduled = planTrips(ctx, pending, numVehicles, maxSpeed, maxWeight, baseDeliveryCost, options)
+		trips = append(keptTrips, replannedTrips...)
+	}
+
+	return trips, unscheduled, findMovedShipments(originalTrips, trips)
+}
+
+// splitPlanAtBreakdown splits the plan at the breakdown like splitPlanAt, and
+// also ends the broken vehicle's trip in progress there. The packages it had
+// not dropped yet are re-planned too, as if recovered to the depot.
+func splitPlanAtBreakdown(trips []Trip, breakdown Breakdown) ([]Trip, []Package, map[int]float64) {
+	keptTrips, pending, busyUntil := splitPlanAt(trips, breakdown.At)
+
+	for i, trip := range keptTrips {
+		if trip.VehicleID != breakdown.VehicleID || trip.Return <= breakdown.At {
+			continue
+		}
+
+		var delivered []Package
+		for _, pkg := range trip.Packages {
+			if pkg.DeliveryTime <= breakdown.At {
+				delivered = append(delivered, pkg)
+			} else {
+				pkg.DeliveryTime = 0
+				pending = append(pending, pkg)
+			}
+		}
+		keptTrips[i].Distance *= (breakdown.At - trip.Departure) / (trip.Return - trip.Departure)
+		keptTrips[i].Return = breakdown.At
+		keptTrips[i].Packages = delivered
+		busyUntil[trip.VehicleID] = breakdown.At
+	}
+
+	return keptTrips, pending, busyUntil
+}
+
+func findMovedShipments(before, after []Trip) []MovedShipment {
+	type delivery struct {
+		vehicleID int
+		time      float64
+	}
+	planned := make(map[string]delivery)
+	for _, trip := range after {
+		for _, pkg := range trip.Packages {
+			planned[pkg.ID] = delivery{trip.VehicleID, pkg.DeliveryTime}
+		}
+	}
+
+	var moved []MovedShipment
+	for _, trip := range before {
+		for _, pkg := range trip.Packages {
+			now := planned[pkg.ID]
+			if now.vehicleID != trip.VehicleID || math.Abs(now.time-pkg.DeliveryTime) > 1e-9 {
+				moved = append(moved, MovedShipment{
+					PackageID:   pkg.ID,
+					FromVehicle: trip.VehicleID,
+					FromTime:    pkg.DeliveryTime,
+					ToVehicle:   now.vehicleID,
+					ToTime:      now.time,
+				})
+			}
+		}
+	}
+	return moved
+}
+
+func printMovedShipments(title string, moved []MovedShipment) {
+	if len(moved) == 0 {
+		return
+	}
+
+	fmt.Println(title)
+	for _, shipment := range moved {
+		if shipment.ToVehicle == 0 {
+			fmt.Printf("  %s: Vehicle %d at %.2f hours -> not scheduled\n", shipment.PackageID, shipment.FromVehicle, shipment.FromTime)
+			continue
+		}
+		fmt.Printf("  %s: Vehicle %d at %.2f hours -> Vehicle %d at %.2f hours\n",
+			shipment.PackageID, shipment.FromVehicle, shipment.FromTime, shipment.ToVehicle, shipment.ToTime)
+	}
+	fmt.Println()
+}
+
+func printUnscheduledPackages(unscheduled []Package) {
+	if len(unscheduled) == 0 {
+		return
+	}
+
+	fmt.Println("Packages that could not be scheduled:")
+	for _, pkg := range unscheduled {
+		fmt.Printf("  %s\n", pkg.ID)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("vehicle availability", func() {
+	Describe("loadVehicleAvailability", func() {
+		It("should reject a shift that ends before it starts", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "vehicles.json")
+			Expect(os.WriteFile(path, []byte(`[{"id": 1, "shiftStart": 5, "shiftEnd": 3}]`), 0644)).To(Succeed())
+
+			_, err := loadVehicleAvailability(path)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Invalid shift for vehicle 1"))
+		})
+	})
+
+	Describe("parseBreakdowns", func() {
+		It("should read vehicle@hours", func() {
+			breakdowns, err := parseBreakdowns([]string{"2@1.5"})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(breakdowns).To(Equal([]Breakdown{{VehicleID: 2, At: 1.5}}))
+		})
+
+		It("should reject other formats", func() {
+			_, err := parseBreakdowns([]string{"2-1.5"})
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Invalid breakdown 2-1.5"))
+		})
+	})
+
+	Describe("getDeparture", func() {
+		vehicle := Vehicle{ID: 1, ShiftStart: 1, ShiftEnd: 8, Maintenance: []TimeWindow{{Start: 3, End: 4}}}
+
+		It("should wait for the shift to start", func() {
+			departure, available := vehicle.getDeparture(0, 1, nil)
+
+			Expect(available).To(BeTrue())
+			Expect(departure).To(Equal(1.0))
+		})
+
+		It("should not overlap a maintenance slot", func() {
+			departure, available := vehicle.getDeparture(2.5, 1, nil)
+
+			Expect(available).To(BeTrue())
+			Expect(departure).To(Equal(4.0))
+		})
+
+		It("should refuse trips that end after the shift", func() {
+			_, available := vehicle.getDeparture(6, 3, nil)
+			Expect(available).To(BeFalse())
+		})
+	})
+
+	Describe("calculateDeliveryTime", func() {
+		It("should report packages no vehicle is available for", func() {
+			packages := []Package{{ID: "PKG1", Weight: 10, Distance: 70}, {ID: "PKG2", Weight: 10, Distance: 350}}
+			options := SchedulerOptions{Vehicles: []Vehicle{{ID: 1, ShiftEnd: 4}}}
+
+			trips, unscheduled := calculateDeliveryTime(context.Background(), packages, 1, 70, 200, 100, options)
+
+			Expect(trips).To(HaveLen(1))
+			Expect(getPackageIDs(trips[0].Packages)).To(Equal([]string{"PKG1"}))
+			Expect(getPackageIDs(unscheduled)).To(Equal([]string{"PKG2"}))
+		})
+	})
+
+	Describe("CalculateTimeAndCostCmd with breakdowns", func() {
+		var (
+			stdout *os.File
+			r, w   *os.File
+			output bytes.Buffer
+		)
+
+		args := []string{"100", "5", "PKG1 50 30 OFR001", "PKG2 75 125 OFFR0008", "PKG3 175 100 OFFR003", "PKG4 110 60 OFR002", "PKG5 155 95 NA", "2", "70", "200"}
+
+		BeforeEach(func() {
+			stdout = os.Stdout
+			r, w, _ = os.Pipe()
+			os.Stdout = w
+			output.Reset()
+		})
+
+		AfterEach(func() {
+			w.Close()
+			os.Stdout = stdout
+			breakdownSpecs = nil
+			vehicleAvailabilityPath = ""
+		})
+
+		It("should re-plan around a broken down vehicle and report the moved shipments", func() {
+			breakdownSpecs = []string{"2@2"}
+
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			w.Close()
+			output.ReadFrom(r)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Package: PKG3\n  Vehicle: 2\n"))
+			Expect(output.String()).To(ContainSubstring("Shipments moved by breakdowns:\n" +
+				"  PKG5: Vehicle 2 at 4.21 hours -> Vehicle 1 at 4.93 hours\n" +
+				"  PKG1: Vehicle 1 at 4.00 hours -> Vehicle 1 at 6.71 hours\n"))
+		})
+
+		It("should reject breakdowns of vehicles outside the fleet", func() {
+			breakdownSpecs = []string{"3@1"}
+
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Unknown vehicle 3 in breakdown"))
+		})
+
+		It("should reject a vehicles file naming vehicles outside the fleet", func() {
+			vehicleAvailabilityPath = filepath.Join(GinkgoT().TempDir(), "vehicles.json")
+			Expect(os.WriteFile(vehicleAvailabilityPath, []byte(`[{"id": 3, "shiftStart": 1}]`), 0644)).To(Succeed())
+
+			err := calculateTimeAndCostCmd.RunE(nil, args)
+
+			Expect(err).To(MatchError("Unknown vehicle 3 in vehicles file"))
+		})
+	})
+})
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	ScopeQuote       = "quote"
+	ScopePlan        = "plan"
+	ScopeAdminConfig = "admin-config"
+)
+
+// scopeGrants lists what each scope allows. Planning needs quotes, and the
+// admin scope may do everything.
+var scopeGrants = map[string][]string{
+	ScopeQuote:       {ScopeQuote},
+	ScopePlan:        {ScopePlan, ScopeQuote},
+	ScopeAdminConfig: {ScopeAdminConfig, ScopePlan, ScopeQuote},
+}
+
+// APIKey lets a caller into the HTTP API. Only a hash of the key's secret is
+// kept; the secret itself is shown once, when the key is issued. A revoked
+// key is kept so that old requests can still be attributed to it.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	SecretHash string     `json:"secretHash"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+func IsValidScope(scope string) bool {
+	_, found := scopeGrants[scope]
+	return found
+}
+
+// HasScope tells whether the key may be used for something that needs scope.
+// Revoked keys have no scopes.
+func (key APIKey) HasScope(scope string) bool {
+	if key.RevokedAt != nil {
+		return false
+	}
+	for _, held := range key.Scopes {
+		for _, granted := range scopeGrants[held] {
+			if granted == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validateAPIKey(key APIKey) error {
+	if key.SecretHash == "" {
+		return fmt.Errorf("API key secret hash is required")
+	}
+	if len(key.Scopes) == 0 {
+		return fmt.Errorf("API key needs at least one scope")
+	}
+	for _, scope := range key.Scopes {
+		if !IsValidScope(scope) {
+			return fmt.Errorf("Unknown API key scope %s", scope)
+		}
+	}
+	return nil
+}
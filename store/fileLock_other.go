@@ -0,0 +1,13 @@
+//go:build !unix
+
+package store
+
+import "os"
+
+// lockFile is a no-op where flock is not available; the store is then only
+// safe to use from one process at a time.
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func unlockFile(file *os.File) {}
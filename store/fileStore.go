@@ -0,0 +1,559 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	entrySchema          = "schema"
+	entryPackage         = "package"
+	entryPackageStatus   = "packageStatus"
+	entryQuote           = "quote"
+	entryPlan            = "plan"
+	entryOfferRedemption = "offerRedemption"
+	entryCustomer        = "customer"
+	entryInvoice         = "invoice"
+	entryAPIKey          = "apiKey"
+)
+
+// logEntry is one line of the store file. The first line is always a schema
+// entry carrying the version the rest of the file was written with; every
+// later line records one saved record.
+type logEntry struct {
+	Kind    string          `json:"kind"`
+	Version int             `json:"version,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// fileStore is an append-only JSON log replayed into memory on open. Several
+// processes may share one log: every save takes an exclusive lock on the file
+// and first reads the lines others appended since, so IDs are assigned
+// against everything saved so far. A record is checked against memory before
+// it is appended, so the file never holds a line that cannot be replayed.
+// Package and API key reads also pick up those lines first, so a long-running
+// process sees changes made by others while it runs. The log holds the API
+// key hashes signed requests are checked with, so it is created readable by
+// its owner only.
+type fileStore struct {
+	*memoryStore
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	offset int64
+	lines  int
+	closed bool
+}
+
+func NewFileStore(path string) (Repository, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("Unable to open store: %s", err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open store: %s", err)
+	}
+
+	s := &fileStore{memoryStore: newMemoryStore(), path: path, file: file}
+	if err := s.lock(); err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	s.unlock()
+	return s, nil
+}
+
+// lock takes the exclusive file lock and brings memory up to date with the
+// log. A migration by another process renames a new log over the path; the
+// new log is then opened and read from the start. The caller holds s.mu.
+func (s *fileStore) lock() error {
+	for {
+		if err := lockFile(s.file); err != nil {
+			return fmt.Errorf("Unable to lock store: %s", err)
+		}
+		current, pathErr := os.Stat(s.path)
+		opened, fileErr := s.file.Stat()
+		if pathErr == nil && fileErr == nil && os.SameFile(current, opened) {
+			break
+		}
+
+		unlockFile(s.file)
+		file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("Unable to open store: %s", err)
+		}
+		s.file.Close()
+		s.file, s.offset, s.lines = file, 0, 0
+		s.memoryStore.reset()
+	}
+
+	if s.offset == 0 {
+		if err := s.load(); err != nil {
+			unlockFile(s.file)
+			return err
+		}
+		return nil
+	}
+
+	entries, err := s.readEntries()
+	if err == nil {
+		err = s.applyEntries(entries)
+	}
+	if err != nil {
+		unlockFile(s.file)
+	}
+	return err
+}
+
+func (s *fileStore) unlock() {
+	unlockFile(s.file)
+}
+
+// readEntries reads the complete lines after the offset read so far. Every
+// entry is written with its newline in one go under the lock, so a last line
+// without one was cut short by a crash mid-write; it is truncated so that the
+// next entry starts on a line of its own. Any complete line that does not
+// parse is an error.
+func (s *fileStore) readEntries() ([]logEntry, error) {
+	if _, err := s.file.Seek(s.offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("Unable to read store: %s", err)
+	}
+
+	var entries []logEntry
+	reader := bufio.NewReader(s.file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read store: %s", err)
+		}
+		s.offset += int64(len(line))
+		s.lines++
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var entry logEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("Invalid store entry at line %d", s.lines)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := s.file.Truncate(s.offset); err != nil {
+		return nil, fmt.Errorf("Unable to write store: %s", err)
+	}
+	if _, err := s.file.Seek(s.offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("Unable to write store: %s", err)
+	}
+	return entries, nil
+}
+
+func (s *fileStore) applyEntries(entries []logEntry) error {
+	for _, entry := range entries {
+		if err := s.memoryStore.apply(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load replays the log from the start. The first line carries the schema
+// version; a log written with an older schema is migrated and rewritten
+// before it is used.
+func (s *fileStore) load() error {
+	entries, err := s.readEntries()
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		return s.append(logEntry{Kind: entrySchema, Version: getSchemaVersion()})
+	}
+	if entries[0].Kind != entrySchema {
+		return fmt.Errorf("Invalid store file: schema version is missing")
+	}
+	version := entries[0].Version
+	if version > getSchemaVersion() {
+		return fmt.Errorf("Store schema version %d is newer than this build supports", version)
+	}
+
+	entries, err = migrateEntries(entries[1:], version)
+	if err != nil {
+		return err
+	}
+	if err := s.applyEntries(entries); err != nil {
+		return err
+	}
+
+	if version < getSchemaVersion() {
+		return s.rewrite(entries)
+	}
+	return nil
+}
+
+// rewrite replaces the log with the migrated entries under the current
+// schema version. The new log is written next to the old one, locked and
+// renamed over it, so a crash leaves one or the other intact and no other
+// process appends to the new log before it is complete.
+func (s *fileStore) rewrite(entries []logEntry) error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("Unable to migrate store: %s", err)
+	}
+	if err := lockFile(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Unable to migrate store: %s", err)
+	}
+
+	var offset int64
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range append([]logEntry{{Kind: entrySchema, Version: getSchemaVersion()}}, entries...) {
+		line, _ := json.Marshal(entry)
+		n, _ := writer.Write(append(line, '\n'))
+		offset += int64(n)
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Unable to migrate store: %s", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Unable to migrate store: %s", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Unable to migrate store: %s", err)
+	}
+
+	s.file.Close()
+	s.file, s.offset, s.lines = tmp, offset, len(entries)+1
+	return nil
+}
+
+// check reports whether the entry could be applied to the store as it
+// stands, without changing anything, so that a save never appends a line
+// that fails to replay.
+func (s *memoryStore) check(entry logEntry) error {
+	var err error
+	switch entry.Kind {
+	case entryPackage:
+		var pkg Package
+		if err = json.Unmarshal(entry.Data, &pkg); err == nil {
+			err = validatePackage(pkg)
+		}
+	case entryPackageStatus:
+		var change packageStatusChange
+		if err = json.Unmarshal(entry.Data, &change); err == nil {
+			var pkg Package
+			if pkg, err = s.GetPackage(change.PackageID); err == nil {
+				err = validateStatusChange(pkg, change.Status)
+			}
+		}
+	case entryQuote:
+		var quote Quote
+		if err = json.Unmarshal(entry.Data, &quote); err == nil {
+			err = validateQuote(quote)
+		}
+	case entryPlan:
+		var plan Plan
+		err = json.Unmarshal(entry.Data, &plan)
+	case entryOfferRedemption:
+		var redemption OfferRedemption
+		if err = json.Unmarshal(entry.Data, &redemption); err == nil {
+			err = validateOfferRedemption(redemption)
+		}
+	case entryCustomer:
+		var customer Customer
+		if err = json.Unmarshal(entry.Data, &customer); err == nil {
+			err = validateCustomer(customer)
+		}
+	case entryInvoice:
+		var invoice Invoice
+		if err = json.Unmarshal(entry.Data, &invoice); err == nil {
+			err = validateInvoice(invoice)
+		}
+	case entryAPIKey:
+		var key APIKey
+		if err = json.Unmarshal(entry.Data, &key); err == nil {
+			err = validateAPIKey(key)
+		}
+	default:
+		err = fmt.Errorf("Unknown store entry kind %s", entry.Kind)
+	}
+	return err
+}
+
+// apply replays one saved record into memory.
+func (s *memoryStore) apply(entry logEntry) error {
+	var err error
+	switch entry.Kind {
+	case entryPackage:
+		var pkg Package
+		if err = json.Unmarshal(entry.Data, &pkg); err == nil {
+			err = s.SavePackage(pkg)
+		}
+	case entryPackageStatus:
+		var change packageStatusChange
+		if err = json.Unmarshal(entry.Data, &change); err == nil {
+			_, err = s.UpdatePackageStatus(change.PackageID, change.Status, change.At)
+		}
+	case entryQuote:
+		var quote Quote
+		if err = json.Unmarshal(entry.Data, &quote); err == nil {
+			err = s.SaveQuote(quote)
+		}
+	case entryPlan:
+		var plan Plan
+		if err = json.Unmarshal(entry.Data, &plan); err == nil {
+			_, err = s.SavePlan(plan)
+		}
+	case entryOfferRedemption:
+		var redemption OfferRedemption
+		if err = json.Unmarshal(entry.Data, &redemption); err == nil {
+			err = s.SaveOfferRedemption(redemption)
+		}
+	case entryCustomer:
+		var customer Customer
+		if err = json.Unmarshal(entry.Data, &customer); err == nil {
+			err = s.SaveCustomer(customer)
+		}
+	case entryInvoice:
+		var invoice Invoice
+		if err = json.Unmarshal(entry.Data, &invoice); err == nil {
+			_, err = s.SaveInvoice(invoice)
+		}
+	case entryAPIKey:
+		var key APIKey
+		if err = json.Unmarshal(entry.Data, &key); err == nil {
+			_, err = s.SaveAPIKey(key)
+		}
+	default:
+		return fmt.Errorf("Unknown store entry kind %s", entry.Kind)
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid %s entry in store: %s", entry.Kind, err)
+	}
+	return nil
+}
+
+func (s *fileStore) append(entry logEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := s.file.WriteAt(line, s.offset); err != nil {
+		return fmt.Errorf("Unable to write store: %s", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("Unable to write store: %s", err)
+	}
+	s.offset += int64(len(line))
+	s.lines++
+	return nil
+}
+
+// save checks the record against memory, appends it to the log and applies
+// it. The caller holds the lock.
+func (s *fileStore) save(kind string, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	entry := logEntry{Kind: kind, Data: data}
+	if err := s.memoryStore.check(entry); err != nil {
+		return err
+	}
+	if err := s.append(entry); err != nil {
+		return err
+	}
+	return s.memoryStore.apply(entry)
+}
+
+// update runs fn under the process and file locks, with memory up to date
+// with the log.
+func (s *fileStore) update(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.unlock()
+	return fn()
+}
+
+// read brings memory up to date with the log and then runs fn. Once the
+// store is closed fn runs against what was last read.
+func (s *fileStore) read(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		if err := s.lock(); err != nil {
+			return err
+		}
+		s.unlock()
+	}
+	return fn()
+}
+
+func (s *fileStore) SavePackage(pkg Package) error {
+	if err := validatePackage(pkg); err != nil {
+		return err
+	}
+
+	pkg.Status, pkg.History, pkg.Attempts = "", nil, 0
+	return s.update(func() error {
+		return s.save(entryPackage, pkg)
+	})
+}
+
+func (s *fileStore) UpdatePackageStatus(id, status string, at time.Time) (Package, error) {
+	var pkg Package
+	err := s.update(func() error {
+		if err := s.save(entryPackageStatus, packageStatusChange{PackageID: id, Status: status, At: at}); err != nil {
+			return err
+		}
+		var err error
+		pkg, err = s.memoryStore.GetPackage(id)
+		return err
+	})
+	return pkg, err
+}
+
+func (s *fileStore) GetPackage(id string) (Package, error) {
+	var pkg Package
+	err := s.read(func() error {
+		var err error
+		pkg, err = s.memoryStore.GetPackage(id)
+		return err
+	})
+	return pkg, err
+}
+
+func (s *fileStore) ListPackages() ([]Package, error) {
+	var packages []Package
+	err := s.read(func() error {
+		var err error
+		packages, err = s.memoryStore.ListPackages()
+		return err
+	})
+	return packages, err
+}
+
+func (s *fileStore) SaveQuote(quote Quote) error {
+	if err := validateQuote(quote); err != nil {
+		return err
+	}
+
+	return s.update(func() error {
+		return s.save(entryQuote, quote)
+	})
+}
+
+func (s *fileStore) SavePlan(plan Plan) (string, error) {
+	err := s.update(func() error {
+		if plan.ID == "" {
+			s.memoryStore.mu.RLock()
+			plan.ID = s.memoryStore.nextPlanID()
+			s.memoryStore.mu.RUnlock()
+		}
+		return s.save(entryPlan, plan)
+	})
+	return plan.ID, err
+}
+
+func (s *fileStore) SaveOfferRedemption(redemption OfferRedemption) error {
+	if err := validateOfferRedemption(redemption); err != nil {
+		return err
+	}
+
+	return s.update(func() error {
+		return s.save(entryOfferRedemption, redemption)
+	})
+}
+
+func (s *fileStore) SaveCustomer(customer Customer) error {
+	if err := validateCustomer(customer); err != nil {
+		return err
+	}
+
+	return s.update(func() error {
+		return s.save(entryCustomer, customer)
+	})
+}
+
+func (s *fileStore) SaveInvoice(invoice Invoice) (string, error) {
+	if err := validateInvoice(invoice); err != nil {
+		return "", err
+	}
+
+	err := s.update(func() error {
+		if invoice.Number == "" {
+			s.memoryStore.mu.RLock()
+			invoice.Number = s.memoryStore.nextInvoiceNumber()
+			s.memoryStore.mu.RUnlock()
+		}
+		return s.save(entryInvoice, invoice)
+	})
+	return invoice.Number, err
+}
+
+func (s *fileStore) SaveAPIKey(key APIKey) (string, error) {
+	if err := validateAPIKey(key); err != nil {
+		return "", err
+	}
+
+	err := s.update(func() error {
+		if key.ID == "" {
+			s.memoryStore.mu.RLock()
+			key.ID = s.memoryStore.nextAPIKeyID()
+			s.memoryStore.mu.RUnlock()
+		}
+		return s.save(entryAPIKey, key)
+	})
+	return key.ID, err
+}
+
+func (s *fileStore) GetAPIKey(id string) (APIKey, error) {
+	var key APIKey
+	err := s.read(func() error {
+		var err error
+		key, err = s.memoryStore.GetAPIKey(id)
+		return err
+	})
+	return key, err
+}
+
+func (s *fileStore) ListAPIKeys() ([]APIKey, error) {
+	var keys []APIKey
+	err := s.read(func() error {
+		var err error
+		keys, err = s.memoryStore.ListAPIKeys()
+		return err
+	})
+	return keys, err
+}
+
+func (s *fileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return s.file.Close()
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("fileStore", func() {
+	var dir, path string
+
+	BeforeEach(func() {
+		dir, _ = os.MkdirTemp("", "store")
+		path = filepath.Join(dir, "data", "store.jsonl")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Repository", func() {
+		describeRepository(func() Repository {
+			repository, err := NewFileStore(path)
+			Expect(err).ToNot(HaveOccurred())
+			return repository
+		})
+	})
+
+	It("should read back what an earlier run saved", func() {
+		repository, err := NewFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+		repository.SavePackage(Package{ID: "PKG1", Weight: 5, Distance: 5, OfferCode: "OFR001", CreatedAt: quotedAt})
+		repository.SaveQuote(Quote{PackageID: "PKG1", BaseDeliveryCost: 100, FinalCost: 175, QuotedAt: quotedAt})
+		repository.UpdatePackageStatus("PKG1", StatusQuoted, quotedAt)
+		repository.SavePlan(Plan{PackageIDs: []string{"PKG1"}, State: json.RawMessage(`{"trips":[]}`)})
+		Expect(repository.Close()).To(Succeed())
+
+		reopened, err := NewFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer reopened.Close()
+
+		pkg, _ := reopened.GetPackage("PKG1")
+		quotes, _ := reopened.ListQuotes()
+		plan, _ := reopened.GetPlan("PLAN-1")
+		Expect(pkg).To(Equal(Package{ID: "PKG1", Weight: 5, Distance: 5, OfferCode: "OFR001", CreatedAt: quotedAt, Status: StatusQuoted, History: []StatusChange{{Status: StatusCreated, At: quotedAt}, {Status: StatusQuoted, At: quotedAt}}}))
+		Expect(quotes).To(HaveLen(1))
+		Expect(string(plan.State)).To(Equal(`{"trips":[]}`))
+
+		id, _ := reopened.SavePlan(Plan{PackageIDs: []string{"PKG2"}})
+		Expect(id).To(Equal("PLAN-2"))
+	})
+
+	It("should create the log readable by its owner only", func() {
+		repository, err := NewFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer repository.Close()
+
+		info, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("should number records after those another process saved", func() {
+		first, _ := NewFileStore(path)
+		defer first.Close()
+		second, _ := NewFileStore(path)
+		defer second.Close()
+
+		first.SavePlan(Plan{PackageIDs: []string{"PKG1"}})
+		id, err := second.SavePlan(Plan{PackageIDs: []string{"PKG2"}})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(id).To(Equal("PLAN-2"))
+		plans, _ := second.ListPlans()
+		Expect(plans).To(HaveLen(2))
+	})
+
+	It("should read packages changed by another process", func() {
+		first, _ := NewFileStore(path)
+		defer first.Close()
+		second, _ := NewFileStore(path)
+		defer second.Close()
+
+		first.SavePackage(Package{ID: "PKG1"})
+		first.UpdatePackageStatus("PKG1", StatusQuoted, quotedAt)
+
+		pkg, err := second.GetPackage("PKG1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pkg.Status).To(Equal(StatusQuoted))
+		packages, _ := second.ListPackages()
+		Expect(packages).To(HaveLen(1))
+	})
+
+	It("should give concurrent writers unique IDs", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				repository, err := NewFileStore(path)
+				Expect(err).ToNot(HaveOccurred())
+				defer repository.Close()
+				for j := 0; j < 5; j++ {
+					_, err := repository.SavePlan(Plan{PackageIDs: []string{fmt.Sprintf("PKG%d", i)}})
+					Expect(err).ToNot(HaveOccurred())
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		reopened, err := NewFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer reopened.Close()
+		plans, _ := reopened.ListPlans()
+		ids := make(map[string]bool)
+		for _, plan := range plans {
+			ids[plan.ID] = true
+		}
+		Expect(plans).To(HaveLen(20))
+		Expect(ids).To(HaveLen(20))
+	})
+
+	It("should refuse a change that no longer applies without writing it", func() {
+		first, _ := NewFileStore(path)
+		defer first.Close()
+		first.SavePackage(Package{ID: "PKG1"})
+		second, _ := NewFileStore(path)
+		defer second.Close()
+		first.UpdatePackageStatus("PKG1", StatusQuoted, quotedAt)
+		first.UpdatePackageStatus("PKG1", StatusScheduled, quotedAt)
+
+		_, err := second.UpdatePackageStatus("PKG1", StatusQuoted, quotedAt)
+
+		Expect(err).To(MatchError("Package PKG1 cannot move from scheduled to quoted"))
+		reopened, err := NewFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer reopened.Close()
+		pkg, _ := reopened.GetPackage("PKG1")
+		Expect(pkg.Status).To(Equal(StatusScheduled))
+	})
+
+	It("should drop a last entry cut short mid-write", func() {
+		content := `{"kind":"schema","version":1}` + "\n" +
+			`{"kind":"package","data":{"id":"PKG1","weight":5,"distance":5,"offerCode":"NA"}}` + "\n" +
+			`{"kind":"package","data":{"id":"PK`
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+
+		repository, err := NewFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repository.SavePackage(Package{ID: "PKG2"})).To(Succeed())
+		repository.Close()
+
+		reopened, err := NewFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer reopened.Close()
+		packages, _ := reopened.ListPackages()
+		Expect(packages).To(HaveLen(2))
+	})
+
+	It("should reject a damaged entry in the middle of the log", func() {
+		content := `{"kind":"schema","version":1}` + "\n" + `not json` + "\n" + `{"kind":"package","data":{"id":"PKG1"}}` + "\n"
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+
+		_, err := NewFileStore(path)
+
+		Expect(err).To(MatchError("Invalid store entry at line 2"))
+	})
+
+	It("should refuse a log from a newer schema", func() {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(`{"kind":"schema","version":99}`+"\n"), 0644)
+
+		_, err := NewFileStore(path)
+
+		Expect(err).To(MatchError("Store schema version 99 is newer than this build supports"))
+	})
+
+	Describe("migrations", func() {
+		var original []migration
+
+		BeforeEach(func() {
+			original = migrations
+			migrations = append(append([]migration(nil), original...), migration{
+				Version:     getSchemaVersion() + 1,
+				Description: "offer codes are upper case",
+				Migrate: func(entry logEntry) ([]logEntry, error) {
+					if entry.Kind != entryPackage {
+						return []logEntry{entry}, nil
+					}
+					var pkg Package
+					json.Unmarshal(entry.Data, &pkg)
+					pkg.OfferCode = strings.ToUpper(pkg.OfferCode)
+					entry.Data, _ = json.Marshal(pkg)
+					return []logEntry{entry}, nil
+				},
+			})
+		})
+
+		AfterEach(func() {
+			migrations = original
+		})
+
+		It("should mark packages quoted before statuses were kept as quoted", func() {
+			migrations = original
+			content := `{"kind":"schema","version":1}` + "\n" +
+				`{"kind":"package","data":{"id":"PKG1","weight":5,"distance":5,"offerCode":"NA","createdAt":"2024-05-01T08:00:00Z"}}` + "\n" +
+				`{"kind":"quote","data":{"packageId":"PKG1","baseDeliveryCost":100,"finalCost":175,"quotedAt":"2024-05-01T08:00:00Z"}}` + "\n"
+			os.MkdirAll(filepath.Dir(path), 0755)
+			os.WriteFile(path, []byte(content), 0644)
+
+			repository, err := NewFileStore(path)
+			Expect(err).ToNot(HaveOccurred())
+			defer repository.Close()
+
+			pkg, _ := repository.GetPackage("PKG1")
+			Expect(pkg.Status).To(Equal(StatusQuoted))
+			Expect(pkg.History).To(Equal([]StatusChange{{Status: StatusCreated, At: quotedAt}, {Status: StatusQuoted, At: quotedAt}}))
+		})
+
+		It("should migrate an older log and rewrite it under the new version", func() {
+			content := `{"kind":"schema","version":5}` + "\n" + `{"kind":"package","data":{"id":"PKG1","weight":5,"distance":5,"offerCode":"ofr001"}}` + "\n"
+			os.MkdirAll(filepath.Dir(path), 0755)
+			os.WriteFile(path, []byte(content), 0644)
+
+			repository, err := NewFileStore(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repository.SavePackage(Package{ID: "PKG2", OfferCode: "OFR002"})).To(Succeed())
+			repository.Close()
+
+			pkg, _ := repository.GetPackage("PKG1")
+			Expect(pkg.OfferCode).To(Equal("OFR001"))
+
+			rewritten, _ := os.ReadFile(path)
+			lines := strings.Split(strings.TrimSpace(string(rewritten)), "\n")
+			Expect(lines).To(HaveLen(3))
+			Expect(lines[0]).To(Equal(`{"kind":"schema","version":6}`))
+			Expect(lines[1]).To(ContainSubstring(`"offerCode":"OFR001"`))
+		})
+	})
+})
@@ -0,0 +1,369 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type memoryStore struct {
+	mu           sync.RWMutex
+	packages     map[string]Package
+	packageOrder []string
+	quotes       []Quote
+	plans        map[string]Plan
+	planOrder    []string
+	redemptions  []OfferRedemption
+	customers    map[string]Customer
+	customerIDs  []string
+	invoices     map[string]Invoice
+	invoiceOrder []string
+	apiKeys      map[string]APIKey
+	apiKeyOrder  []string
+}
+
+func NewMemoryStore() Repository {
+	return newMemoryStore()
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{packages: make(map[string]Package), plans: make(map[string]Plan), customers: make(map[string]Customer), invoices: make(map[string]Invoice), apiKeys: make(map[string]APIKey)}
+}
+
+// reset empties the store, for a log that has to be read again from the
+// start.
+func (s *memoryStore) reset() {
+	empty := newMemoryStore()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.packages, s.packageOrder = empty.packages, nil
+	s.quotes = nil
+	s.plans, s.planOrder = empty.plans, nil
+	s.redemptions = nil
+	s.customers, s.customerIDs = empty.customers, nil
+	s.invoices, s.invoiceOrder = empty.invoices, nil
+	s.apiKeys, s.apiKeyOrder = empty.apiKeys, nil
+}
+
+func validatePackage(pkg Package) error {
+	if pkg.ID == "" {
+		return fmt.Errorf("Package ID is required")
+	}
+	return nil
+}
+
+func validateQuote(quote Quote) error {
+	if quote.PackageID == "" {
+		return fmt.Errorf("Package ID is required")
+	}
+	return nil
+}
+
+func validateOfferRedemption(redemption OfferRedemption) error {
+	if redemption.OfferCode == "" || redemption.PackageID == "" {
+		return fmt.Errorf("Offer code and package ID are required")
+	}
+	return nil
+}
+
+func validateCustomer(customer Customer) error {
+	if customer.ID == "" {
+		return fmt.Errorf("Customer ID is required")
+	}
+	if customer.WeightCostPerKG < 0 || customer.DistanceCostPerKM < 0 || customer.CreditLimit < 0 {
+		return fmt.Errorf("Customer rates and credit limit cannot be negative")
+	}
+	return nil
+}
+
+func validateInvoice(invoice Invoice) error {
+	if invoice.CustomerID == "" {
+		return fmt.Errorf("Customer ID is required")
+	}
+	if len(invoice.Lines) == 0 {
+		return fmt.Errorf("Invoice has no packages")
+	}
+	return nil
+}
+
+func (s *memoryStore) SavePackage(pkg Package) error {
+	if err := validatePackage(pkg); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found := s.packages[pkg.ID]; found {
+		pkg.Status, pkg.History, pkg.Attempts = existing.Status, existing.History, existing.Attempts
+		if pkg.CustomerID == "" {
+			pkg.CustomerID = existing.CustomerID
+		}
+	} else {
+		pkg.Status, pkg.History, pkg.Attempts = StatusCreated, []StatusChange{{Status: StatusCreated, At: pkg.CreatedAt}}, 0
+		s.packageOrder = append(s.packageOrder, pkg.ID)
+	}
+	s.packages[pkg.ID] = pkg
+	return nil
+}
+
+func (s *memoryStore) UpdatePackageStatus(id, status string, at time.Time) (Package, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pkg, found := s.packages[id]
+	if !found {
+		return Package{}, ErrNotFound
+	}
+	if err := validateStatusChange(pkg, status); err != nil {
+		return Package{}, err
+	}
+
+	if status == StatusFailed {
+		pkg.Attempts++
+	}
+	pkg.Status = status
+	pkg.History = append(append([]StatusChange(nil), pkg.History...), StatusChange{Status: status, At: at})
+	s.packages[id] = pkg
+	return pkg, nil
+}
+
+func (s *memoryStore) GetPackage(id string) (Package, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pkg, found := s.packages[id]
+	if !found {
+		return Package{}, ErrNotFound
+	}
+	return pkg, nil
+}
+
+func (s *memoryStore) ListPackages() ([]Package, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	packages := make([]Package, 0, len(s.packageOrder))
+	for _, id := range s.packageOrder {
+		packages = append(packages, s.packages[id])
+	}
+	return packages, nil
+}
+
+func (s *memoryStore) SaveQuote(quote Quote) error {
+	if err := validateQuote(quote); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quotes = append(s.quotes, quote)
+	return nil
+}
+
+func (s *memoryStore) ListQuotes() ([]Quote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Quote(nil), s.quotes...), nil
+}
+
+func (s *memoryStore) SavePlan(plan Plan) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if plan.ID == "" {
+		plan.ID = s.nextPlanID()
+	}
+	s.putPlan(plan)
+	return plan.ID, nil
+}
+
+// nextPlanID numbers plans in the order they were first saved. The caller
+// holds the lock.
+func (s *memoryStore) nextPlanID() string {
+	return fmt.Sprintf("PLAN-%d", len(s.planOrder)+1)
+}
+
+func (s *memoryStore) putPlan(plan Plan) {
+	if _, found := s.plans[plan.ID]; !found {
+		s.planOrder = append(s.planOrder, plan.ID)
+	}
+	s.plans[plan.ID] = plan
+}
+
+func (s *memoryStore) GetPlan(id string) (Plan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	plan, found := s.plans[id]
+	if !found {
+		return Plan{}, ErrNotFound
+	}
+	return plan, nil
+}
+
+func (s *memoryStore) ListPlans() ([]Plan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	plans := make([]Plan, 0, len(s.planOrder))
+	for _, id := range s.planOrder {
+		plans = append(plans, s.plans[id])
+	}
+	return plans, nil
+}
+
+func (s *memoryStore) SaveOfferRedemption(redemption OfferRedemption) error {
+	if err := validateOfferRedemption(redemption); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.redemptions = append(s.redemptions, redemption)
+	return nil
+}
+
+func (s *memoryStore) ListOfferRedemptions() ([]OfferRedemption, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]OfferRedemption(nil), s.redemptions...), nil
+}
+
+func (s *memoryStore) SaveCustomer(customer Customer) error {
+	if err := validateCustomer(customer); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.customers[customer.ID]; !found {
+		s.customerIDs = append(s.customerIDs, customer.ID)
+	}
+	s.customers[customer.ID] = customer
+	return nil
+}
+
+func (s *memoryStore) GetCustomer(id string) (Customer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	customer, found := s.customers[id]
+	if !found {
+		return Customer{}, ErrNotFound
+	}
+	return customer, nil
+}
+
+func (s *memoryStore) ListCustomers() ([]Customer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	customers := make([]Customer, 0, len(s.customerIDs))
+	for _, id := range s.customerIDs {
+		customers = append(customers, s.customers[id])
+	}
+	return customers, nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+func (s *memoryStore) SaveInvoice(invoice Invoice) (string, error) {
+	if err := validateInvoice(invoice); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if invoice.Number == "" {
+		invoice.Number = s.nextInvoiceNumber()
+	}
+	if _, found := s.invoices[invoice.Number]; !found {
+		s.invoiceOrder = append(s.invoiceOrder, invoice.Number)
+	}
+	s.invoices[invoice.Number] = invoice
+	return invoice.Number, nil
+}
+
+// nextInvoiceNumber numbers invoices in the order they were first saved,
+// padded so that they sort as text. The caller holds the lock.
+func (s *memoryStore) nextInvoiceNumber() string {
+	return fmt.Sprintf("INV-%06d", len(s.invoiceOrder)+1)
+}
+
+func (s *memoryStore) GetInvoice(number string) (Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invoice, found := s.invoices[number]
+	if !found {
+		return Invoice{}, ErrNotFound
+	}
+	return invoice, nil
+}
+
+func (s *memoryStore) ListInvoices() ([]Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invoices := make([]Invoice, 0, len(s.invoiceOrder))
+	for _, number := range s.invoiceOrder {
+		invoices = append(invoices, s.invoices[number])
+	}
+	return invoices, nil
+}
+
+func (s *memoryStore) SaveAPIKey(key APIKey) (string, error) {
+	if err := validateAPIKey(key); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key.ID == "" {
+		key.ID = s.nextAPIKeyID()
+	}
+	if _, found := s.apiKeys[key.ID]; !found {
+		s.apiKeyOrder = append(s.apiKeyOrder, key.ID)
+	}
+	s.apiKeys[key.ID] = key
+	return key.ID, nil
+}
+
+// nextAPIKeyID numbers keys in the order they were first saved. The caller
+// holds the lock.
+func (s *memoryStore) nextAPIKeyID() string {
+	return fmt.Sprintf("KEY-%d", len(s.apiKeyOrder)+1)
+}
+
+func (s *memoryStore) GetAPIKey(id string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, found := s.apiKeys[id]
+	if !found {
+		return APIKey{}, ErrNotFound
+	}
+	return key, nil
+}
+
+func (s *memoryStore) ListAPIKeys() ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(s.apiKeyOrder))
+	for _, id := range s.apiKeyOrder {
+		keys = append(keys, s.apiKeys[id])
+	}
+	return keys, nil
+}
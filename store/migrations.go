@@ -0,0 +1,69 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// migration brings a record written under an older schema up to Version. A
+// record may become several, e.g. when a version starts keeping something
+// that used to be implied. Migrate may be nil for versions that only add
+// record kinds.
+type migration struct {
+	Version     int
+	Description string
+	Migrate     func(entry logEntry) ([]logEntry, error)
+}
+
+// migrations lists every schema version in order. Append to it, never edit
+// a released entry.
+var migrations = []migration{
+	{Version: 1, Description: "packages, quotes, plans and offer redemptions"},
+	{Version: 2, Description: "package status history", Migrate: addQuotedStatus},
+	{Version: 3, Description: "customer accounts"},
+	{Version: 4, Description: "invoices"},
+	{Version: 5, Description: "API keys"},
+}
+
+func getSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// migrateEntries runs the migrations newer than the version the entries were
+// written with, oldest first.
+func migrateEntries(entries []logEntry, version int) ([]logEntry, error) {
+	for _, m := range migrations {
+		if m.Version <= version || m.Migrate == nil {
+			continue
+		}
+
+		var migrated []logEntry
+		for _, entry := range entries {
+			result, err := m.Migrate(entry)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to migrate store to version %d: %s", m.Version, err)
+			}
+			migrated = append(migrated, result...)
+		}
+		entries = migrated
+	}
+	return entries, nil
+}
+
+// addQuotedStatus marks every package quoted before statuses were kept as
+// quoted from the time of its quote.
+func addQuotedStatus(entry logEntry) ([]logEntry, error) {
+	if entry.Kind != entryQuote {
+		return []logEntry{entry}, nil
+	}
+
+	var quote Quote
+	if err := json.Unmarshal(entry.Data, &quote); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(packageStatusChange{PackageID: quote.PackageID, Status: StatusQuoted, At: quote.QuotedAt})
+	if err != nil {
+		return nil, err
+	}
+	return []logEntry{entry, {Kind: entryPackageStatus, Data: data}}, nil
+}
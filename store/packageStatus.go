@@ -0,0 +1,63 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	StatusCreated        = "created"
+	StatusQuoted         = "quoted"
+	StatusScheduled      = "scheduled"
+	StatusOutForDelivery = "out-for-delivery"
+	StatusDelivered      = "delivered"
+	StatusFailed         = "failed"
+	StatusReturned       = "returned"
+)
+
+// statusTransitions lists the states a package may move to from each state.
+// Delivered and returned packages are done and move no further.
+var statusTransitions = map[string][]string{
+	StatusCreated:        {StatusQuoted},
+	StatusQuoted:         {StatusQuoted, StatusScheduled},
+	StatusScheduled:      {StatusScheduled, StatusOutForDelivery},
+	StatusOutForDelivery: {StatusDelivered, StatusFailed},
+	StatusFailed:         {StatusScheduled, StatusReturned},
+	StatusDelivered:      {},
+	StatusReturned:       {},
+}
+
+type StatusChange struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+type packageStatusChange struct {
+	PackageID string    `json:"packageId"`
+	Status    string    `json:"status"`
+	At        time.Time `json:"at"`
+}
+
+func IsValidStatus(status string) bool {
+	_, found := statusTransitions[status]
+	return found
+}
+
+func CanTransition(from, to string) bool {
+	for _, status := range statusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+func validateStatusChange(pkg Package, status string) error {
+	if !IsValidStatus(status) {
+		return fmt.Errorf("Unknown package status %s", status)
+	}
+	if !CanTransition(pkg.Status, status) {
+		return fmt.Errorf("Package %s cannot move from %s to %s", pkg.ID, pkg.Status, status)
+	}
+	return nil
+}
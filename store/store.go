@@ -0,0 +1,138 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Repository keeps what the courier service has quoted and planned across
+// runs. NewFileStore persists to an append-only log on disk; NewMemoryStore
+// keeps everything in memory and is meant for tests.
+type Repository interface {
+	SavePackage(pkg Package) error
+	GetPackage(id string) (Package, error)
+	ListPackages() ([]Package, error)
+	// UpdatePackageStatus moves a package to a new state if the lifecycle
+	// allows it and records the change in the package's history.
+	UpdatePackageStatus(id, status string, at time.Time) (Package, error)
+	SaveQuote(quote Quote) error
+	ListQuotes() ([]Quote, error)
+	// SavePlan stores a plan, giving it the next free ID when it has none,
+	// and returns the plan's ID.
+	SavePlan(plan Plan) (string, error)
+	GetPlan(id string) (Plan, error)
+	ListPlans() ([]Plan, error)
+	SaveOfferRedemption(redemption OfferRedemption) error
+	ListOfferRedemptions() ([]OfferRedemption, error)
+	SaveCustomer(customer Customer) error
+	GetCustomer(id string) (Customer, error)
+	ListCustomers() ([]Customer, error)
+	// SaveInvoice stores an invoice, giving it the next invoice number when
+	// it has none, and returns the invoice's number.
+	SaveInvoice(invoice Invoice) (string, error)
+	GetInvoice(number string) (Invoice, error)
+	ListInvoices() ([]Invoice, error)
+	// SaveAPIKey stores an API key, giving it the next free ID when it has
+	// none, and returns the key's ID.
+	SaveAPIKey(key APIKey) (string, error)
+	GetAPIKey(id string) (APIKey, error)
+	ListAPIKeys() ([]APIKey, error)
+	Close() error
+}
+
+var ErrNotFound = errors.New("Record not found")
+
+// Package is a package the service has seen. Saving a package again updates
+// its details but not its status; a new package starts out created, and only
+// UpdatePackageStatus moves it on. Attempts counts its failed deliveries.
+type Package struct {
+	ID           string         `json:"id"`
+	Weight       int            `json:"weight"`
+	Volume       float64        `json:"volume,omitempty"`
+	Distance     int            `json:"distance"`
+	OfferCode    string         `json:"offerCode"`
+	ServiceLevel string         `json:"serviceLevel,omitempty"`
+	CustomerID   string         `json:"customerId,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	Status       string         `json:"status,omitempty"`
+	History      []StatusChange `json:"history,omitempty"`
+	Attempts     int            `json:"attempts,omitempty"`
+}
+
+// Quote is a price given for a package. A package may be quoted more than
+// once; every quote is kept.
+type Quote struct {
+	PackageID        string    `json:"packageId"`
+	CustomerID       string    `json:"customerId,omitempty"`
+	BaseDeliveryCost int       `json:"baseDeliveryCost"`
+	TotalCost        float64   `json:"totalCost"`
+	ContractDiscount float64   `json:"contractDiscount,omitempty"`
+	Discount         float64   `json:"discount"`
+	FinalCost        float64   `json:"finalCost"`
+	QuotedAt         time.Time `json:"quotedAt"`
+}
+
+// Plan is a delivery plan. State holds the plan as the scheduler saved it;
+// the store does not look inside it.
+type Plan struct {
+	ID         string          `json:"id"`
+	PackageIDs []string        `json:"packageIds"`
+	State      json.RawMessage `json:"state"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+type OfferRedemption struct {
+	OfferCode  string    `json:"offerCode"`
+	PackageID  string    `json:"packageId"`
+	Discount   float64   `json:"discount"`
+	RedeemedAt time.Time `json:"redeemedAt"`
+}
+
+// Customer is a sender with a contract. Zero rates mean the public rates
+// apply, an empty DefaultOffer means none and a zero CreditLimit means no
+// limit.
+type Customer struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Tier              string    `json:"tier,omitempty"`
+	WeightCostPerKG   int       `json:"weightCostPerKG,omitempty"`
+	DistanceCostPerKM int       `json:"distanceCostPerKM,omitempty"`
+	DefaultOffer      string    `json:"defaultOffer,omitempty"`
+	CreditLimit       float64   `json:"creditLimit,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// Invoice bills a customer for the packages quoted to it in one period. The
+// amounts are kept as they were billed so that later price changes do not
+// alter an issued invoice. PaidAt is set once the customer has paid it.
+type Invoice struct {
+	Number           string        `json:"number"`
+	CustomerID       string        `json:"customerId"`
+	CustomerName     string        `json:"customerName,omitempty"`
+	Period           string        `json:"period"`
+	IssuedAt         time.Time     `json:"issuedAt"`
+	Lines            []InvoiceLine `json:"lines"`
+	Subtotal         float64       `json:"subtotal"`
+	ContractDiscount float64       `json:"contractDiscount"`
+	Discount         float64       `json:"discount"`
+	Net              float64       `json:"net"`
+	TaxName          string        `json:"taxName,omitempty"`
+	TaxRate          float64       `json:"taxRate"`
+	Tax              float64       `json:"tax"`
+	Total            float64       `json:"total"`
+	PaidAt           *time.Time    `json:"paidAt,omitempty"`
+}
+
+// InvoiceLine is one package on an invoice, priced as its latest quote.
+type InvoiceLine struct {
+	PackageID        string    `json:"packageId"`
+	QuotedAt         time.Time `json:"quotedAt"`
+	Weight           int       `json:"weight"`
+	Distance         int       `json:"distance"`
+	OfferCode        string    `json:"offerCode,omitempty"`
+	TotalCost        float64   `json:"totalCost"`
+	ContractDiscount float64   `json:"contractDiscount"`
+	Discount         float64   `json:"discount"`
+	FinalCost        float64   `json:"finalCost"`
+}
@@ -0,0 +1,231 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestStore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Store Suite")
+}
+
+var quotedAt = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+// describeRepository runs the behaviour every Repository must share against
+// the implementation newRepository returns.
+func describeRepository(newRepository func() Repository) {
+	var repository Repository
+
+	BeforeEach(func() {
+		repository = newRepository()
+	})
+
+	AfterEach(func() {
+		repository.Close()
+	})
+
+	It("should keep the latest version of a package", func() {
+		Expect(repository.SavePackage(Package{ID: "PKG1", Weight: 5, Distance: 5, OfferCode: "OFR001"})).To(Succeed())
+		Expect(repository.SavePackage(Package{ID: "PKG2", Weight: 15, Distance: 5})).To(Succeed())
+		Expect(repository.SavePackage(Package{ID: "PKG1", Weight: 10, Distance: 5, OfferCode: "OFR001"})).To(Succeed())
+
+		pkg, err := repository.GetPackage("PKG1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pkg.Weight).To(Equal(10))
+
+		packages, err := repository.ListPackages()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packages).To(HaveLen(2))
+		Expect(packages[0].ID).To(Equal("PKG1"))
+	})
+
+	It("should report a package it does not have", func() {
+		_, err := repository.GetPackage("PKG9")
+
+		Expect(err).To(MatchError(ErrNotFound))
+	})
+
+	It("should keep every quote and offer redemption", func() {
+		Expect(repository.SaveQuote(Quote{PackageID: "PKG1", BaseDeliveryCost: 100, TotalCost: 175, FinalCost: 175, QuotedAt: quotedAt})).To(Succeed())
+		Expect(repository.SaveQuote(Quote{PackageID: "PKG1", BaseDeliveryCost: 100, TotalCost: 175, Discount: 17.5, FinalCost: 157.5, QuotedAt: quotedAt})).To(Succeed())
+		Expect(repository.SaveOfferRedemption(OfferRedemption{OfferCode: "OFR001", PackageID: "PKG1", Discount: 17.5, RedeemedAt: quotedAt})).To(Succeed())
+
+		quotes, _ := repository.ListQuotes()
+		redemptions, _ := repository.ListOfferRedemptions()
+
+		Expect(quotes).To(HaveLen(2))
+		Expect(quotes[1].FinalCost).To(Equal(157.5))
+		Expect(redemptions).To(Equal([]OfferRedemption{{OfferCode: "OFR001", PackageID: "PKG1", Discount: 17.5, RedeemedAt: quotedAt}}))
+	})
+
+	It("should number new plans and update saved ones", func() {
+		first, err := repository.SavePlan(Plan{PackageIDs: []string{"PKG1"}, State: json.RawMessage(`{"trips":[]}`)})
+		Expect(err).ToNot(HaveOccurred())
+		second, _ := repository.SavePlan(Plan{PackageIDs: []string{"PKG2"}})
+		updated, _ := repository.SavePlan(Plan{ID: first, PackageIDs: []string{"PKG1", "PKG3"}})
+
+		Expect(first).To(Equal("PLAN-1"))
+		Expect(second).To(Equal("PLAN-2"))
+		Expect(updated).To(Equal("PLAN-1"))
+
+		plan, err := repository.GetPlan("PLAN-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plan.PackageIDs).To(Equal([]string{"PKG1", "PKG3"}))
+
+		plans, _ := repository.ListPlans()
+		Expect(plans).To(HaveLen(2))
+	})
+
+	It("should move a package through its lifecycle", func() {
+		repository.SavePackage(Package{ID: "PKG1", Weight: 5, Distance: 5, CreatedAt: quotedAt})
+		for i, status := range []string{StatusQuoted, StatusScheduled, StatusOutForDelivery, StatusFailed, StatusScheduled, StatusOutForDelivery, StatusDelivered} {
+			_, err := repository.UpdatePackageStatus("PKG1", status, quotedAt.Add(time.Duration(i+1)*time.Hour))
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		pkg, _ := repository.GetPackage("PKG1")
+		Expect(pkg.Status).To(Equal(StatusDelivered))
+		Expect(pkg.Attempts).To(Equal(1))
+		Expect(pkg.History).To(HaveLen(8))
+		Expect(pkg.History[0]).To(Equal(StatusChange{Status: StatusCreated, At: quotedAt}))
+		Expect(pkg.History[7].At).To(Equal(quotedAt.Add(7 * time.Hour)))
+	})
+
+	It("should keep the status when a package is saved again", func() {
+		repository.SavePackage(Package{ID: "PKG1", Weight: 5})
+		repository.UpdatePackageStatus("PKG1", StatusQuoted, quotedAt)
+		repository.SavePackage(Package{ID: "PKG1", Weight: 10})
+
+		pkg, _ := repository.GetPackage("PKG1")
+		Expect(pkg.Weight).To(Equal(10))
+		Expect(pkg.Status).To(Equal(StatusQuoted))
+	})
+
+	It("should keep the customer when a package is saved again without one", func() {
+		repository.SavePackage(Package{ID: "PKG1", CustomerID: "ACME"})
+		repository.SavePackage(Package{ID: "PKG1", Weight: 10})
+
+		pkg, _ := repository.GetPackage("PKG1")
+		Expect(pkg.CustomerID).To(Equal("ACME"))
+	})
+
+	It("should reject transitions the lifecycle does not allow", func() {
+		repository.SavePackage(Package{ID: "PKG1"})
+
+		_, err := repository.UpdatePackageStatus("PKG1", StatusDelivered, quotedAt)
+		Expect(err).To(MatchError("Package PKG1 cannot move from created to delivered"))
+
+		_, err = repository.UpdatePackageStatus("PKG1", "lost", quotedAt)
+		Expect(err).To(MatchError("Unknown package status lost"))
+
+		_, err = repository.UpdatePackageStatus("PKG9", StatusQuoted, quotedAt)
+		Expect(err).To(MatchError(ErrNotFound))
+	})
+
+	It("should keep the latest terms of a customer", func() {
+		Expect(repository.SaveCustomer(Customer{ID: "ACME", Name: "Acme Ltd", Tier: "gold", WeightCostPerKG: 8})).To(Succeed())
+		Expect(repository.SaveCustomer(Customer{ID: "ACME", Name: "Acme Ltd", Tier: "gold", WeightCostPerKG: 7, CreditLimit: 5000})).To(Succeed())
+
+		customer, err := repository.GetCustomer("ACME")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(customer.WeightCostPerKG).To(Equal(7))
+		Expect(customer.CreditLimit).To(Equal(5000.0))
+
+		customers, _ := repository.ListCustomers()
+		Expect(customers).To(HaveLen(1))
+
+		_, err = repository.GetCustomer("GLOBEX")
+		Expect(err).To(MatchError(ErrNotFound))
+	})
+
+	It("should reject negative contract terms", func() {
+		Expect(repository.SaveCustomer(Customer{ID: "ACME", CreditLimit: -1})).ToNot(Succeed())
+	})
+
+	It("should number new invoices and keep them as billed", func() {
+		invoice := Invoice{CustomerID: "ACME", Period: "2024-05", Lines: []InvoiceLine{{PackageID: "PKG1", FinalCost: 175}}, Net: 175, Total: 175}
+		first, err := repository.SaveInvoice(invoice)
+		Expect(err).ToNot(HaveOccurred())
+		second, _ := repository.SaveInvoice(invoice)
+
+		Expect(first).To(Equal("INV-000001"))
+		Expect(second).To(Equal("INV-000002"))
+
+		saved, err := repository.GetInvoice(first)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(saved.Lines).To(Equal(invoice.Lines))
+
+		invoices, _ := repository.ListInvoices()
+		Expect(invoices).To(HaveLen(2))
+		Expect(invoices[1].Number).To(Equal(second))
+
+		_, err = repository.GetInvoice("INV-000009")
+		Expect(err).To(MatchError(ErrNotFound))
+	})
+
+	It("should reject an invoice without packages", func() {
+		_, err := repository.SaveInvoice(Invoice{CustomerID: "ACME"})
+
+		Expect(err).To(MatchError("Invoice has no packages"))
+	})
+
+	It("should number API keys and keep them revoked", func() {
+		id, err := repository.SaveAPIKey(APIKey{Name: "partner", SecretHash: "abc", Scopes: []string{ScopeQuote}, CreatedAt: quotedAt})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(id).To(Equal("KEY-1"))
+
+		key, _ := repository.GetAPIKey(id)
+		revokedAt := quotedAt.Add(time.Hour)
+		key.RevokedAt = &revokedAt
+		Expect(repository.SaveAPIKey(key)).To(Equal(id))
+
+		keys, _ := repository.ListAPIKeys()
+		Expect(keys).To(HaveLen(1))
+		Expect(keys[0].RevokedAt).ToNot(BeNil())
+		Expect(keys[0].RevokedAt.Equal(revokedAt)).To(BeTrue())
+
+		_, err = repository.GetAPIKey("KEY-9")
+		Expect(err).To(MatchError(ErrNotFound))
+	})
+
+	It("should reject API keys without a known scope", func() {
+		_, err := repository.SaveAPIKey(APIKey{SecretHash: "abc", Scopes: []string{"delete"}})
+		Expect(err).To(MatchError("Unknown API key scope delete"))
+
+		_, err = repository.SaveAPIKey(APIKey{SecretHash: "abc"})
+		Expect(err).To(MatchError("API key needs at least one scope"))
+	})
+
+	It("should reject records without an ID", func() {
+		Expect(repository.SavePackage(Package{Weight: 10})).ToNot(Succeed())
+		Expect(repository.SaveQuote(Quote{FinalCost: 10})).ToNot(Succeed())
+		Expect(repository.SaveOfferRedemption(OfferRedemption{PackageID: "PKG1"})).ToNot(Succeed())
+		Expect(repository.SaveCustomer(Customer{Name: "Acme Ltd"})).ToNot(Succeed())
+	})
+}
+
+var _ = Describe("APIKey", func() {
+	It("should grant the scopes each scope includes", func() {
+		plan := APIKey{Scopes: []string{ScopePlan}}
+
+		Expect(plan.HasScope(ScopeQuote)).To(BeTrue())
+		Expect(plan.HasScope(ScopePlan)).To(BeTrue())
+		Expect(plan.HasScope(ScopeAdminConfig)).To(BeFalse())
+		Expect(APIKey{Scopes: []string{ScopeAdminConfig}}.HasScope(ScopePlan)).To(BeTrue())
+	})
+
+	It("should grant nothing once revoked", func() {
+		revokedAt := quotedAt
+
+		Expect(APIKey{Scopes: []string{ScopeAdminConfig}, RevokedAt: &revokedAt}.HasScope(ScopeQuote)).To(BeFalse())
+	})
+})
+
+var _ = Describe("memoryStore", func() {
+	describeRepository(NewMemoryStore)
+})